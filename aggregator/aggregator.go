@@ -32,12 +32,21 @@ type Client interface {
 
 // Query is a data object to hold the query string
 type Query struct {
-	query string
+	Query string
+}
+
+// QueryReply is the answer to a Query sent over the message bus
+type QueryReply struct {
+	Result interface{}
+	Error  *crawler.Error `json:",omitempty"`
 }
 
 // Aggregator is responsible for outputing the data requested by a client
 type Aggregator struct {
 	in            chan *crawler.Crawl
+	ack           func(*crawler.Crawl) error
+	nak           func(*crawler.Crawl, error) error
+	save          func(*crawler.Crawl) error
 	aql           driver.Client
 	db            driver.Database
 	meta          driver.Collection
@@ -69,6 +78,11 @@ type Aggregation struct {
 type Opts struct {
 	Listener     chan *crawler.Crawl
 	ArangoClient driver.Client
+
+	// Ack is called once a crawl has been stored and Nak with the error when it could
+	// not be, for a listener that delivers crawls again until they are acknowledged
+	Ack func(*crawler.Crawl) error
+	Nak func(*crawler.Crawl, error) error
 }
 
 // New creates a new aggregator from the provided options
@@ -134,8 +148,10 @@ func New(opts Opts) (*Aggregator, error) {
 		return nil, err
 	}
 
-	return &Aggregator{
+	a := &Aggregator{
 		in:            opts.Listener,
+		ack:           opts.Ack,
+		nak:           opts.Nak,
 		aql:           opts.ArangoClient,
 		db:            db,
 		meta:          metaCol,
@@ -150,11 +166,13 @@ func New(opts Opts) (*Aggregator, error) {
 		entityRef:     entityRef,
 		metaRef:       metaRef,
 		quit:          make(chan chan bool),
-	}, nil
+	}
+	a.save = a.store
+	return a, nil
 }
 
 // Query returns some data based of a query (query lang yet to be decided)
-func (a *Aggregator) Query(ctx *context.Context, q string) (interface{}, error) {
+func (a *Aggregator) Query(ctx context.Context, q string) (interface{}, error) {
 	return nil, nil
 }
 
@@ -176,12 +194,19 @@ func (a *Aggregator) Start(ctx context.Context) error {
 func (a *Aggregator) p() {
 	for {
 		select {
-		case c := <-a.in:
-			a.store(c)
+		case c, ok := <-a.in:
+			if !ok {
+				// the listener has finished, a nil channel is never ready
+				a.in = nil
+				break
+			}
+			a.settle(c, a.save(c))
 			break
 
 		case q := <-a.quit:
-			ext.Free()
+			if a.ne != nil {
+				a.ne.Free()
+			}
 			q <- true
 			return
 		}
@@ -201,7 +226,28 @@ func (a *Aggregator) Stop(ctx context.Context) error {
 	}
 }
 
-func (a *Aggregator) store(c *crawler.Crawl) {
+// settle acknowledges a crawl that was stored, and reports one that was not so that a
+// listener that delivers crawls again will do so
+func (a *Aggregator) settle(c *crawler.Crawl, err error) {
+	if err != nil {
+		log.Println(err)
+		if a.nak != nil {
+			err = a.nak(c, err)
+		}
+	} else if a.ack != nil {
+		err = a.ack(c)
+	}
+
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (a *Aggregator) store(c *crawler.Crawl) error {
+	// failed crawls are published too but have nothing to store
+	if c.Error != "" {
+		return nil
+	}
 
 	if _, ok := c.HarvestedData.([]interface{}); ok {
 
@@ -218,16 +264,14 @@ func (a *Aggregator) store(c *crawler.Crawl) {
 		if !ok {
 			m, err := a.pages.CreateDocument(context.Background(), doc)
 			if err != nil {
-				log.Println(err)
-				return
+				return errors.Wrap(err, "unable to create page {"+c.URL+"}")
 			}
 
 			ref = &m
 		} else {
 			m, err := a.pages.UpdateDocument(context.Background(), ref.Key, doc)
 			if err != nil {
-				log.Println(err)
-				return
+				return errors.Wrap(err, "unable to update page {"+c.URL+"}")
 			}
 
 			ref = &m
@@ -242,8 +286,9 @@ func (a *Aggregator) store(c *crawler.Crawl) {
 		a.processMeta(aggr)
 		a.processData(aggr)
 
-		a.saveAggregate(aggr)
+		return a.saveAggregate(aggr)
 	}
+	return nil
 }
 
 func (a *Aggregator) processMeta(aggr *Aggregation) {
@@ -0,0 +1,70 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samjohnduke/crawl3/crawler"
+)
+
+func TestAggregatorAckOnlyStored(t *testing.T) {
+	var mu sync.Mutex
+	var acked, naked []string
+	settled := make(chan struct{}, 2)
+
+	in := make(chan *crawler.Crawl)
+	a := &Aggregator{
+		in:   in,
+		quit: make(chan chan bool),
+		save: func(c *crawler.Crawl) error {
+			if c.ID == "broken" {
+				return errors.New("arango is down")
+			}
+			return nil
+		},
+		ack: func(c *crawler.Crawl) error {
+			mu.Lock()
+			acked = append(acked, c.ID)
+			mu.Unlock()
+			settled <- struct{}{}
+			return nil
+		},
+		nak: func(c *crawler.Crawl, err error) error {
+			mu.Lock()
+			naked = append(naked, c.ID+": "+err.Error())
+			mu.Unlock()
+			settled <- struct{}{}
+			return nil
+		},
+	}
+	go a.p()
+
+	in <- &crawler.Crawl{ID: "stored"}
+	in <- &crawler.Crawl{ID: "broken"}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-settled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the crawls to be settled")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := a.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(acked) != 1 || acked[0] != "stored" {
+		t.Errorf("expected only the stored crawl to be acknowledged, got %v", acked)
+	}
+	if len(naked) != 1 || naked[0] != "broken: arango is down" {
+		t.Errorf("expected the crawl that was not stored to be reported, got %v", naked)
+	}
+}
@@ -0,0 +1,20 @@
+package aggregator
+
+import "context"
+
+type clientLocal struct {
+	service Service
+}
+
+// NewClientLocal creates a client that queries an aggregator running in the same
+// process, without going through the message bus
+func NewClientLocal(service Service) Client {
+	return &clientLocal{
+		service: service,
+	}
+}
+
+// Query the aggregator directly
+func (c *clientLocal) Query(ctx context.Context, queryStr string) (result interface{}, err error) {
+	return c.service.Query(ctx, queryStr)
+}
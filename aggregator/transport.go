@@ -3,8 +3,9 @@ package aggregator
 import (
 	"context"
 	"encoding/json"
+	"log"
 
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 	"github.com/samjohnduke/crawl3/crawler"
 )
 
@@ -19,26 +20,44 @@ type TransportNats struct {
 type transportNats struct {
 	conn    *nats.Conn
 	service Service
+	opts    crawler.NatsOpts
 	subs    []*nats.Subscription
 }
 
-// NewTransportNats creates the transport for the nats service
-func NewTransportNats(conn *nats.Conn, service Service) crawler.Transport {
-	return &transportNats{
+// NewTransportNats creates the transport for the nats service. It answers queries on
+// the aggregate subject of the namespace in the options
+func NewTransportNats(conn *nats.Conn, service Service, opts ...crawler.NatsOpts) crawler.Transport {
+	t := &transportNats{
 		conn: conn, service: service,
 	}
+	if len(opts) > 0 {
+		t.opts = opts[0]
+	}
+	return t
 }
 
 // Start subscribes to the nats channels for the service
 func (t *transportNats) Start(ctx context.Context) error {
-	sub, err := t.conn.Subscribe("crawl", func(msg *nats.Msg) {
-		var aq *Query
-		err := json.Unmarshal(msg.Data, aq)
+	subjects, err := crawler.NewSubjects(t.opts.Namespace)
+	if err != nil {
+		return err
+	}
+
+	sub, err := t.conn.Subscribe(subjects.Aggregate, func(msg *nats.Msg) {
+		var aq Query
+		err := json.Unmarshal(msg.Data, &aq)
+		if err != nil {
+			t.reply(msg.Reply, &QueryReply{Error: crawler.NewError(crawler.CodeInvalidRequest, err.Error())})
+			return
+		}
+
+		result, err := t.service.Query(context.Background(), aq.Query)
 		if err != nil {
+			t.reply(msg.Reply, &QueryReply{Error: crawler.NewError(crawler.CodeInternal, err.Error())})
 			return
 		}
 
-		t.service.Query(context.Background(), aq.query)
+		t.reply(msg.Reply, &QueryReply{Result: result})
 	})
 	if err != nil {
 		return err
@@ -48,6 +67,23 @@ func (t *transportNats) Start(ctx context.Context) error {
 	return nil
 }
 
+func (t *transportNats) reply(subject string, reply *QueryReply) {
+	if subject == "" {
+		return
+	}
+
+	out, err := json.Marshal(reply)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = t.conn.Publish(subject, out)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
 // Stop closes all the subscriptions
 func (t *transportNats) Stop(ctx context.Context) error {
 	for _, sub := range t.subs {
@@ -2,30 +2,77 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	driver "github.com/arangodb/go-driver"
 	"github.com/arangodb/go-driver/http"
 	"github.com/samjohnduke/crawl3/aggregator"
 	"github.com/samjohnduke/crawl3/crawler"
 
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
 var startMsg = "Starting Aggregator"
+var durable bool
+var namespace string
+var replay string
+var checkpoint string
 
 func main() {
 	log.Println("Starting Aggregator")
 
-	nc, err := nats.Connect(nats.DefaultURL)
+	flag.BoolVar(&durable, "durable", false, "Consume crawls from a JetStream stream so none are lost while the aggregator is down")
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the nats subjects, shared by the services of one deployment")
+	flag.StringVar(&replay, "replay", "", "Replay the crawls in these comma separated JSON Lines files, directories or globs instead of listening on nats")
+	flag.StringVar(&checkpoint, "checkpoint", "", "The file the position of -replay is saved in so it can be resumed")
+	flag.Parse()
+
+	err := crawler.ValidateNamespace(namespace)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	l := crawler.NewListenerNats(nc)
+	var l crawler.Listener
+	if replay != "" {
+		l, err = crawler.NewListenerFile(crawler.FileListenerOpts{
+			Paths:      strings.Split(replay, ","),
+			Checkpoint: checkpoint,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		nc, err := nats.Connect(nats.DefaultURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// the crawler may not have started yet, so a mismatch is only worth a warning
+		err = crawler.CheckNamespace(nc, namespace, 2*time.Second)
+		if err != nil {
+			log.Println(err)
+		}
+
+		if durable {
+			js, err := nc.JetStream()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			l, err = crawler.NewListenerJetStream(js, crawler.JetStreamOpts{Namespace: namespace})
+			if err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			l = crawler.NewListenerNats(nc, crawler.NatsOpts{Namespace: namespace})
+		}
+	}
 
 	conn, err := http.NewConnection(http.ConnectionConfig{
 		Endpoints: []string{"http://localhost:8529"},
@@ -41,10 +88,16 @@ func main() {
 		log.Fatal(err)
 	}
 
-	a, err := aggregator.New(aggregator.Opts{
+	opts := aggregator.Opts{
 		Listener:     l.Listen(),
 		ArangoClient: aql,
-	})
+	}
+	if al, ok := l.(crawler.AckListener); ok {
+		opts.Ack = al.Ack
+		opts.Nak = al.Nak
+	}
+
+	a, err := aggregator.New(opts)
 
 	if err != nil {
 		log.Fatal(err)
@@ -2,20 +2,24 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
-	"os"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 	"github.com/samjohnduke/crawl3/crawler"
 )
 
 func main() {
+	var namespace string
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the nats subjects the crawler uses")
+	flag.Parse()
+
 	var url string
-	if len(os.Args) == 2 {
-		url = os.Args[1]
-	} else if len(os.Args) > 2 {
+	if flag.NArg() == 1 {
+		url = flag.Arg(0)
+	} else if flag.NArg() > 1 {
 		log.Fatal("Too many arguments, please only pass a single url")
 	} else {
 		log.Fatal("missing url argument")
@@ -26,7 +30,12 @@ func main() {
 		log.Fatal(err)
 	}
 
-	client := crawler.NewClientNats(nc)
+	err = crawler.CheckNamespace(nc, namespace, 2*time.Second)
+	if err != nil {
+		log.Println(err)
+	}
+
+	client := crawler.NewClientNats(nc, crawler.NatsOpts{Namespace: namespace})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
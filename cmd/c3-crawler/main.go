@@ -6,9 +6,11 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
-	"github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 	"github.com/samjohnduke/crawl3/crawler"
 	"github.com/samjohnduke/crawl3/shared"
 )
@@ -17,14 +19,58 @@ var setupMsg = "Setting up Crawler"
 var stopMsg = "Stopping Crawler"
 var workerCount int
 var hostDir string
+var reloadInterval time.Duration
+var grpcAddr string
+var durable bool
+var events bool
+var namespace string
+var publishDir string
+var publishCompress bool
+var webhookURL string
+var webhookSecret string
+var webhookOutbox string
+var warcDir string
+var warcCompress bool
+var proxies string
+var proxyMode string
+var proxyCheck string
+var sessionDir string
+var secretsFile string
+var denyNetworks string
+var allowNetworks string
 
 func main() {
 	log.Println(setupMsg)
 
 	flag.StringVar(&hostDir, "hostDir", "../models", "The directory that stores the models")
 	flag.IntVar(&workerCount, "wc", 40, "The number of workers to spin up")
+	flag.DurationVar(&reloadInterval, "reload", 5*time.Second, "How often to check the model directory for changes")
+	flag.StringVar(&grpcAddr, "grpc", "", "The address to also serve the crawl service over gRPC on")
+	flag.BoolVar(&durable, "durable", false, "Publish crawls to a JetStream stream so none are lost while the aggregator is down")
+	flag.BoolVar(&events, "events", false, "Publish the lifecycle events of every crawl to crawl_events.<host>")
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the nats subjects, shared by the services of one deployment")
+	flag.StringVar(&publishDir, "publish-dir", "", "Also write every crawl to rotated JSON Lines files in this directory")
+	flag.BoolVar(&publishCompress, "publish-compress", false, "Gzip the files written to -publish-dir")
+	flag.StringVar(&webhookURL, "webhook", "", "Also post every crawl to this url")
+	flag.StringVar(&webhookSecret, "webhook-secret", "", "The secret the deliveries to -webhook are signed with")
+	flag.StringVar(&webhookOutbox, "webhook-outbox", "", "The directory failed deliveries to -webhook are kept in until they can be sent")
+	flag.StringVar(&warcDir, "warc-dir", "", "Archive every request and response to WARC files in this directory")
+	flag.BoolVar(&warcCompress, "warc-compress", true, "Gzip the records written to -warc-dir")
+	flag.StringVar(&proxies, "proxy", "", "A comma separated list of http, https or socks5 proxies to fetch pages through, each optionally tagged as tag=url")
+	flag.StringVar(&proxyMode, "proxy-mode", "rotate", "How hosts without a proxy in their model use the proxies, rotate, pin or direct")
+	flag.StringVar(&proxyCheck, "proxy-check", "", "A url fetched through every proxy each minute to check it is healthy")
+	flag.StringVar(&sessionDir, "session-dir", "", "The directory the cookies of each host are saved in, kept in memory when empty")
+	flag.StringVar(&secretsFile, "secrets", "", "A JSON file of the secrets the logins of the models can reference")
+	flag.StringVar(&denyNetworks, "deny-networks", strings.Join(crawler.DefaultDeniedNetworks, ","), "A comma separated list of networks pages may not be fetched from, as CIDRs or loopback, private, link-local, unspecified and multicast. Every network is allowed when empty")
+	flag.StringVar(&allowNetworks, "allow-networks", "", "A comma separated list of networks pages may be fetched from even if they are denied")
 	flag.Parse()
 
+	err := crawler.ValidateNamespace(namespace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	natsOpts := crawler.NatsOpts{Namespace: namespace}
+
 	//Setup the system to wait for shutdown
 	sigs := make(chan os.Signal, 1)
 	done := make(chan bool, 1)
@@ -37,20 +83,125 @@ func main() {
 	}
 
 	instrument := crawler.NewInstrumentationMem()
-	publisher := crawler.NewPublisherNats(nc)
-	logger := log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
-	execs := crawler.NewDefaultExtractors()
+	publisher := crawler.NewPublisherNats(nc, natsOpts)
+	if durable {
+		js, err := nc.JetStream()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		publisher, err = crawler.NewPublisherJetStream(js, crawler.JetStreamOpts{Namespace: namespace})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var sinks []crawler.Sink
+	var filePublisher *crawler.PublisherFile
+	if publishDir != "" {
+		filePublisher, err = crawler.NewPublisherFile(crawler.FileOpts{Dir: publishDir, Compress: publishCompress})
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, crawler.Sink{Name: "file", Publisher: filePublisher})
+	}
+
+	var webhookPublisher *crawler.PublisherWebhook
+	if webhookURL != "" {
+		webhookPublisher, err = crawler.NewPublisherWebhook(crawler.WebhookOpts{
+			Endpoints:      []crawler.WebhookEndpoint{{URL: webhookURL, Secret: webhookSecret}},
+			Retries:        3,
+			OutboxDir:      webhookOutbox,
+			OutboxInterval: time.Minute,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		sinks = append(sinks, crawler.Sink{Name: "webhook", Publisher: webhookPublisher})
+	}
+
+	// the fanout is closed on shutdown, before the sinks, so the crawls queued for them
+	// are published first
+	var fanout *crawler.FanoutPublisher
+	if len(sinks) > 0 {
+		sinks = append([]crawler.Sink{{Name: "default", Publisher: publisher}}, sinks...)
+		fanout, err = crawler.NewFanoutPublisher(instrument, sinks...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		publisher = fanout
+	}
+
+	var archiver crawler.Archiver
+	var warcWriter *crawler.WARCWriter
+	if warcDir != "" {
+		warcWriter, err = crawler.NewWARCWriter(crawler.WARCOpts{Dir: warcDir, Compress: warcCompress})
+		if err != nil {
+			log.Fatal(err)
+		}
+		archiver = warcWriter
+	}
+
+	var proxyPool *crawler.ProxyPool
+	if proxies != "" {
+		var list []crawler.Proxy
+		for _, p := range strings.Split(proxies, ",") {
+			proxy, err := crawler.ParseProxy(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			list = append(list, proxy)
+		}
+
+		proxyPool, err = crawler.NewProxyPool(crawler.ProxyOpts{
+			Proxies:        list,
+			Mode:           shared.ProxyMode(proxyMode),
+			HealthCheckURL: proxyCheck,
+			Instrument:     instrument,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	network, err := crawler.NewNetworkPolicy(crawler.NetworkOpts{
+		Deny:  strings.Split(denyNetworks, ","),
+		Allow: strings.Split(allowNetworks, ","),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// load models for extracting data
-	hosts, err := shared.LoadHostsFromDir(hostDir)
+	sessions, err := crawler.NewSessions(crawler.SessionOpts{
+		Dir:         sessionDir,
+		SecretsFile: secretsFile,
+		Instrument:  instrument,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	for _, host := range hosts {
-		e := &crawler.JSONExtractor{Rules: host.Extractor}
-		execs.Add(e)
+	var sink crawler.EventSink
+	if events {
+		sink = crawler.NewEventSinkNats(nc, natsOpts)
 	}
+	logger := log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
+
+	// load models for extracting data and reload them when they change
+	watcher := shared.NewHostWatcher(hostDir, reloadInterval, logger)
+	hosts, err := watcher.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	execs := crawler.NewReloadableExtractors(crawler.NewHostExtractors(hosts))
+	proxyPool.SetHosts(hosts)
+	sessions.SetHosts(hosts)
+	watcher.OnChange(func(hosts []shared.Host) {
+		execs.Swap(crawler.NewHostExtractors(hosts))
+		proxyPool.SetHosts(hosts)
+		sessions.SetHosts(hosts)
+	})
+	watcher.Start()
 
 	//create the service
 	service, err := crawler.New(crawler.ServiceOpts{
@@ -58,7 +209,12 @@ func main() {
 		Logger:      logger,
 		WorkerCount: int64(workerCount),
 		Publisher:   publisher,
+		Events:      sink,
+		Archiver:    archiver,
 		Extractors:  execs,
+		Proxies:     proxyPool,
+		Sessions:    sessions,
+		Network:     network,
 	}, func(opts crawler.WorkerOpts) crawler.WorkerFactoryFunc {
 		return func(pool chan chan *crawler.Crawl) crawler.Worker {
 			return crawler.NewDefaultWorker(pool, opts)
@@ -69,21 +225,68 @@ func main() {
 	}
 
 	//Connect the service to the nats transport
-	transport := crawler.NewTransportNats(nc, service)
+	transport := crawler.NewTransportNats(nc, service, natsOpts)
 
 	err = transport.Start(context.Background())
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	transports := []crawler.Transport{transport}
+	if grpcAddr != "" {
+		grpcTransport := crawler.NewTransportGRPC(grpcAddr, service)
+		err = grpcTransport.Start(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		transports = append(transports, grpcTransport)
+	}
+
 	// Wait for shutdown and then turn off the transport
 	go func() {
 		<-sigs
 		log.Println(stopMsg)
+		watcher.Stop()
+
+		for _, t := range transports {
+			err := t.Stop(context.Background())
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if fanout != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := fanout.Close(ctx)
+			cancel()
+			if err != nil {
+				log.Println(err)
+			}
+		}
 
-		err = transport.Stop(context.Background())
+		if webhookPublisher != nil {
+			webhookPublisher.Close()
+		}
+
+		proxyPool.Close()
+
+		err := sessions.Flush()
 		if err != nil {
-			log.Fatal(err)
+			log.Println(err)
+		}
+
+		if warcWriter != nil {
+			err := warcWriter.Close()
+			if err != nil {
+				log.Println(err)
+			}
+		}
+
+		if filePublisher != nil {
+			err := filePublisher.Close()
+			if err != nil {
+				log.Println(err)
+			}
 		}
 
 		done <- true
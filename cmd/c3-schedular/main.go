@@ -11,7 +11,7 @@ import (
 
 	"github.com/samjohnduke/crawl3/shared"
 
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 	"github.com/samjohnduke/crawl3/crawler"
 	"github.com/samjohnduke/crawl3/schedular"
 
@@ -22,6 +22,8 @@ import (
 var hostDir string
 var sqldriver string
 var sqlurl string
+var reloadInterval time.Duration
+var namespace string
 var startMsg = "Starting Scheduler"
 var stopMsg = "Stopping Scheduler"
 
@@ -32,39 +34,39 @@ func main() {
 	flag.StringVar(&hostDir, "hostDir", "../models", "The directory that stores the models")
 	flag.StringVar(&sqldriver, "sqldriver", "sqlite3", "The sql driver for storing data")
 	flag.StringVar(&sqlurl, "sqlurl", "./dev.db", "the sql url use to connect to")
+	flag.DurationVar(&reloadInterval, "reload", 5*time.Second, "How often to check the model directory for changes")
+	flag.StringVar(&namespace, "namespace", "", "The namespace of the nats subjects, shared by the services of one deployment")
 	flag.Parse()
 
-	hosts, err := shared.LoadHostsFromDir(hostDir)
+	logger := log.New(os.Stdout, log.Prefix(), log.LstdFlags|log.Lshortfile)
+
+	watcher := shared.NewHostWatcher(hostDir, reloadInterval, logger)
+	hosts, err := watcher.Load()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var allowedHosts = []string{}
-	var schedulers = make(map[string]schedular.HostSchedular)
-	for _, host := range hosts {
-		for _, o := range host.Schedular {
-			schedulers[host.Host] = schedular.NewHostSchedular(o)
-		}
-		allowedHosts = append(allowedHosts, host.Host)
-		allowedHosts = append(allowedHosts, host.Alias...)
-	}
-
 	nc, err := nats.Connect(nats.DefaultURL)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	client := crawler.NewClientNats(nc)
+	// the crawler may not have started yet, so a mismatch is only worth a warning
+	err = crawler.CheckNamespace(nc, namespace, 2*time.Second)
+	if err != nil {
+		log.Println(err)
+	}
+
+	client := crawler.NewClientNats(nc, crawler.NatsOpts{Namespace: namespace})
 	instrumentation := crawler.NewInstrumentationMem()
 	crawlDelay := 2 * time.Second
-	logger := log.New(os.Stdout, log.Prefix(), log.LstdFlags|log.Lshortfile)
 
 	opts := schedular.Opts{
 		Client:         client,
 		CrawlDelay:     crawlDelay,
 		Instrument:     instrumentation,
 		Logger:         logger,
-		AllowedDomains: allowedHosts,
+		AllowedDomains: schedular.AllowedDomains(hosts),
 	}
 
 	sched, err := schedular.NewSchedular(opts)
@@ -98,12 +100,20 @@ func main() {
 	}()
 
 	//Start all the schedulers
-	for _, s := range schedulers {
-		err := s.Start(sched, store)
+	schedulers := schedular.NewHostSet(sched, store, logger)
+	err = schedulers.Update(context.Background(), hosts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Swap in the new schedulers whenever the models change
+	watcher.OnChange(func(hosts []shared.Host) {
+		err := schedulers.Update(context.Background(), hosts)
 		if err != nil {
-			log.Fatal(err)
+			logger.Println(err)
 		}
-	}
+	})
+	watcher.Start()
 
 	// Manage the harvested data
 	sched.OnHarvest(func(c *crawler.Crawl) error {
@@ -115,9 +125,7 @@ func main() {
 		}
 
 		for range c.HarvestedURLs {
-			if s, ok := schedulers[c.Host()]; ok {
-				s.Schedule(c)
-			}
+			schedulers.Schedule(c)
 		}
 
 		return schedular.ErrCancelSchedule
@@ -143,12 +151,11 @@ func main() {
 		}
 
 		close(cancelRescheduler)
+		watcher.Stop()
 
-		for _, s := range schedulers {
-			err := s.Stop(ctx)
-			if err != nil {
-				log.Fatal(err)
-			}
+		err = schedulers.Stop(ctx)
+		if err != nil {
+			log.Fatal(err)
 		}
 
 		done <- true
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/samjohnduke/crawl3/crawler"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+const goldenSuffix = ".golden.json"
+
+// extractResult is what c3 extract prints and what is stored in a golden file. The url
+// is kept so that a fixture can be replayed without being told where it came from
+type extractResult struct {
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	Description   string               `json:"description"`
+	HarvestedData interface{}          `json:"harvestedData"`
+	Validation    []crawler.Validation `json:"validation"`
+}
+
+// extractCmd runs the host models against a saved page. A page is either an html file,
+// which needs the -url it was fetched from, or a saved crawl with its raw data. With
+// -golden the result is compared against the stored expectation, and with -fixtures
+// every page in a directory that has a golden file next to it is checked.
+func extractCmd(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	hostDir := fs.String("hostDir", "../models", "The directory that stores the models")
+	pageURL := fs.String("url", "", "The url the html page was fetched from")
+	golden := fs.String("golden", "", "Compare the result with this golden file")
+	fixtures := fs.String("fixtures", "", "Check every page in this directory against its golden file")
+	update := fs.Bool("update", false, "Write the result to the golden file rather than comparing it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: c3 extract [flags] <page.html|crawl.json>")
+		fmt.Fprintln(os.Stderr, "       c3 extract [flags] -fixtures <dir>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	hosts, err := shared.LoadHostsFromDir(*hostDir)
+	if err != nil {
+		return err
+	}
+	exes := crawler.NewHostExtractors(hosts)
+
+	if *fixtures != "" {
+		return checkFixtures(exes, *fixtures, *update)
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	result, err := extractFile(exes, fs.Arg(0), *pageURL)
+	if err != nil {
+		return err
+	}
+
+	if *golden == "" {
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if *update {
+		return writeGolden(*golden, result)
+	}
+
+	return compareGolden(*golden, result)
+}
+
+// checkFixtures runs every page in the directory against its golden file and reports
+// all of the pages that no longer match
+func checkFixtures(exes crawler.Extractors, dir string, update bool) error {
+	goldens, err := filepath.Glob(filepath.Join(dir, "*"+goldenSuffix))
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, golden := range goldens {
+		name := strings.TrimSuffix(golden, goldenSuffix)
+		page, err := fixturePage(name)
+		if err != nil {
+			return err
+		}
+
+		expected, err := readGolden(golden)
+		if err != nil {
+			return err
+		}
+
+		result, err := extractFile(exes, page, expected.URL)
+		if err != nil {
+			return errors.Wrapf(err, "unable to extract %s", page)
+		}
+
+		if update {
+			err = writeGolden(golden, result)
+		} else {
+			err = compareGolden(golden, result)
+		}
+
+		if err != nil {
+			log.Printf("FAIL %s: %s", page, err)
+			failed++
+			continue
+		}
+
+		log.Printf("ok   %s", page)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d fixtures failed", failed, len(goldens))
+	}
+
+	return nil
+}
+
+// fixturePage finds the page a golden file was produced from
+func fixturePage(name string) (string, error) {
+	for _, ext := range []string{".html", ".htm", ".crawl.json"} {
+		if _, err := os.Stat(name + ext); err == nil {
+			return name + ext, nil
+		}
+	}
+	return "", errors.Errorf("no page found for fixture {%s}", name)
+}
+
+// extractFile runs the extractors over a saved html page or crawl
+func extractFile(exes crawler.Extractors, filename string, pageURL string) (*extractResult, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	crawl := &crawler.Crawl{URL: pageURL}
+	body := data
+
+	if strings.HasSuffix(filename, ".json") {
+		err = json.Unmarshal(data, crawl)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read saved crawl")
+		}
+
+		if crawl.RawData == "" {
+			return nil, errors.Errorf("saved crawl {%s} has no raw data to extract from", filename)
+		}
+		body = []byte(crawl.RawData)
+	}
+
+	if crawl.URL == "" {
+		return nil, errors.New("the url the page was fetched from is required, use -url")
+	}
+
+	logger := log.New(ioutil.Discard, "", 0)
+	err = crawler.ExtractPage(crawl, body, exes, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &extractResult{
+		URL:           crawl.URL,
+		Title:         crawl.Title,
+		Description:   crawl.Description,
+		HarvestedData: crawl.HarvestedData,
+		Validation:    crawl.Validation,
+	}, nil
+}
+
+func readGolden(filename string) (*extractResult, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var expected extractResult
+	err = json.Unmarshal(data, &expected)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read golden file {%s}", filename)
+	}
+
+	return &expected, nil
+}
+
+func writeGolden(filename string, result *extractResult) error {
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, append(out, '\n'), 0644)
+}
+
+// compareGolden checks the result against the golden file. Both are compared in their
+// json form so values such as times match however they were produced
+func compareGolden(filename string, result *extractResult) error {
+	expectedJSON, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	actualJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var expected, actual interface{}
+	err = json.Unmarshal(expectedJSON, &expected)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read golden file {%s}", filename)
+	}
+
+	err = json.Unmarshal(actualJSON, &actual)
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(expected, actual) {
+		return nil
+	}
+
+	return errors.Errorf("result does not match %s\n%s", filename, diffLines(expectedJSON, actualJSON))
+}
+
+// diffLines gives a rough line by line comparison of the expected and actual output
+func diffLines(expected, actual []byte) string {
+	exp := strings.Split(string(bytes.TrimSpace(expected)), "\n")
+	act := strings.Split(string(bytes.TrimSpace(actual)), "\n")
+
+	var out []string
+	for i := 0; i < len(exp) || i < len(act); i++ {
+		var e, a string
+		if i < len(exp) {
+			e = exp[i]
+		}
+		if i < len(act) {
+			a = act[i]
+		}
+
+		if e == a {
+			continue
+		}
+
+		if e != "" {
+			out = append(out, "- "+e)
+		}
+		if a != "" {
+			out = append(out, "+ "+a)
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samjohnduke/crawl3/crawler"
+)
+
+const testExtractModel = `{
+  "host": "news.test",
+  "extraction": [{
+    "@type": "Article",
+    "@pageMatcher": ["article"],
+    "fields": {"headline": {"type": "String", "matcher": "h1", "content": "innerHTML"}},
+    "required": ["headline"]
+  }]
+}`
+
+const testExtractPage = `<html><head><title>Front Page</title></head><body><article><h1>Hello</h1></article></body></html>`
+
+// newTestExtractDir writes a model and a page with its golden file, returning the
+// directories of the models and the fixtures
+func newTestExtractDir(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "crawl3-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models := filepath.Join(dir, "models")
+	fixtures := filepath.Join(dir, "fixtures")
+	for _, d := range []string{models, fixtures} {
+		err = os.Mkdir(d, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	crawl, err := json.Marshal(&crawler.Crawl{URL: "http://news.test/saved", RawData: testExtractPage})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		filepath.Join(models, "news.json"):             testExtractModel,
+		filepath.Join(fixtures, "front.html"):          testExtractPage,
+		filepath.Join(fixtures, "saved.crawl.json"):    string(crawl),
+		filepath.Join(fixtures, "missing.golden.json"): `{"url": "http://news.test/missing"}`,
+	}
+	for name, content := range files {
+		err = ioutil.WriteFile(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = extractCmd([]string{"-hostDir", models, "-url", "http://news.test/front", "-golden", filepath.Join(fixtures, "front.golden.json"), "-update", filepath.Join(fixtures, "front.html")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, fixtures
+}
+
+func TestExtractCmd(t *testing.T) {
+	dir, fixtures := newTestExtractDir(t)
+	defer os.RemoveAll(dir)
+	models := filepath.Join(dir, "models")
+
+	// the golden file written by -update holds the extracted record
+	golden, err := readGolden(filepath.Join(fixtures, "front.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, ok := golden.HarvestedData.([]interface{})
+	if golden.Title != "Front Page" || !ok || len(records) != 1 || !strings.Contains(toJSON(t, records), `"headline":"Hello"`) {
+		t.Fatalf("unexpected golden file %+v", golden)
+	}
+
+	changed := filepath.Join(dir, "changed.golden.json")
+	err = ioutil.WriteFile(changed, []byte(strings.Replace(toJSON(t, golden), "Hello", "Goodbye", 1)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "matches golden",
+			args: []string{"-url", "http://news.test/front", "-golden", filepath.Join(fixtures, "front.golden.json"), filepath.Join(fixtures, "front.html")},
+		},
+		{
+			name: "differs from golden",
+			args: []string{"-url", "http://news.test/front", "-golden", changed, filepath.Join(fixtures, "front.html")},
+			err:  "result does not match",
+		},
+		{
+			name: "html without url",
+			args: []string{"-golden", filepath.Join(fixtures, "front.golden.json"), filepath.Join(fixtures, "front.html")},
+			err:  "use -url",
+		},
+		{
+			name: "saved crawl keeps its url",
+			args: []string{"-golden", filepath.Join(dir, "saved.golden.json"), "-update", filepath.Join(fixtures, "saved.crawl.json")},
+		},
+		{
+			name: "fixture without a page",
+			args: []string{"-fixtures", fixtures},
+			err:  "no page found for fixture",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := extractCmd(append([]string{"-hostDir", models}, c.args...))
+			if c.err == "" && err != nil {
+				t.Errorf("unexpected error %s", err)
+			}
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("expected an error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+
+	saved, err := readGolden(filepath.Join(dir, "saved.golden.json"))
+	if err != nil || saved.URL != "http://news.test/saved" {
+		t.Errorf("expected the saved crawl to be extracted from its own url, got %+v %v", saved, err)
+	}
+
+	// every page with a golden file passes once the fixture without one is removed
+	err = os.Remove(filepath.Join(fixtures, "missing.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractCmd([]string{"-hostDir", models, "-fixtures", fixtures})
+	if err != nil {
+		t.Errorf("expected the fixtures to pass, got %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(fixtures, "front.golden.json"), []byte(strings.Replace(toJSON(t, golden), "Hello", "Goodbye", 1)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = extractCmd([]string{"-hostDir", models, "-fixtures", fixtures})
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 fixtures failed") {
+		t.Errorf("expected the changed fixture to fail, got %v", err)
+	}
+}
+
+func toJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
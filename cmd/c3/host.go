@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// hostCmd works with host model files. validate checks every model given (or every
+// model in a directory) and schema prints the JSON Schema that models must follow
+func hostCmd(args []string) error {
+	if len(args) < 1 {
+		hostUsage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "validate":
+		if len(args) < 2 {
+			hostUsage()
+			os.Exit(2)
+		}
+		return validateHosts(args[1:])
+
+	case "schema":
+		fmt.Print(shared.HostSchema)
+		return nil
+	}
+
+	hostUsage()
+	os.Exit(2)
+	return nil
+}
+
+func hostUsage() {
+	fmt.Fprintln(os.Stderr, "usage: c3 host validate <model|dir>...")
+	fmt.Fprintln(os.Stderr, "       c3 host schema")
+}
+
+func validateHosts(paths []string) error {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(p)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			switch filepath.Ext(e.Name()) {
+			case ".json", ".yaml", ".yml":
+				if !e.IsDir() {
+					files = append(files, filepath.Join(p, e.Name()))
+				}
+			}
+		}
+	}
+
+	var failed int
+	for _, f := range files {
+		_, err := shared.LoadHostFile(f)
+		if err != nil {
+			log.Println(err)
+			failed++
+			continue
+		}
+
+		log.Printf("ok   %s", f)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d models are invalid", failed, len(files))
+	}
+
+	return nil
+}
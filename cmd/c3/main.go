@@ -1,7 +1,68 @@
 package main
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// A command is a single c3 sub command. It is given the arguments that follow its name
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"extract": {
+		usage: "run a host model against a saved page and compare it to golden files",
+		run:   extractCmd,
+	},
+	"host": {
+		usage: "validate host models or print the host model schema",
+		run:   hostCmd,
+	},
+	"replay": {
+		usage: "run archived pages through the host models without crawling them again",
+		run:   replayCmd,
+	},
+	"run": {
+		usage: "run the crawler, schedular and aggregator in a single process",
+		run:   runCmd,
+	},
+}
 
 func main() {
-	log.Println("Hello World!")
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(os.Args[2:])
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: c3 <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
 }
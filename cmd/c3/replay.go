@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+	"github.com/samjohnduke/crawl3/crawler"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// replayCmd runs archived pages through the current host models without fetching them
+// again. The regenerated crawls are written as json lines to stdout, to the files of
+// -out, or to the aggregator over nats
+func replayCmd(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	hostDir := fs.String("hostDir", "../models", "The directory that stores the models")
+	hosts := fs.String("host", "", "Only replay the pages of these comma separated hosts")
+	from := fs.String("from", "", "Only replay pages fetched from this date, as 2006-01-02 or RFC 3339")
+	to := fs.String("to", "", "Only replay pages fetched before this date, as 2006-01-02 or RFC 3339")
+	out := fs.String("out", "", "Write the crawls to rotated JSON Lines files in this directory")
+	natsURL := fs.String("nats", "", "Publish the crawls to the aggregator on this nats server")
+	namespace := fs.String("namespace", "", "The namespace of the nats subjects to publish on")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: c3 replay [flags] <warc|jsonl file, directory or glob>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	opts := crawler.ReplayOpts{
+		Paths:  fs.Args(),
+		Logger: log.New(os.Stderr, "", log.LstdFlags),
+	}
+
+	if *hosts != "" {
+		opts.Hosts = strings.Split(*hosts, ",")
+	}
+
+	var err error
+	opts.From, err = parseReplayDate(*from)
+	if err != nil {
+		return err
+	}
+	opts.To, err = parseReplayDate(*to)
+	if err != nil {
+		return err
+	}
+
+	models, err := shared.LoadHostsFromDir(*hostDir)
+	if err != nil {
+		return err
+	}
+	opts.Extractors = crawler.NewHostExtractors(models)
+
+	switch {
+	case *out != "":
+		publisher, err := crawler.NewPublisherFile(crawler.FileOpts{Dir: *out})
+		if err != nil {
+			return err
+		}
+		defer publisher.Close()
+		opts.Publisher = publisher
+
+	case *natsURL != "":
+		nc, err := nats.Connect(*natsURL)
+		if err != nil {
+			return err
+		}
+		defer nc.Close()
+		opts.Publisher = crawler.NewPublisherNats(nc, crawler.NatsOpts{Namespace: *namespace})
+
+		// publishing does not wait for the server, so flush before closing
+		defer nc.Flush()
+
+	default:
+		opts.Publisher = &jsonPublisher{enc: json.NewEncoder(os.Stdout)}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	stats, err := crawler.Replay(ctx, opts)
+	log.Printf("replayed %d of %d pages, %d skipped, %d failed", stats.Replayed, stats.Read, stats.Skipped, stats.Failed)
+	return err
+}
+
+// parseReplayDate reads a date or a time, leaving it zero if empty
+func parseReplayDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, errors.Errorf("invalid date {%s}, use 2006-01-02 or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// jsonPublisher writes every crawl as a line of json
+type jsonPublisher struct {
+	enc *json.Encoder
+}
+
+func (p *jsonPublisher) Publish(c *crawler.Crawl) error {
+	return p.enc.Encode(c)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/arangodb/go-driver/http"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/samjohnduke/crawl3/aggregator"
+	"github.com/samjohnduke/crawl3/crawler"
+	"github.com/samjohnduke/crawl3/schedular"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// runOpts configures a crawl3 deployment running inside a single process
+type runOpts struct {
+	hostDir    string
+	workers    int
+	reload     time.Duration
+	crawlDelay time.Duration
+	sqlDriver  string
+	sqlURL     string
+	arango     string
+	arangoUser string
+	arangoPass string
+	grpcAddr   string
+	httpAddr   string
+	deny       string
+	allow      string
+	logger     *log.Logger
+}
+
+// localRun is the crawler, schedular and aggregator wired together in memory. Crawls
+// are requested through a local client and results are passed on a local bus, so no
+// message broker is needed
+type localRun struct {
+	bus        *crawler.LocalBus
+	service    crawler.Service
+	sched      schedular.Service
+	hosts      *schedular.HostSet
+	store      schedular.Store
+	watcher    *shared.HostWatcher
+	transports []crawler.Transport
+	aggregator *aggregator.Aggregator
+	listeners  []crawler.Listener
+	db         *gorm.DB
+	quit       chan struct{}
+}
+
+// runCmd runs every part of crawl3 in one process until it is interrupted
+func runCmd(args []string) error {
+	var opts runOpts
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.StringVar(&opts.hostDir, "hostDir", "../models", "The directory that stores the models")
+	fs.IntVar(&opts.workers, "wc", 40, "The number of workers to spin up")
+	fs.DurationVar(&opts.reload, "reload", 5*time.Second, "How often to check the model directory for changes")
+	fs.DurationVar(&opts.crawlDelay, "delay", 2*time.Second, "How long to wait between crawls of the same host")
+	fs.StringVar(&opts.sqlDriver, "sqldriver", "", "The sql driver for storing visits, they are kept in memory when empty")
+	fs.StringVar(&opts.sqlURL, "sqlurl", "./dev.db", "the sql url use to connect to")
+	fs.StringVar(&opts.arango, "arango", "", "The arango endpoint to aggregate crawls into, crawls are only logged when empty")
+	fs.StringVar(&opts.arangoUser, "arangoUser", "", "The arango user")
+	fs.StringVar(&opts.arangoPass, "arangoPass", "", "The arango password")
+	fs.StringVar(&opts.grpcAddr, "grpc", "", "The address to also serve the crawl service over gRPC on")
+	fs.StringVar(&opts.httpAddr, "http", "", "The address to also serve the crawl service over http on")
+	fs.StringVar(&opts.deny, "deny-networks", strings.Join(crawler.DefaultDeniedNetworks, ","), "A comma separated list of networks pages may not be fetched from, every network is allowed when empty")
+	fs.StringVar(&opts.allow, "allow-networks", "", "A comma separated list of networks pages may be fetched from even if they are denied")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: c3 run [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	opts.logger = log.New(os.Stdout, "", log.LstdFlags|log.Lshortfile)
+
+	run, err := startRun(opts)
+	if err != nil {
+		return err
+	}
+
+	if run.aggregator == nil {
+		l := run.bus.Listener()
+		run.listeners = append(run.listeners, l)
+		go logCrawls(l.Listen(), os.Stdout)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	<-sigs
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return run.Stop(ctx)
+}
+
+// startRun wires the parts of crawl3 together and starts them
+func startRun(opts runOpts) (*localRun, error) {
+	run := &localRun{
+		bus:  crawler.NewLocalBus(),
+		quit: make(chan struct{}),
+	}
+
+	run.watcher = shared.NewHostWatcher(opts.hostDir, opts.reload, opts.logger)
+	hosts, err := run.watcher.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	execs := crawler.NewReloadableExtractors(crawler.NewHostExtractors(hosts))
+
+	network, err := crawler.NewNetworkPolicy(crawler.NetworkOpts{
+		Deny:  strings.Split(opts.deny, ","),
+		Allow: strings.Split(opts.allow, ","),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	run.service, err = crawler.New(crawler.ServiceOpts{
+		Logger:      opts.logger,
+		WorkerCount: int64(opts.workers),
+		Publisher:   run.bus,
+		Extractors:  execs,
+		Network:     network,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.grpcAddr != "" {
+		run.transports = append(run.transports, crawler.NewTransportGRPC(opts.grpcAddr, run.service))
+	}
+	if opts.httpAddr != "" {
+		run.transports = append(run.transports, crawler.NewTransportHTTP(opts.httpAddr, run.service, crawler.HTTPOpts{Network: network}))
+	}
+	for _, t := range run.transports {
+		err = t.Start(context.Background())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.sqlDriver == "" {
+		run.store = schedular.NewMemoryStore()
+	} else {
+		run.db, err = gorm.Open(opts.sqlDriver, opts.sqlURL)
+		if err != nil {
+			return nil, err
+		}
+
+		run.store, err = schedular.NewSQLGormStore(run.db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	run.sched, err = schedular.NewSchedular(schedular.Opts{
+		Client:         crawler.NewClientLocal(run.service),
+		CrawlDelay:     opts.crawlDelay,
+		Instrument:     crawler.NewInstrumentationMem(),
+		Logger:         opts.logger,
+		AllowedDomains: schedular.AllowedDomains(hosts),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	run.hosts = schedular.NewHostSet(run.sched, run.store, opts.logger)
+	run.sched.OnHarvest(func(c *crawler.Crawl) error {
+		_, err := run.store.Visit(c.URL, c.PageHash)
+		if err != nil {
+			opts.logger.Println(err)
+			return schedular.ErrCancelSchedule
+		}
+
+		run.hosts.Schedule(c)
+		return schedular.ErrCancelSchedule
+	})
+
+	if opts.arango != "" {
+		err = run.startAggregator(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	run.sched.Start()
+
+	err = run.hosts.Update(context.Background(), hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	run.watcher.OnChange(func(hosts []shared.Host) {
+		execs.Swap(crawler.NewHostExtractors(hosts))
+
+		err := run.hosts.Update(context.Background(), hosts)
+		if err != nil {
+			opts.logger.Println(err)
+		}
+	})
+	run.watcher.Start()
+
+	go run.reschedule()
+
+	return run, nil
+}
+
+func (run *localRun) startAggregator(opts runOpts) error {
+	conn, err := http.NewConnection(http.ConnectionConfig{
+		Endpoints: []string{opts.arango},
+	})
+	if err != nil {
+		return err
+	}
+
+	aql, err := driver.NewClient(driver.ClientConfig{
+		Connection:     conn,
+		Authentication: driver.BasicAuthentication(opts.arangoUser, opts.arangoPass),
+	})
+	if err != nil {
+		return err
+	}
+
+	l := run.bus.Listener()
+	run.listeners = append(run.listeners, l)
+
+	run.aggregator, err = aggregator.New(aggregator.Opts{
+		Listener:     l.Listen(),
+		ArangoClient: aql,
+	})
+	if err != nil {
+		return err
+	}
+
+	return run.aggregator.Start(context.Background())
+}
+
+// reschedule pushes urls the store has queued for later back into the schedular
+func (run *localRun) reschedule() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			run.store.Reschedule(run.sched)
+		case <-run.quit:
+			return
+		}
+	}
+}
+
+// Stop shuts every part down, the schedular first so no new crawls are started
+func (run *localRun) Stop(ctx context.Context) error {
+	close(run.quit)
+	run.watcher.Stop()
+
+	err := run.sched.Stop(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = run.hosts.Stop(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range run.transports {
+		err = t.Stop(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, l := range run.listeners {
+		l.Close()
+	}
+
+	if run.aggregator != nil {
+		err = run.aggregator.Stop(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if run.db != nil {
+		return run.db.Close()
+	}
+	return nil
+}
+
+// logCrawls prints a line for every crawl when there is no aggregator to store them
+func logCrawls(crawls chan *crawler.Crawl, w io.Writer) {
+	for c := range crawls {
+		if c.Error != "" {
+			fmt.Fprintf(w, "failed %s %s\n", c.URL, c.Error)
+			continue
+		}
+		fmt.Fprintf(w, "crawled %s %q\n", c.URL, c.Title)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samjohnduke/crawl3/crawler"
+)
+
+// newTestSite serves a feed with two articles for the rss schedular to find
+func newTestSite() *httptest.Server {
+	mux := http.NewServeMux()
+	var site *httptest.Server
+
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test</title>
+<item><title>One</title><link>%[1]s/article/1</link></item>
+<item><title>Two</title><link>%[1]s/article/2</link></item>
+</channel></rss>`, site.URL)
+	})
+
+	mux.HandleFunc("/article/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>Article %[1]s</title></head><body><h1>Headline %[1]s</h1></body></html>`, filepath.Base(r.URL.Path))
+	})
+
+	site = httptest.NewServer(mux)
+	return site
+}
+
+// The whole pipeline runs in one process: the schedular reads the feed, the crawler
+// fetches and extracts the articles and the results arrive on the local bus
+func TestRunEndToEnd(t *testing.T) {
+	site := newTestSite()
+	defer site.Close()
+
+	u, _ := url.Parse(site.URL)
+
+	dir, err := ioutil.TempDir("", "crawl3-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	model := fmt.Sprintf(`{
+  "host": %q,
+  "alias": [%q],
+  "schedular": [{"type": "RSS", "data": {"feeds": [%q]}}],
+  "extraction": [{
+    "@type": "Article",
+    "@pageMatcher": ["body"],
+    "fields": {"headline": {"type": "String", "matcher": "h1", "content": "innerHTML"}}
+  }]
+}`, u.Host, u.Hostname(), site.URL+"/feed.xml")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "test.json"), []byte(model), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := startRun(runOpts{
+		hostDir:    dir,
+		workers:    2,
+		reload:     time.Hour,
+		crawlDelay: 10 * time.Millisecond,
+		deny:       strings.Join(crawler.DefaultDeniedNetworks, ","),
+		allow:      "127.0.0.1/32",
+		logger:     log.New(ioutil.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := run.bus.Listener()
+	crawls := l.Listen()
+
+	found := make(map[string]*crawler.Crawl)
+	timeout := time.After(10 * time.Second)
+	for len(found) < 2 {
+		select {
+		case c := <-crawls:
+			found[c.URL] = c
+		case <-timeout:
+			t.Fatalf("timed out with crawls of %v", found)
+		}
+	}
+
+	for _, n := range []string{"1", "2"} {
+		c, ok := found[site.URL+"/article/"+n]
+		if !ok {
+			t.Errorf("article %s was not crawled", n)
+			continue
+		}
+
+		if c.Title != "Article "+n {
+			t.Errorf("unexpected title %q", c.Title)
+		}
+
+		// each extractor harvests a list of records
+		data, ok := c.HarvestedData.([]interface{})
+		if !ok || len(data) != 1 {
+			t.Errorf("unexpected harvested data %#v", c.HarvestedData)
+			continue
+		}
+
+		records, ok := data[0].([]interface{})
+		if !ok || len(records) != 1 {
+			t.Errorf("unexpected records %#v", data[0])
+			continue
+		}
+
+		if record, ok := records[0].(map[string]interface{}); !ok || record["headline"] != "Headline "+n {
+			t.Errorf("unexpected record %#v", records[0])
+		}
+	}
+
+	if !run.store.HasVisited(site.URL + "/article/1") {
+		t.Error("expected the store to record the visit")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	l.Close()
+	err = run.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
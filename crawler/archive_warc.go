@@ -0,0 +1,443 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// The defaults used for a WARCOpts field that is not set
+const (
+	DefaultWARCPrefix      = "crawl3"
+	DefaultWARCMaxBytes    = 1 << 30
+	DefaultWARCRotateEvery = 24 * time.Hour
+)
+
+// The extensions of WARC files. The file being written has warcActiveSuffix on the end
+// until it is rotated, as other web archive tools expect
+const (
+	warcExt          = ".warc"
+	warcGzipExt      = ".warc.gz"
+	warcActiveSuffix = ".open"
+)
+
+const warcRevisitProfile = "http://netpreserve.org/warc/1.0/revisit/identical-payload-digest"
+
+// A Fetch is a request made for a crawl and the response it got
+type Fetch struct {
+	Request     *http.Request
+	RequestBody []byte
+	Response    *http.Response
+	Body        []byte
+
+	// Time is when the request was sent
+	Time time.Time
+}
+
+// An Archiver keeps a record of every page the workers fetch
+type Archiver interface {
+	Archive(f *Fetch) error
+}
+
+// nullArchiver is used when the service is not given an archiver and keeps nothing
+type nullArchiver struct{}
+
+func (nullArchiver) Archive(f *Fetch) error { return nil }
+
+// WARCOpts configures the WARC writer
+type WARCOpts struct {
+	// Dir is the directory the files are written to, it is created if needed
+	Dir string
+
+	// Prefix starts the name of every file, which goes on with the time the file was
+	// started and a serial number
+	Prefix string
+
+	// MaxBytes is how big a file can get before starting the next one
+	MaxBytes int64
+
+	// RotateEvery is how long a file is written to before starting the next one
+	RotateEvery time.Duration
+
+	// Compress gzips each record on its own, giving a .warc.gz file
+	Compress bool
+}
+
+func (o WARCOpts) withDefaults() WARCOpts {
+	if o.Prefix == "" {
+		o.Prefix = DefaultWARCPrefix
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultWARCMaxBytes
+	}
+	if o.RotateEvery <= 0 {
+		o.RotateEvery = DefaultWARCRotateEvery
+	}
+	return o
+}
+
+// warcOriginal is the response record a revisit refers to
+type warcOriginal struct {
+	id   string
+	uri  string
+	date string
+}
+
+// WARCWriter archives fetches as request and response records in WARC files. The payload
+// digest of a response is the sha256 of its body, the same as Crawl.PageHash, and a
+// response whose payload has already been archived in the current file is written as a
+// revisit record referring to the first one. The payloads are forgotten as each file is
+// started, so a revisit never refers to another file
+type WARCWriter struct {
+	opts WARCOpts
+
+	file     *os.File
+	buf      *bufio.Writer
+	name     string
+	infoID   string
+	written  int64
+	started  time.Time
+	serial   int
+	closed   bool
+	archived map[string]warcOriginal
+	mu       sync.Mutex
+}
+
+// NewWARCWriter creates a writer for the directory of the options. The first file is
+// only started when the first fetch is archived
+func NewWARCWriter(opts WARCOpts) (*WARCWriter, error) {
+	opts = opts.withDefaults()
+
+	if opts.Dir == "" {
+		return nil, NewError(CodeInvalidRequest, "the WARC writer needs a directory")
+	}
+
+	err := os.MkdirAll(opts.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WARCWriter{opts: opts}, nil
+}
+
+// Archive writes the request and response records of a fetch
+func (w *WARCWriter) Archive(f *Fetch) error {
+	if f.Request == nil || f.Response == nil {
+		return NewError(CodeInvalidRequest, "a fetch needs a request and a response")
+	}
+
+	date := f.Time.UTC().Format(time.RFC3339)
+	uri := f.Request.URL.String()
+	hash := sha256.Sum256(f.Body)
+	pageHash := hex.EncodeToString(hash[:])
+	payloadDigest := warcDigest(hash[:])
+
+	responseID, err := warcRecordID()
+	if err != nil {
+		return err
+	}
+	requestID, err := warcRecordID()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return NewError(CodeUnavailable, "WARC writer is closed")
+	}
+
+	if w.file != nil && (w.written >= w.opts.MaxBytes || time.Since(w.started) >= w.opts.RotateEvery) {
+		err = w.finish()
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.file == nil {
+		err = w.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	var response warcRecord
+	head := httpResponseHead(f.Response)
+	if original, ok := w.archived[pageHash]; ok {
+		response = warcRecord{
+			headers: [][2]string{
+				{"WARC-Type", "revisit"},
+				{"WARC-Record-ID", responseID},
+				{"WARC-Date", date},
+				{"WARC-Target-URI", uri},
+				{"WARC-Warcinfo-ID", w.infoID},
+				{"WARC-Profile", warcRevisitProfile},
+				{"WARC-Refers-To", original.id},
+				{"WARC-Refers-To-Target-URI", original.uri},
+				{"WARC-Refers-To-Date", original.date},
+				{"WARC-Payload-Digest", payloadDigest},
+				{"Content-Type", "application/http;msgtype=response"},
+			},
+			block: head,
+		}
+	} else {
+		block := append(head, f.Body...)
+		response = warcRecord{
+			headers: [][2]string{
+				{"WARC-Type", "response"},
+				{"WARC-Record-ID", responseID},
+				{"WARC-Date", date},
+				{"WARC-Target-URI", uri},
+				{"WARC-Warcinfo-ID", w.infoID},
+				{"WARC-Payload-Digest", payloadDigest},
+				{"Content-Type", "application/http;msgtype=response"},
+			},
+			block: block,
+		}
+	}
+
+	request := warcRecord{
+		headers: [][2]string{
+			{"WARC-Type", "request"},
+			{"WARC-Record-ID", requestID},
+			{"WARC-Date", date},
+			{"WARC-Target-URI", uri},
+			{"WARC-Warcinfo-ID", w.infoID},
+			{"WARC-Concurrent-To", responseID},
+			{"Content-Type", "application/http;msgtype=request"},
+		},
+		block: append(httpRequestHead(f.Request), f.RequestBody...),
+	}
+
+	err = w.write(response)
+	if err != nil {
+		return err
+	}
+	err = w.write(request)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := w.archived[pageHash]; !ok {
+		w.archived[pageHash] = warcOriginal{id: responseID, uri: uri, date: date}
+	}
+	return nil
+}
+
+// Rotate finishes the current file, the next fetch starts a new one
+func (w *WARCWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.finish()
+}
+
+// Close finishes the current file and stops archiving
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	return w.finish()
+}
+
+// open starts a file with a warcinfo record describing the crawler
+func (w *WARCWriter) open() error {
+	ext := warcExt
+	if w.opts.Compress {
+		ext = warcGzipExt
+	}
+
+	w.serial++
+	w.started = time.Now()
+	base := fmt.Sprintf("%s-%s-%05d%s", w.opts.Prefix, w.started.UTC().Format("20060102150405"), w.serial, ext)
+	w.name = filepath.Join(w.opts.Dir, base)
+
+	file, err := os.OpenFile(w.name+warcActiveSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.buf = bufio.NewWriter(file)
+	w.written = 0
+	w.archived = make(map[string]warcOriginal)
+
+	w.infoID, err = warcRecordID()
+	if err != nil {
+		return err
+	}
+
+	return w.write(warcRecord{
+		headers: [][2]string{
+			{"WARC-Type", "warcinfo"},
+			{"WARC-Record-ID", w.infoID},
+			{"WARC-Date", w.started.UTC().Format(time.RFC3339)},
+			{"WARC-Filename", base},
+			{"Content-Type", "application/warc-fields"},
+		},
+		block: []byte("software: crawl3\r\nformat: WARC File Format 1.0\r\n"),
+	})
+}
+
+// finish closes the current file and gives it its final name
+func (w *WARCWriter) finish() error {
+	file := w.file
+	w.file = nil
+
+	err := w.buf.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+
+	cerr := file.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(w.name+warcActiveSuffix, w.name)
+}
+
+// write adds a record to the current file, in a gzip member of its own if compressed.
+// Each record is flushed so a crash loses at most the one being written
+func (w *WARCWriter) write(r warcRecord) error {
+	var out io.Writer = &countWriter{w: w.buf, n: &w.written}
+
+	var gz *gzip.Writer
+	if w.opts.Compress {
+		gz = gzip.NewWriter(out)
+		out = gz
+	}
+
+	err := r.writeTo(out)
+	if err != nil {
+		return err
+	}
+
+	if gz != nil {
+		err = gz.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return w.buf.Flush()
+}
+
+// A warcRecord is the named fields of a record and its block. WARC-Block-Digest and
+// Content-Length are added when it is written
+type warcRecord struct {
+	headers [][2]string
+	block   []byte
+}
+
+func (r warcRecord) writeTo(out io.Writer) error {
+	hash := sha256.Sum256(r.block)
+
+	var b bytes.Buffer
+	b.WriteString("WARC/1.0\r\n")
+	for _, h := range r.headers {
+		b.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	b.WriteString("WARC-Block-Digest: " + warcDigest(hash[:]) + "\r\n")
+	b.WriteString("Content-Length: " + strconv.Itoa(len(r.block)) + "\r\n\r\n")
+
+	_, err := out.Write(b.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(r.block)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, "\r\n\r\n")
+	return err
+}
+
+// httpRequestHead is the request line and headers of a request as sent
+func httpRequestHead(req *http.Request) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	b.WriteString("Host: " + host + "\r\n")
+
+	req.Header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// httpResponseHead is the status line and headers of a response. The body is archived as
+// it was read, after any transfer or content encoding was taken off by the client
+func httpResponseHead(resp *http.Response) []byte {
+	proto := resp.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+
+	status := resp.Status
+	if status == "" {
+		status = strconv.Itoa(resp.StatusCode) + " " + http.StatusText(resp.StatusCode)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s\r\n", proto, status)
+	resp.Header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+func warcDigest(sum []byte) string {
+	return "sha256:" + base32.StdEncoding.EncodeToString(sum)
+}
+
+func warcRecordID() (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	return "<urn:uuid:" + id.String() + ">", nil
+}
+
+// countWriter adds the number of bytes written to n
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// isWARCFile reports whether the file is a finished WARC file
+func isWARCFile(name string) bool {
+	return strings.HasSuffix(name, warcExt) || strings.HasSuffix(name, warcGzipExt)
+}
@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A WARCRecord is a record read from a WARC file
+type WARCRecord struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+
+	// Offset is where to start reading the file to find the record again. In a
+	// compressed file it is the start of the gzip member holding the record
+	Offset int64
+}
+
+// Type is the WARC-Type of the record, such as response or revisit
+func (r *WARCRecord) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+// ID is the WARC-Record-ID of the record, including its angle brackets
+func (r *WARCRecord) ID() string {
+	return r.Header.Get("WARC-Record-ID")
+}
+
+// TargetURI is the url the record was captured from
+func (r *WARCRecord) TargetURI() string {
+	return r.Header.Get("WARC-Target-URI")
+}
+
+// Date is when the record was captured
+func (r *WARCRecord) Date() time.Time {
+	t, _ := time.Parse(time.RFC3339, r.Header.Get("WARC-Date"))
+	return t
+}
+
+// HTTPResponse parses the http response held by a response or revisit record and
+// returns it with its body, decoded if it was gzipped
+func (r *WARCRecord) HTTPResponse() (*http.Response, []byte, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && len(body) > 0 {
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err == nil {
+			decoded, err := ioutil.ReadAll(gz)
+			if err == nil {
+				body = decoded
+			}
+		}
+	}
+
+	return resp, body, nil
+}
+
+// WARCReader reads the records of a WARC file, compressed or not
+type WARCReader struct {
+	cr          *countReader
+	gz          *gzip.Reader
+	br          *bufio.Reader
+	memberStart int64
+}
+
+// NewWARCReader reads records from r, which is read as gzip if it starts like it
+func NewWARCReader(r io.Reader) (*WARCReader, error) {
+	cr := &countReader{r: bufio.NewReader(r)}
+	w := &WARCReader{cr: cr}
+
+	magic, err := cr.r.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		// read each member on its own so the offset of each one is known
+		w.gz, err = gzip.NewReader(cr)
+		if err != nil {
+			return nil, err
+		}
+		w.gz.Multistream(false)
+		w.br = bufio.NewReader(w.gz)
+	} else {
+		w.br = bufio.NewReader(cr)
+	}
+
+	return w, nil
+}
+
+// Next returns the next record, or io.EOF once there are none left
+func (w *WARCReader) Next() (*WARCRecord, error) {
+	for {
+		offset := w.offset()
+
+		line, err := w.br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			if w.gz == nil {
+				return nil, io.EOF
+			}
+
+			w.memberStart = w.cr.n
+			err = w.gz.Reset(w.cr)
+			if err != nil {
+				return nil, err
+			}
+			w.gz.Multistream(false)
+			w.br.Reset(w.gz)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "WARC/") {
+			return nil, fmt.Errorf("no WARC record at offset %d", offset)
+		}
+
+		header, err := textproto.NewReader(w.br).ReadMIMEHeader()
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("WARC record at offset %d has an invalid length", offset)
+		}
+
+		block := make([]byte, length)
+		_, err = io.ReadFull(w.br, block)
+		if err != nil {
+			return nil, err
+		}
+
+		return &WARCRecord{Header: header, Block: block, Offset: offset}, nil
+	}
+}
+
+func (w *WARCReader) offset() int64 {
+	if w.gz != nil {
+		return w.memberStart
+	}
+	return w.cr.n - int64(w.br.Buffered())
+}
+
+// countReader counts the bytes read through it. It is a byte reader so gzip reads no
+// further than the end of each member
+type countReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
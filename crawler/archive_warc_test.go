@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base32"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWARCArchive(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	dir, err := ioutil.TempDir("", "crawl3-warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writer, err := NewWARCWriter(WARCOpts{Dir: dir, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, ServiceOpts{Archiver: writer})
+
+	// the same page twice, so the second response is a revisit of the first
+	var c *Crawl
+	for i := 0; i < 2; i++ {
+		c, err = service.Crawl(context.Background(), page.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], ".warc.gz") {
+		t.Fatalf("expected one finished warc file, got %v", files)
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warc := string(data)
+
+	for typ, n := range map[string]int{"warcinfo": 1, "request": 2, "response": 1, "revisit": 1} {
+		if got := strings.Count(warc, "WARC-Type: "+typ+"\r\n"); got != n {
+			t.Errorf("expected %d %s records, got %d", n, typ, got)
+		}
+	}
+
+	sum, _ := hex.DecodeString(c.PageHash)
+	digest := "WARC-Payload-Digest: sha256:" + base32.StdEncoding.EncodeToString(sum)
+	if strings.Count(warc, digest) != 2 {
+		t.Errorf("expected the payload digest to match the page hash, got %s", warc)
+	}
+
+	if !strings.Contains(warc, "WARC-Target-URI: "+page.URL) || !strings.Contains(warc, "HTTP/1.1 200 OK") {
+		t.Errorf("expected the fetch of %s, got %s", page.URL, warc)
+	}
+}
+
+func TestWARCRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl3-warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// any record is bigger than a byte so each fetch starts a new file
+	writer, err := NewWARCWriter(WARCOpts{Dir: dir, MaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse("https://example.com/")
+	for i := 0; i < 3; i++ {
+		err := writer.Archive(&Fetch{
+			Request:  &http.Request{Method: "GET", URL: u, Header: http.Header{}},
+			Response: &http.Response{StatusCode: 200, Header: http.Header{}},
+			Body:     []byte("page"),
+			Time:     time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	open, _ := filepath.Glob(filepath.Join(dir, "*.warc.open"))
+	if len(open) != 1 {
+		t.Errorf("expected the current file to still be open, got %v", open)
+	}
+
+	writer.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc"))
+	if len(files) != 3 {
+		t.Errorf("expected 3 files, got %v", files)
+	}
+
+	// the same payload is archived in full in every file rather than referring to
+	// a record in another one
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "WARC-Type: response\r\n") || strings.Contains(string(data), "WARC-Type: revisit\r\n") {
+			t.Errorf("expected %s to hold the response itself, got %s", name, data)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// runBatch crawls a batch through the client and waits for the summary
+func runBatch(t *testing.T, client Client, items []BatchItem) (string, map[string]*BatchResult, *BatchSummary) {
+	var mu sync.Mutex
+	results := map[string]*BatchResult{}
+	done := make(chan *BatchSummary, 1)
+
+	batchID, err := client.CrawlBatch(context.Background(), items, func(r *BatchResult) {
+		mu.Lock()
+		results[r.ItemID] = r
+		mu.Unlock()
+	}, func(s *BatchSummary) {
+		done <- s
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case s := <-done:
+		mu.Lock()
+		defer mu.Unlock()
+		return batchID, results, s
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the batch")
+	}
+	return "", nil, nil
+}
+
+func TestCrawlBatch(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	ser := RunDefaultServer()
+	defer ser.Shutdown()
+
+	nc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", DefaultTestOptions.Host, DefaultTestOptions.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	service := newTestService(t, ServiceOpts{})
+
+	natsTransport := NewTransportNats(nc, service)
+	err = natsTransport.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer natsTransport.Stop(context.Background())
+
+	httpServer := httptest.NewServer(NewTransportHTTP("", service, HTTPOpts{}).(http.Handler))
+	defer httpServer.Close()
+
+	grpcClient, stop := newTestGRPCClient(t, service)
+	defer stop()
+
+	clients := map[string]Client{
+		"local": NewClientLocal(service),
+		"http":  NewClientHTTP(httpServer.URL, nil),
+		"grpc":  grpcClient,
+		"nats":  NewClientNats(nc),
+	}
+
+	items := []BatchItem{
+		{ID: "a", URL: page.URL},
+		{ID: "b", URL: page.URL + "/other", Options: &CrawlOptions{Timeout: 5 * time.Second}},
+		{ID: "c", URL: ""},
+	}
+
+	for name, client := range clients {
+		batchID, results, summary := runBatch(t, client, items)
+
+		if batchID == "" || summary.BatchID != batchID {
+			t.Errorf("%s: expected the summary of batch %q, got %+v", name, batchID, summary)
+		}
+
+		if summary.Total != 3 || summary.Succeeded != 2 || summary.Failed != 1 {
+			t.Errorf("%s: unexpected summary %+v", name, summary)
+		}
+
+		if len(results) != 3 {
+			t.Fatalf("%s: expected 3 results, got %d", name, len(results))
+		}
+
+		for _, id := range []string{"a", "b"} {
+			r := results[id]
+			if r.Failed() || r.Crawl == nil || r.Crawl.Title != "Test Page" || r.BatchID != batchID {
+				t.Errorf("%s: unexpected result for %s %+v", name, id, r)
+			}
+		}
+
+		if r := results["c"]; !r.Failed() || r.Error == nil || r.Error.Code != CodeInvalidRequest {
+			t.Errorf("%s: expected an invalid request, got %+v", name, r)
+		}
+	}
+}
+
+func TestHTTPTransportBatchBadRequest(t *testing.T) {
+	server := httptest.NewServer(NewTransportHTTP("", newTestService(t, ServiceOpts{}), HTTPOpts{}).(http.Handler))
+	defer server.Close()
+
+	client := NewClientHTTP(server.URL, nil)
+	_, err := client.CrawlBatch(context.Background(), nil, nil, nil)
+	if e, ok := err.(*Error); !ok || e.Code != CodeInvalidRequest {
+		t.Errorf("expected an invalid request, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import "sync"
+
+// LocalBus passes completed crawls from a publisher to listeners in the same process.
+// Like the nats listener each listener buffers up to 100 crawls, after which publishing
+// waits for the listener to catch up
+type LocalBus struct {
+	listeners map[*listenerLocal]struct{}
+	mu        sync.RWMutex
+}
+
+type listenerLocal struct {
+	bus  *LocalBus
+	c    chan *Crawl
+	done chan struct{}
+	once sync.Once
+	mu   sync.RWMutex
+}
+
+// NewLocalBus creates a bus with no listeners
+func NewLocalBus() *LocalBus {
+	return &LocalBus{
+		listeners: make(map[*listenerLocal]struct{}),
+	}
+}
+
+// Publish hands a completed crawl to every listener
+func (b *LocalBus) Publish(c *Crawl) error {
+	b.mu.RLock()
+	listeners := make([]*listenerLocal, 0, len(b.listeners))
+	for l := range b.listeners {
+		listeners = append(listeners, l)
+	}
+	b.mu.RUnlock()
+
+	for _, l := range listeners {
+		l.send(c)
+	}
+
+	return nil
+}
+
+// Listener creates a listener for the crawls published on the bus
+func (b *LocalBus) Listener() Listener {
+	return &listenerLocal{
+		bus:  b,
+		c:    make(chan *Crawl, 100),
+		done: make(chan struct{}),
+	}
+}
+
+// Listen starts receiving crawls from the bus
+func (l *listenerLocal) Listen() chan *Crawl {
+	l.bus.mu.Lock()
+	l.bus.listeners[l] = struct{}{}
+	l.bus.mu.Unlock()
+
+	return l.c
+}
+
+// Close stops receiving crawls and closes the channel
+func (l *listenerLocal) Close() error {
+	l.once.Do(func() {
+		l.bus.mu.Lock()
+		delete(l.bus.listeners, l)
+		l.bus.mu.Unlock()
+
+		// unblock any publish waiting on the channel before closing it
+		close(l.done)
+		l.mu.Lock()
+		close(l.c)
+		l.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *listenerLocal) send(c *Crawl) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	select {
+	case <-l.done:
+		return
+	default:
+	}
+
+	select {
+	case l.c <- c:
+	case <-l.done:
+	}
+}
@@ -0,0 +1,80 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalBus(t *testing.T) {
+	bus := NewLocalBus()
+
+	first := bus.Listener()
+	second := bus.Listener()
+	a, b := first.Listen(), second.Listen()
+
+	err := bus.Publish(&Crawl{ID: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []chan *Crawl{a, b} {
+		select {
+		case crawl := <-c:
+			if crawl.ID != "one" {
+				t.Errorf("unexpected crawl %+v", crawl)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the crawl")
+		}
+	}
+
+	// a full listener must not stop the others being closed or published to
+	for i := 0; i < 101; i++ {
+		go bus.Publish(&Crawl{ID: "more"})
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	first.Close()
+	second.Close()
+
+	err = bus.Publish(&Crawl{ID: "after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalClient(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	bus := NewLocalBus()
+	listener := bus.Listener()
+	crawls := listener.Listen()
+	defer listener.Close()
+
+	service := newTestService(t, ServiceOpts{Publisher: bus})
+	client := NewClientLocal(service)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := client.Crawl(ctx, page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-crawls:
+		if c.ID != result.ID || c.Title != "Test Page" {
+			t.Errorf("unexpected published crawl %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the published crawl")
+	}
+
+	_, err = client.CrawlProgress(ctx, "not-a-crawl")
+	if err != ErrCrawlNotFound {
+		t.Errorf("expected crawl not found, got %v", err)
+	}
+}
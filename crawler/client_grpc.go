@@ -0,0 +1,245 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"log"
+	"strconv"
+
+	"github.com/samjohnduke/crawl3/crawler/crawlerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// A GRPCClient is a Client for the service served over gRPC, which can also stream the
+// lifecycle of crawls as they happen
+type GRPCClient interface {
+	Client
+
+	// Watch crawls a url and calls fn with each event of the crawl until it finishes
+	Watch(ctx context.Context, url string, fn func(*CrawlEvent)) error
+
+	// CrawlStream crawls every url over a single stream and calls fn with the events
+	// of each crawl. The RequestID of an event is the index of its url
+	CrawlStream(ctx context.Context, urls []string, fn func(*CrawlEvent)) error
+}
+
+type clientGRPC struct {
+	client crawlerpb.CrawlServiceClient
+}
+
+// NewClientGRPC creates a client for the service over a gRPC connection
+func NewClientGRPC(conn grpc.ClientConnInterface) GRPCClient {
+	return &clientGRPC{
+		client: crawlerpb.NewCrawlServiceClient(conn),
+	}
+}
+
+// An asynchronous request for crawling a webpage. The crawl is watched in the
+// background and the callback is called once it has been finished
+func (c *clientGRPC) CrawlAsync(ctx context.Context, url string, cb func(crawl *Crawl), opts ...CrawlOptions) (guid string, err error) {
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	// the watch outlives the request so it cannot use the callers context
+	wctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.client.Watch(wctx, &crawlerpb.CrawlRequest{Url: url, Options: optionsToProto(o)})
+	if err != nil {
+		cancel()
+		return "", grpcError(err)
+	}
+
+	queued, err := stream.Recv()
+	if err != nil {
+		cancel()
+		return "", grpcError(err)
+	}
+
+	go func() {
+		defer cancel()
+
+		for {
+			pe, err := stream.Recv()
+			if err != nil {
+				log.Println(grpcError(err))
+				return
+			}
+
+			e, err := eventFromProto(pe)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			if e.Crawl != nil && (e.Stage == CrawlCompleted || e.Stage == CrawlFailed) {
+				cb(e.Crawl)
+				return
+			}
+		}
+	}()
+
+	return queued.Id, nil
+}
+
+// A synchronous request for crawling a webpage
+func (c *clientGRPC) Crawl(ctx context.Context, url string, opts ...CrawlOptions) (result *Crawl, err error) {
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.client.Crawl(ctx, &crawlerpb.CrawlRequest{Url: url, Options: optionsToProto(o)})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return crawlFromProto(reply.Crawl)
+}
+
+// Get the progress of a crawl
+func (c *clientGRPC) CrawlProgress(ctx context.Context, guid string) (result *Crawl, err error) {
+	reply, err := c.client.CrawlProgress(ctx, &crawlerpb.ProgressRequest{Id: guid})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return crawlFromProto(reply.Crawl)
+}
+
+// Crawl many urls. The batch is streamed in the background once its id has arrived
+func (c *clientGRPC) CrawlBatch(ctx context.Context, items []BatchItem, cb func(*BatchResult), done func(*BatchSummary)) (batchID string, err error) {
+	// the stream outlives the request so it cannot use the callers context
+	sctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.client.CrawlBatch(sctx, &crawlerpb.BatchRequest{Items: batchItemsToProto(items)})
+	if err != nil {
+		cancel()
+		return "", grpcError(err)
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		cancel()
+		return "", grpcError(err)
+	}
+
+	go func() {
+		defer cancel()
+
+		for {
+			pe, err := stream.Recv()
+			if err != nil {
+				log.Printf("batch %s ended early: %s", first.BatchId, grpcError(err))
+				return
+			}
+
+			e, err := batchEventFromProto(pe)
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			if e.Result != nil && cb != nil {
+				cb(e.Result)
+			}
+
+			if e.Summary != nil {
+				if done != nil {
+					done(e.Summary)
+				}
+				return
+			}
+		}
+	}()
+
+	return first.BatchId, nil
+}
+
+// Watch crawls a url and calls fn with each event of the crawl until it finishes
+func (c *clientGRPC) Watch(ctx context.Context, url string, fn func(*CrawlEvent)) error {
+	stream, err := c.client.Watch(ctx, &crawlerpb.CrawlRequest{Url: url})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	return receiveEvents(stream, fn)
+}
+
+// CrawlStream crawls every url over a single stream and calls fn with the events of each
+// crawl, returning once every crawl has finished
+func (c *clientGRPC) CrawlStream(ctx context.Context, urls []string, fn func(*CrawlEvent)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.CrawlStream(ctx)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	go func() {
+		for i, url := range urls {
+			err := stream.Send(&crawlerpb.CrawlRequest{Url: url, RequestId: strconv.Itoa(i)})
+			if err != nil {
+				// the reason the stream broke is returned by Recv
+				return
+			}
+		}
+		stream.CloseSend()
+	}()
+
+	return receiveEvents(stream, fn)
+}
+
+// receiveEvents passes every event on a stream to fn until the server ends it
+func receiveEvents(stream interface {
+	Recv() (*crawlerpb.CrawlEvent, error)
+}, fn func(*CrawlEvent)) error {
+	for {
+		pe, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return grpcError(err)
+		}
+
+		e, err := eventFromProto(pe)
+		if err != nil {
+			return err
+		}
+		fn(e)
+	}
+}
+
+// grpcError turns the status of a failed call back into the error the service returned.
+// Calls that failed before reaching the service are given a code from their status
+func grpcError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	for _, d := range s.Details() {
+		if pe, ok := d.(*crawlerpb.Error); ok {
+			return fromError(errorFromProto(pe))
+		}
+	}
+
+	switch s.Code() {
+	case codes.InvalidArgument:
+		return NewError(CodeInvalidRequest, s.Message())
+	case codes.NotFound:
+		return NewError(CodeNotFound, s.Message())
+	case codes.Unavailable, codes.ResourceExhausted:
+		return NewError(CodeUnavailable, s.Message())
+	case codes.DeadlineExceeded:
+		return NewError(CodeTimeout, s.Message())
+	case codes.Canceled:
+		return NewError(CodeCanceled, s.Message())
+	case codes.PermissionDenied:
+		return NewError(CodeBlockedAddress, s.Message())
+	}
+	return NewError(CodeInternal, s.Message())
+}
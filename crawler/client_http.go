@@ -0,0 +1,228 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// How often the http client polls for the result of an async crawl, and how long it
+// keeps polling before giving up
+const (
+	httpPollInterval = 500 * time.Millisecond
+	httpPollTimeout  = 5 * time.Minute
+)
+
+type clientHTTP struct {
+	base   string
+	client *http.Client
+}
+
+// NewClientHTTP creates a client for the service served over http at the base url. If
+// client is nil the http.DefaultClient is used
+func NewClientHTTP(baseURL string, client *http.Client) Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &clientHTTP{
+		base:   strings.TrimSuffix(baseURL, "/"),
+		client: client,
+	}
+}
+
+// An asynchronous request for crawling a webpage. The client polls for the result and
+// calls the callback once the crawl has been finished
+func (c *clientHTTP) CrawlAsync(ctx context.Context, url string, cb func(crawl *Crawl), opts ...CrawlOptions) (guid string, err error) {
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	var reply CrawlReply
+	_, err = c.do(ctx, http.MethodPost, "/crawl/async", &CrawlAsyncRequest{URL: url, Options: o}, &reply)
+	if err != nil {
+		return "", err
+	}
+
+	guid = reply.Crawl.ID
+	go c.poll(guid, cb)
+
+	return guid, nil
+}
+
+// A synchronous request for crawling a webpage
+func (c *clientHTTP) Crawl(ctx context.Context, url string, opts ...CrawlOptions) (result *Crawl, err error) {
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply CrawlReply
+	_, err = c.do(ctx, http.MethodPost, "/crawl", &CrawlRequest{URL: url, Options: o}, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reply.Crawl, nil
+}
+
+// Get the progress of a crawl
+func (c *clientHTTP) CrawlProgress(ctx context.Context, guid string) (result *Crawl, err error) {
+	var reply CrawlReply
+	_, err = c.do(ctx, http.MethodGet, "/crawl/"+url.PathEscape(guid), nil, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reply.Crawl, nil
+}
+
+// Crawl many urls. The results are streamed back on the response, which is read in the
+// background once the batch id has arrived
+func (c *clientHTTP) CrawlBatch(ctx context.Context, items []BatchItem, cb func(*BatchResult), done func(*BatchSummary)) (batchID string, err error) {
+	body, err := json.Marshal(&CrawlBatchRequest{Items: items})
+	if err != nil {
+		return "", err
+	}
+
+	// the stream outlives the request so it cannot use the callers context
+	req, err := http.NewRequest(http.MethodPost, c.base+"/crawl/batch", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return "", responseError(resp)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+
+	var first BatchEvent
+	err = dec.Decode(&first)
+	if err != nil {
+		resp.Body.Close()
+		return "", err
+	}
+
+	go func() {
+		defer resp.Body.Close()
+
+		for {
+			var event BatchEvent
+			err := dec.Decode(&event)
+			if err != nil {
+				log.Printf("batch %s ended early: %s", first.BatchID, err)
+				return
+			}
+
+			if event.Result != nil && cb != nil {
+				cb(event.Result)
+			}
+
+			if event.Summary != nil {
+				if done != nil {
+					done(event.Summary)
+				}
+				return
+			}
+		}
+	}()
+
+	return first.BatchID, nil
+}
+
+// poll waits for an async crawl to finish and passes the result to the callback
+func (c *clientHTTP) poll(guid string, cb func(crawl *Crawl)) {
+	ctx, cancel := context.WithTimeout(context.Background(), httpPollTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(httpPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// a crawl that is not found may be between finishing and having its result
+			// stored, so it is polled for again until the timeout
+			var reply CrawlReply
+			status, err := c.do(ctx, http.MethodGet, "/crawl/"+url.PathEscape(guid), nil, &reply)
+			if status == http.StatusNotFound {
+				continue
+			}
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			if status == http.StatusOK {
+				cb(&reply.Crawl)
+				return
+			}
+
+		case <-ctx.Done():
+			log.Printf("gave up waiting for crawl %s: %s", guid, ctx.Err())
+			return
+		}
+	}
+}
+
+// do sends a request to the service and decodes the reply, turning an error response
+// into a go error
+func (c *clientHTTP) do(ctx context.Context, method, path string, body interface{}, reply interface{}) (int, error) {
+	var in bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&in).Encode(body)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.base+path, &in)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, responseError(resp)
+	}
+
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// responseError turns a response that is not a success into the error the service
+// replied with
+func responseError(resp *http.Response) error {
+	var herr httpError
+	err := json.NewDecoder(resp.Body).Decode(&herr)
+	if err != nil || herr.Error == nil {
+		code := CodeInternal
+		if resp.StatusCode >= 500 {
+			code = CodeUnavailable
+		}
+		return NewError(code, fmt.Sprintf("crawl service replied %s", resp.Status))
+	}
+
+	return fromError(herr.Error)
+}
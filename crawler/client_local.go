@@ -0,0 +1,35 @@
+package crawler
+
+import "context"
+
+type clientLocal struct {
+	service Service
+}
+
+// NewClientLocal creates a client that calls a service running in the same process,
+// so a single binary or a test can use the service without a message bus
+func NewClientLocal(service Service) Client {
+	return &clientLocal{
+		service: service,
+	}
+}
+
+// An asynchronous request for crawling a webpage
+func (c *clientLocal) CrawlAsync(ctx context.Context, url string, cb func(*Crawl), opts ...CrawlOptions) (guid string, err error) {
+	return c.service.CrawlAsync(ctx, url, cb, opts...)
+}
+
+// A synchronous request for crawling a webpage
+func (c *clientLocal) Crawl(ctx context.Context, url string, opts ...CrawlOptions) (result *Crawl, err error) {
+	return c.service.Crawl(ctx, url, opts...)
+}
+
+// Get the progress of a crawl
+func (c *clientLocal) CrawlProgress(ctx context.Context, guid string) (result *Crawl, err error) {
+	return c.service.CrawlProgress(ctx, guid)
+}
+
+// Crawl many urls
+func (c *clientLocal) CrawlBatch(ctx context.Context, items []BatchItem, cb func(*BatchResult), done func(*BatchSummary)) (batchID string, err error) {
+	return c.service.CrawlBatch(ctx, items, cb, done)
+}
@@ -2,27 +2,71 @@ package crawler
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"log"
 
-	"github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 	"github.com/satori/go.uuid"
 )
 
 type clientNats struct {
-	conn *nats.Conn
+	conn     *nats.Conn
+	enc      Encoding
+	subjects Subjects
+	err      error
+}
+
+// NatsOpts configures how the nats client and publisher write their messages. Replies
+// from the transport are written in the same encoding as the request.
+//
+// Namespace prefixes every subject so that separate deployments can share a nats
+// cluster, and QueueGroup replaces the queue group the transports share
+type NatsOpts struct {
+	Encoding   Encoding
+	Namespace  string
+	QueueGroup string
+}
+
+func natsOpts(opts []NatsOpts) NatsOpts {
+	if len(opts) == 0 {
+		return NatsOpts{}
+	}
+	return opts[0]
+}
+
+// subjects derives the subjects of the namespace. An invalid namespace is reported when
+// the subjects are first used, as the nats constructors do not return errors
+func (o NatsOpts) subjects() (Subjects, error) {
+	s, err := NewSubjects(o.Namespace)
+	if err != nil {
+		return s, err
+	}
+
+	if o.QueueGroup != "" {
+		s.QueueGroup = o.QueueGroup
+	}
+	return s, nil
 }
 
 // NewClientNats creates a client for the service over the nats message bus
-func NewClientNats(conn *nats.Conn) Client {
+func NewClientNats(conn *nats.Conn, opts ...NatsOpts) Client {
+	o := natsOpts(opts)
+	subjects, err := o.subjects()
+
 	return &clientNats{
-		conn: conn,
+		conn:     conn,
+		enc:      o.Encoding,
+		subjects: subjects,
+		err:      err,
 	}
 }
 
 //An asynchronous request for crawling a webpage. The callback will be called when the crawl has been finished
-func (c *clientNats) CrawlAsync(ctx context.Context, url string, cb func(crawl *Crawl)) (guid string, err error) {
+func (c *clientNats) CrawlAsync(ctx context.Context, url string, cb func(crawl *Crawl), opts ...CrawlOptions) (guid string, err error) {
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
 	u, err := uuid.NewV4()
 	if err != nil {
 		return "", err
@@ -30,34 +74,34 @@ func (c *clientNats) CrawlAsync(ctx context.Context, url string, cb func(crawl *
 	reqid := u.String()
 
 	req := CrawlAsyncRequest{
-		URL:   url,
-		Reply: reqid,
+		URL:     url,
+		Reply:   reqid,
+		Options: o,
 	}
-	data, err := json.Marshal(req)
+	data, err := c.enc.Encode(&req)
 	if err != nil {
 		return "", err
 	}
 
-	msg, err := c.conn.RequestWithContext(ctx, "crawlAsync", data)
+	msg, err := c.request(ctx, c.subjects.CrawlAsync, data)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 
 	var reply CrawlReply
-	err = json.Unmarshal(msg.Data, &reply)
+	_, err = Decode(msg.Data, &reply)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
 	if reply.Error != nil {
-		log.Println(reply.Error)
-		return "", reply.Error
+		return "", fromError(reply.Error)
 	}
 
 	sub, err := c.conn.Subscribe(reqid, func(msg *nats.Msg) {
 		var reply CrawlReply
-		err := json.Unmarshal(msg.Data, &reply)
+		_, err := Decode(msg.Data, &reply)
 		if err != nil {
 			log.Println(err)
 			return
@@ -82,7 +126,12 @@ func (c *clientNats) CrawlAsync(ctx context.Context, url string, cb func(crawl *
 }
 
 //A synchronous request for crawling a webpage
-func (c *clientNats) Crawl(ctx context.Context, url string) (result *Crawl, err error) {
+func (c *clientNats) Crawl(ctx context.Context, url string, opts ...CrawlOptions) (result *Crawl, err error) {
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	u, err := uuid.NewV4()
 	if err != nil {
 		return nil, err
@@ -90,29 +139,29 @@ func (c *clientNats) Crawl(ctx context.Context, url string) (result *Crawl, err
 	reqid := u.String()
 
 	req := CrawlAsyncRequest{
-		URL:   url,
-		Reply: reqid,
+		URL:     url,
+		Reply:   reqid,
+		Options: o,
 	}
-	data, err := json.Marshal(req)
+	data, err := c.enc.Encode(&req)
 	if err != nil {
 		return nil, err
 	}
 
-	msg, err := c.conn.RequestWithContext(ctx, "crawl", data)
+	msg, err := c.request(ctx, c.subjects.Crawl, data)
 	if err != nil {
 		return
 	}
 
 	var reply CrawlReply
-	err = json.Unmarshal(msg.Data, &reply)
+	_, err = Decode(msg.Data, &reply)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
 	if reply.Error != nil {
-		log.Println(reply.Error)
-		return nil, nil
+		return nil, fromError(reply.Error)
 	}
 
 	return &reply.Crawl, nil
@@ -120,5 +169,88 @@ func (c *clientNats) Crawl(ctx context.Context, url string) (result *Crawl, err
 
 // Get the progress of a crawl
 func (c *clientNats) CrawlProgress(ctx context.Context, guid string) (result *Crawl, err error) {
-	return nil, errors.New("Unimplemented")
+	data, err := c.enc.Encode(&ProgressRequest{GUID: guid})
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := c.request(ctx, c.subjects.CrawlProgress, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply CrawlReply
+	_, err = Decode(msg.Data, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.Error != nil {
+		return nil, fromError(reply.Error)
+	}
+
+	return &reply.Crawl, nil
+}
+
+// Crawl many urls. The results are published to a subject that the client listens on
+// before sending the request, and it stops listening once the summary arrives
+func (c *clientNats) CrawlBatch(ctx context.Context, items []BatchItem, cb func(*BatchResult), done func(*BatchSummary)) (batchID string, err error) {
+	inbox := nats.NewInbox()
+
+	sub, err := c.conn.Subscribe(inbox, func(msg *nats.Msg) {
+		var event BatchEvent
+		_, err := Decode(msg.Data, &event)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		if event.Result != nil && cb != nil {
+			cb(event.Result)
+		}
+
+		if event.Summary != nil {
+			if done != nil {
+				done(event.Summary)
+			}
+			msg.Sub.Unsubscribe()
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	data, err := c.enc.Encode(&CrawlBatchRequest{Items: items, Reply: inbox})
+	if err != nil {
+		sub.Unsubscribe()
+		return "", err
+	}
+
+	msg, err := c.request(ctx, c.subjects.CrawlBatch, data)
+	if err != nil {
+		sub.Unsubscribe()
+		return "", err
+	}
+
+	var reply CrawlBatchReply
+	_, err = Decode(msg.Data, &reply)
+	if err != nil {
+		sub.Unsubscribe()
+		return "", err
+	}
+
+	if reply.Error != nil {
+		sub.Unsubscribe()
+		return "", fromError(reply.Error)
+	}
+
+	return reply.BatchID, nil
+}
+
+// request sends a request on a subject of the namespace and waits for the reply
+func (c *clientNats) request(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.conn.RequestWithContext(ctx, subject, data)
 }
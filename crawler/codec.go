@@ -0,0 +1,359 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/samjohnduke/crawl3/crawler/crawlerpb"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// The content types of the codecs that are always registered
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// The compressions that are always registered
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// A Codec converts the messages sent between the crawler and its clients to and from
+// bytes. The content type names the codec in the envelope of every message
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// A Compressor compresses the body of an envelope. The name is recorded in the
+// envelope so the reader knows how to decompress it
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecs      = make(map[string]Codec)
+	compressors = make(map[string]Compressor)
+	codecsMU    sync.RWMutex
+)
+
+func init() {
+	RegisterCodec(jsonCodec{})
+	RegisterCodec(msgpackCodec{})
+	RegisterCodec(protoCodec{})
+	RegisterCompressor(gzipCompressor{})
+	RegisterCompressor(&zstdCompressor{})
+}
+
+// RegisterCodec makes a codec available for encoding and decoding messages, replacing
+// any codec with the same content type
+func RegisterCodec(c Codec) {
+	codecsMU.Lock()
+	codecs[c.ContentType()] = c
+	codecsMU.Unlock()
+}
+
+// RegisterCompressor makes a compression available for envelopes, replacing any with
+// the same name
+func RegisterCompressor(c Compressor) {
+	codecsMU.Lock()
+	compressors[c.Name()] = c
+	codecsMU.Unlock()
+}
+
+// CodecFor finds the codec registered for a content type
+func CodecFor(contentType string) (Codec, error) {
+	codecsMU.RLock()
+	c, ok := codecs[contentType]
+	codecsMU.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no codec for content type %q", contentType)
+	}
+	return c, nil
+}
+
+// CompressorFor finds the compressor registered with a name
+func CompressorFor(name string) (Compressor, error) {
+	codecsMU.RLock()
+	c, ok := compressors[name]
+	codecsMU.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no compressor named %q", name)
+	}
+	return c, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// msgpackCodec uses the json names of fields so every codec describes a message with
+// the same keys
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string {
+	return ContentTypeMsgpack
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// protoCodec writes messages as the protobuf messages in crawlerpb, which gives other
+// languages a typed schema for the message bus
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	var m proto.Message
+	var err error
+
+	switch msg := v.(type) {
+	case *Crawl:
+		m, err = crawlToProto(msg)
+	case *CrawlRequest:
+		m = &crawlerpb.CrawlRequest{Url: msg.URL, Options: optionsToProto(msg.Options)}
+	case *CrawlAsyncRequest:
+		m = &crawlerpb.CrawlAsyncRequest{Url: msg.URL, Reply: msg.Reply, Options: optionsToProto(msg.Options)}
+	case *ProgressRequest:
+		m = &crawlerpb.ProgressRequest{Id: msg.GUID}
+	case *CrawlReply:
+		m, err = replyToProto(msg)
+	case *CrawlBatchRequest:
+		m = &crawlerpb.BatchRequest{Items: batchItemsToProto(msg.Items), Reply: msg.Reply}
+	case *CrawlBatchReply:
+		m = &crawlerpb.BatchReply{BatchId: msg.BatchID, Error: errorToProto(msg.Error)}
+	case *BatchEvent:
+		m, err = batchEventToProto(msg)
+	case *CrawlEvent:
+		m, err = eventToProto(msg)
+	case proto.Message:
+		m = msg
+	default:
+		return nil, fmt.Errorf("unable to encode %T as protobuf", v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	switch msg := v.(type) {
+	case *Crawl:
+		var pc crawlerpb.Crawl
+		err := proto.Unmarshal(data, &pc)
+		if err != nil {
+			return err
+		}
+
+		c, err := crawlFromProto(&pc)
+		if err != nil {
+			return err
+		}
+		*msg = *c
+
+	case **Crawl:
+		var c Crawl
+		err := protoCodec{}.Unmarshal(data, &c)
+		if err != nil {
+			return err
+		}
+		*msg = &c
+
+	case *CrawlRequest:
+		var pr crawlerpb.CrawlRequest
+		err := proto.Unmarshal(data, &pr)
+		if err != nil {
+			return err
+		}
+		*msg = CrawlRequest{URL: pr.Url, Options: optionsFromProto(pr.Options)}
+
+	case *CrawlAsyncRequest:
+		var pr crawlerpb.CrawlAsyncRequest
+		err := proto.Unmarshal(data, &pr)
+		if err != nil {
+			return err
+		}
+		*msg = CrawlAsyncRequest{URL: pr.Url, Reply: pr.Reply, Options: optionsFromProto(pr.Options)}
+
+	case *ProgressRequest:
+		var pr crawlerpb.ProgressRequest
+		err := proto.Unmarshal(data, &pr)
+		if err != nil {
+			return err
+		}
+		*msg = ProgressRequest{GUID: pr.Id}
+
+	case *CrawlReply:
+		var pr crawlerpb.CrawlReply
+		err := proto.Unmarshal(data, &pr)
+		if err != nil {
+			return err
+		}
+
+		reply, err := replyFromProto(&pr)
+		if err != nil {
+			return err
+		}
+		*msg = *reply
+
+	case *CrawlBatchRequest:
+		var pr crawlerpb.BatchRequest
+		err := proto.Unmarshal(data, &pr)
+		if err != nil {
+			return err
+		}
+		*msg = CrawlBatchRequest{Items: batchItemsFromProto(pr.Items), Reply: pr.Reply}
+
+	case *CrawlBatchReply:
+		var pr crawlerpb.BatchReply
+		err := proto.Unmarshal(data, &pr)
+		if err != nil {
+			return err
+		}
+		*msg = CrawlBatchReply{BatchID: pr.BatchId, Error: errorFromProto(pr.Error)}
+
+	case *BatchEvent:
+		var pe crawlerpb.BatchEvent
+		err := proto.Unmarshal(data, &pe)
+		if err != nil {
+			return err
+		}
+
+		e, err := batchEventFromProto(&pe)
+		if err != nil {
+			return err
+		}
+		*msg = *e
+
+	case *CrawlEvent:
+		var pe crawlerpb.CrawlEvent
+		err := proto.Unmarshal(data, &pe)
+		if err != nil {
+			return err
+		}
+
+		e, err := eventFromProto(&pe)
+		if err != nil {
+			return err
+		}
+		*msg = *e
+
+	case proto.Message:
+		return proto.Unmarshal(data, msg)
+
+	default:
+		return fmt.Errorf("unable to decode protobuf into %T", v)
+	}
+
+	return nil
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string {
+	return CompressionGzip
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	return buf.Bytes(), err
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// zstdCompressor shares one encoder and decoder, which are safe for concurrent use
+// through EncodeAll and DecodeAll
+type zstdCompressor struct {
+	once sync.Once
+	enc  *zstd.Encoder
+	dec  *zstd.Decoder
+	err  error
+}
+
+func (z *zstdCompressor) Name() string {
+	return CompressionZstd
+}
+
+func (z *zstdCompressor) init() error {
+	z.once.Do(func() {
+		z.enc, z.err = zstd.NewWriter(nil)
+		if z.err != nil {
+			return
+		}
+		z.dec, z.err = zstd.NewReader(nil)
+	})
+	return z.err
+}
+
+func (z *zstdCompressor) Compress(data []byte) ([]byte, error) {
+	err := z.init()
+	if err != nil {
+		return nil, err
+	}
+	return z.enc.EncodeAll(data, nil), nil
+}
+
+func (z *zstdCompressor) Decompress(data []byte) ([]byte, error) {
+	err := z.init()
+	if err != nil {
+		return nil, err
+	}
+	return z.dec.DecodeAll(data, nil)
+}
@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A ContentHandler fills in the content of a crawl from a fetched document of a media
+// type it understands. Every handler gives the same shape of crawl, setting what it can
+// of the title, description, links, harvested data and page hash
+type ContentHandler interface {
+	Handle(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error
+}
+
+// ContentHandlerFunc turns a function into a ContentHandler
+type ContentHandlerFunc func(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error
+
+// Handle calls the function
+func (f ContentHandlerFunc) Handle(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+	return f(u, body, exes, logger)
+}
+
+// ContentHandlers picks the handler for the media type of a crawl. A handler can be
+// registered for a media type such as application/pdf or for every subtype with
+// text/*, and types with a +json or +xml suffix use the handler of application/json or
+// application/xml unless they have their own
+type ContentHandlers struct {
+	handlers map[string]ContentHandler
+	fallback ContentHandler
+	mu       sync.RWMutex
+}
+
+// NewContentHandlers creates a registry with the built in handlers for html, plain
+// text, json, xml and pdf. Documents of any other type only have their hash taken
+func NewContentHandlers() *ContentHandlers {
+	h := &ContentHandlers{
+		handlers: make(map[string]ContentHandler),
+		fallback: ContentHandlerFunc(handleUnknown),
+	}
+
+	h.Register("text/html", ContentHandlerFunc(ExtractPage))
+	h.Register("application/xhtml+xml", ContentHandlerFunc(ExtractPage))
+	h.Register("text/plain", ContentHandlerFunc(handleText))
+	h.Register("application/json", ContentHandlerFunc(handleJSON))
+	h.Register("text/json", ContentHandlerFunc(handleJSON))
+	h.Register("application/xml", ContentHandlerFunc(handleXML))
+	h.Register("text/xml", ContentHandlerFunc(handleXML))
+	h.Register("application/pdf", ContentHandlerFunc(handlePDF))
+	return h
+}
+
+// Register sets the handler for a media type, replacing any handler it had
+func (h *ContentHandlers) Register(mediaType string, handler ContentHandler) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlers[strings.ToLower(mediaType)] = handler
+}
+
+// Handler returns the handler registered for the media type, or nil if there is none
+func (h *ContentHandlers) Handler(mediaType string) ContentHandler {
+	mediaType = strings.ToLower(mediaType)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if handler, ok := h.handlers[mediaType]; ok {
+		return handler
+	}
+
+	if strings.HasSuffix(mediaType, "+json") {
+		if handler, ok := h.handlers["application/json"]; ok {
+			return handler
+		}
+	}
+	if strings.HasSuffix(mediaType, "+xml") {
+		if handler, ok := h.handlers["application/xml"]; ok {
+			return handler
+		}
+	}
+
+	if i := strings.Index(mediaType, "/"); i > 0 {
+		if handler, ok := h.handlers[mediaType[:i]+"/*"]; ok {
+			return handler
+		}
+	}
+
+	return nil
+}
+
+// Handle runs the document through the handler of the content type of the crawl. When
+// the type is missing or has no handler it is worked out from the body instead
+func (h *ContentHandlers) Handle(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+	handler := h.Handler(u.ContentType)
+	if handler == nil {
+		sniffed := mediaType(http.DetectContentType(body))
+		handler = h.Handler(sniffed)
+
+		if u.ContentType == "" {
+			u.ContentType = sniffed
+		}
+	}
+
+	if handler == nil {
+		handler = h.fallback
+	}
+	return handler.Handle(u, body, exes, logger)
+}
@@ -0,0 +1,265 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// How much of a document is used as its title and description when it has none
+const (
+	maxContentTitle       = 200
+	maxContentDescription = 500
+)
+
+var textURLPattern = regexp.MustCompile(`https?://[^\s<>"'()\[\]{}]+`)
+
+// setContent fills in the fields every content handler sets, so a crawl has the same
+// shape whatever type of document it fetched
+func setContent(u *Crawl, body []byte, title, description string, urls []string, harvested []interface{}, metadata map[string]interface{}) {
+	sum := sha256.Sum256(body)
+	u.PageHash = hex.EncodeToString(sum[:])
+	u.ExtractTime = time.Now()
+
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+
+	u.Title = strings.TrimSpace(title)
+	u.Description = strings.TrimSpace(description)
+	u.HarvestedURLs = nil
+	if u.opts.runs(StageLinks) && len(urls) > 0 {
+		u.HarvestedURLs = normaliseUrls(urls, u.URL)
+	}
+	u.HarvestedData = harvested
+	u.MetaData = metadata
+	u.JSONData = []interface{}{}
+	u.MicroData = nil
+	u.Validation = nil
+}
+
+// handleText takes the first line of a plain text document as its title and the first
+// paragraph as its description, and harvests the urls written in it
+func handleText(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+	text := string(body)
+	title, description := summariseText(text)
+
+	setContent(u, body, title, description, textURLPattern.FindAllString(text, -1), []interface{}{
+		map[string]interface{}{"text": text},
+	}, nil)
+	return nil
+}
+
+// handleJSON decodes a json document. If the host has api rules for the document the
+// records they read are the harvested data and the next pages are harvested urls,
+// otherwise the whole document is the harvested data
+func handleJSON(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+	var data interface{}
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return err
+	}
+
+	var title, description string
+	if obj, ok := data.(map[string]interface{}); ok {
+		title = firstString(obj, "title", "name", "headline")
+		description = firstString(obj, "description", "summary")
+	}
+
+	harvested, urls, validations := extractAPI(u, data, exes, logger)
+	if harvested == nil {
+		harvested = []interface{}{data}
+	}
+
+	setContent(u, body, title, description, urls, harvested, nil)
+	u.Validation = validations
+	return nil
+}
+
+func firstString(obj map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := obj[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// handleXML reads the title and description of an xml document such as a feed, and the
+// links it holds in link, loc and enclosure elements or href attributes
+func handleXML(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// read other charsets as they are rather than failing the whole document
+		return input, nil
+	}
+
+	var title, description, root string
+	var urls []string
+	var path []string
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if root == "" {
+				return err
+			}
+			logger.Println(err)
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if root == "" {
+				root = t.Name.Local
+			}
+			path = append(path, strings.ToLower(t.Name.Local))
+
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "href" || (path[len(path)-1] == "enclosure" && attr.Name.Local == "url") {
+					urls = append(urls, attr.Value)
+				}
+			}
+
+		case xml.EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+
+		case xml.CharData:
+			if len(path) == 0 {
+				continue
+			}
+			text := strings.TrimSpace(string(t))
+			if text == "" {
+				continue
+			}
+
+			switch path[len(path)-1] {
+			case "title":
+				if title == "" {
+					title = text
+				}
+			case "description", "subtitle", "summary":
+				if description == "" {
+					description = text
+				}
+			case "link", "loc":
+				urls = append(urls, text)
+			}
+		}
+	}
+
+	setContent(u, body, title, description, urls, nil, map[string]interface{}{"xml:root": root})
+	return nil
+}
+
+// handlePDF extracts the text of a pdf. The title comes from the document information
+// if it has one, and the rest of that information is kept as pdf: metadata
+func handlePDF(u *Crawl, body []byte, exes Extractors, logger *log.Logger) (err error) {
+	// the pdf reader panics on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to read pdf: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+
+	plain, err := r.GetPlainText()
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(plain)
+	if err != nil {
+		return err
+	}
+	text := string(content)
+
+	metadata := make(map[string]interface{})
+	info := r.Trailer().Key("Info")
+	for _, key := range []string{"Title", "Author", "Subject", "Keywords", "Creator", "Producer"} {
+		if v := strings.TrimSpace(info.Key(key).Text()); v != "" {
+			metadata["pdf:"+strings.ToLower(key)] = v
+		}
+	}
+
+	title, description := summariseText(text)
+	if t, ok := metadata["pdf:title"].(string); ok {
+		title = t
+	}
+	if s, ok := metadata["pdf:subject"].(string); ok {
+		description = s
+	}
+
+	setContent(u, body, title, description, textURLPattern.FindAllString(text, -1), []interface{}{
+		map[string]interface{}{"text": text, "pages": r.NumPage()},
+	}, metadata)
+	return nil
+}
+
+// handleUnknown is used for documents no handler understands, only their hash is taken
+func handleUnknown(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+	setContent(u, body, "", "", nil, nil, nil)
+	return nil
+}
+
+// summariseText takes the first line of a text as its title and the first paragraph
+// after it as its description
+func summariseText(text string) (string, string) {
+	var title string
+	var paragraph []string
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if title == "" {
+			title = line
+			continue
+		}
+
+		if line == "" {
+			if len(paragraph) > 0 {
+				break
+			}
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+
+	return truncate(title, maxContentTitle), truncate(strings.Join(paragraph, " "), maxContentDescription)
+}
+
+// truncate cuts a string to at most n bytes without splitting a character. Only a
+// character cut in two is backed off over, so bytes that are not valid UTF-8 elsewhere
+// in the string are kept as they are
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for i := n; i > 0 && i > n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			return s[:i]
+		}
+	}
+	return s[:n]
+}
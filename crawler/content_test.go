@@ -0,0 +1,169 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testPDF builds a one page pdf with the text and document information title
+func testPDF(text, title string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Title (" + title + ") /Author (crawl3) >>",
+	}
+	content := "BT /F1 24 Tf 72 700 Td (" + text + ") Tj ET"
+	objects[3] = fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func handleContent(t *testing.T, contentType string, body []byte) *Crawl {
+	u := &Crawl{URL: "https://example.com/docs/page", ContentType: contentType}
+
+	err := NewContentHandlers().Handle(u, body, NewDefaultExtractors(), log.New(ioutil.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("%s: %s", contentType, err)
+	}
+
+	if u.PageHash == "" || u.MetaData == nil {
+		t.Errorf("%s: expected every crawl to have a hash and metadata, got %+v", contentType, u)
+	}
+	return u
+}
+
+func TestContentHandlers(t *testing.T) {
+	text := handleContent(t, "text/plain", []byte("Release Notes\n\nThe first paragraph\ncarries on here.\n\nSee https://example.com/changes for more.\n"))
+	if text.Title != "Release Notes" || text.Description != "The first paragraph carries on here." {
+		t.Errorf("unexpected text summary %q %q", text.Title, text.Description)
+	}
+	if len(text.HarvestedURLs) != 1 || text.HarvestedURLs[0] != "https://example.com/changes" {
+		t.Errorf("expected the url in the text, got %v", text.HarvestedURLs)
+	}
+
+	data := handleContent(t, "application/ld+json", []byte(`{"name": "Widget", "price": 10}`))
+	decoded, ok := data.HarvestedData.([]interface{})
+	if !ok || len(decoded) != 1 || decoded[0].(map[string]interface{})["price"] != float64(10) || data.Title != "Widget" {
+		t.Errorf("expected the decoded json, got %+v", data.HarvestedData)
+	}
+
+	feed := handleContent(t, "application/rss+xml", []byte(`<?xml version="1.0"?>
+<rss version="2.0"><channel><title>News</title><description>All the news</description>
+<item><title>One</title><link>/articles/one</link><enclosure url="https://cdn.example.com/one.mp3"/></item>
+</channel></rss>`))
+	if feed.Title != "News" || feed.Description != "All the news" {
+		t.Errorf("unexpected feed summary %q %q", feed.Title, feed.Description)
+	}
+	if strings.Join(feed.HarvestedURLs, " ") != "https://example.com/articles/one https://cdn.example.com/one.mp3" {
+		t.Errorf("expected the links of the feed, got %v", feed.HarvestedURLs)
+	}
+
+	doc := handleContent(t, "application/pdf", testPDF("Hello PDF", "Quarterly Report"))
+	if doc.Title != "Quarterly Report" || doc.MetaData["pdf:author"] != "crawl3" {
+		t.Errorf("expected the document information, got %q %v", doc.Title, doc.MetaData)
+	}
+	harvested := doc.HarvestedData.([]interface{})[0].(map[string]interface{})
+	if !strings.Contains(harvested["text"].(string), "Hello PDF") || harvested["pages"] != 1 {
+		t.Errorf("expected the text of the pdf, got %v", harvested)
+	}
+
+	// without a content type the body decides
+	sniffed := handleContent(t, "", testPDF("Sniffed", "Sniffed"))
+	if sniffed.ContentType != "application/pdf" || sniffed.Title != "Sniffed" {
+		t.Errorf("expected the pdf to be sniffed, got %q %q", sniffed.ContentType, sniffed.Title)
+	}
+
+	image := handleContent(t, "image/png", []byte("\x89PNG\r\n\x1a\nnot really"))
+	if image.Title != "" || len(image.HarvestedURLs) != 0 {
+		t.Errorf("expected nothing from an image, got %+v", image)
+	}
+
+	page := handleContent(t, "text/html", []byte(`<html><head><title>Page</title></head><body><a href="/next">next</a></body></html>`))
+	if page.Title != "Page" || len(page.HarvestedURLs) != 1 {
+		t.Errorf("expected the html to be parsed, got %+v", page)
+	}
+}
+
+func TestContentHandlersRegister(t *testing.T) {
+	handlers := NewContentHandlers()
+
+	called := ""
+	handlers.Register("image/*", ContentHandlerFunc(func(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+		called = u.ContentType
+		return nil
+	}))
+
+	err := handlers.Handle(&Crawl{ContentType: "image/jpeg"}, nil, nil, nil)
+	if err != nil || called != "image/jpeg" {
+		t.Errorf("expected the wildcard handler, got %q %v", called, err)
+	}
+
+	if handlers.Handler("application/vnd.api+json") == nil || handlers.Handler("video/mp4") != nil {
+		t.Error("expected suffixes to fall back to their base type and nothing else to match")
+	}
+}
+
+func TestCrawlJSONDocument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"title": "API", "items": [1, 2, 3]}`))
+	}))
+	defer server.Close()
+
+	c, err := newTestService(t, ServiceOpts{}).Crawl(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ContentType != "application/json" || c.Title != "API" || c.Error != "" {
+		t.Errorf("expected the json document to be decoded, got %+v", c)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc"},
+		{"ab€cd", 3, "ab"},
+		{"ab€cd", 5, "ab€"},
+		{"日本語", 4, "日"},
+		// a latin-1 body keeps its bytes rather than being cut back to the first one
+		{"caf\xe9 au lait", 8, "caf\xe9 au "},
+		{"\xe9\xe9\xe9\xe9\xe9\xe9", 4, "\xe9\xe9\xe9\xe9"},
+	}
+
+	for _, c := range cases {
+		if got := truncate(c.s, c.n); got != c.want {
+			t.Errorf("truncate(%q, %d) = %q, expected %q", c.s, c.n, got, c.want)
+		}
+	}
+}
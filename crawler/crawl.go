@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"net/url"
 	"time"
 )
@@ -21,6 +22,7 @@ type Crawl struct {
 
 	Title       string
 	Description string
+	ContentType string
 
 	HarvestedURLs []string
 	HarvestedData interface{}
@@ -29,12 +31,23 @@ type Crawl struct {
 	JSONData      []interface{}
 	RawData       string
 
+	// Validation holds the result of checking each harvested record against its
+	// host model
+	Validation []Validation
+
 	Error     string
 	ErrorCode string
 
+	// Proxy is the proxy the page was fetched through, without its password
+	Proxy string
+
 	// A signal will be sent when the crawl has been completed
-	sig chan struct{}
-	url *url.URL
+	sig  chan struct{}
+	url  *url.URL
+	opts *CrawlOptions
+
+	// ctx is the context of a caller waiting on the crawl, it is not fetched once done
+	ctx context.Context
 }
 
 // Host will return the hostname of the url of the crawl
@@ -46,3 +59,33 @@ func (c *Crawl) Host() string {
 
 	return u.Host
 }
+
+// CrawlStage is how far a crawl has got through the service
+type CrawlStage string
+
+// The stages a crawl passes through
+const (
+	CrawlQueued       CrawlStage = "queued"
+	CrawlFetchStarted CrawlStage = "fetch_started"
+	CrawlFetched      CrawlStage = "fetched"
+	CrawlExtracted    CrawlStage = "extracted"
+	CrawlPublished    CrawlStage = "published"
+	CrawlCompleted    CrawlStage = "completed"
+	CrawlFailed       CrawlStage = "failed"
+)
+
+// A CrawlEvent reports that a crawl has reached a stage. Crawl is only set once the
+// crawl has completed or failed. RequestID is the id the caller gave the url in a batch.
+// StatusCode and Bytes describe the response once the page has been fetched
+type CrawlEvent struct {
+	Stage      CrawlStage
+	ID         string
+	URL        string
+	Host       string `json:",omitempty"`
+	RequestID  string `json:",omitempty"`
+	Time       time.Time
+	StatusCode int    `json:",omitempty"`
+	Bytes      int64  `json:",omitempty"`
+	Error      string `json:",omitempty"`
+	Crawl      *Crawl `json:",omitempty"`
+}
@@ -0,0 +1,455 @@
+package crawler
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/samjohnduke/crawl3/crawler/crawlerpb"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// crawlToProto converts a crawl into its gRPC message. The extracted data can be any
+// value the extractors produce so it is passed through its JSON form
+func crawlToProto(c *Crawl) (*crawlerpb.Crawl, error) {
+	pc := &crawlerpb.Crawl{
+		Url:           c.URL,
+		Id:            c.ID,
+		PageHash:      c.PageHash,
+		LoadedTime:    timeToProto(c.LoadedTime),
+		StartTime:     timeToProto(c.StartTime),
+		FetchTime:     timeToProto(c.FetchTime),
+		ExtractTime:   timeToProto(c.ExtractTime),
+		EndTime:       timeToProto(c.EndTime),
+		Title:         c.Title,
+		Description:   c.Description,
+		ContentType:   c.ContentType,
+		Proxy:         c.Proxy,
+		HarvestedUrls: c.HarvestedURLs,
+		RawData:       c.RawData,
+		Error:         c.Error,
+		ErrorCode:     c.ErrorCode,
+	}
+
+	var err error
+	pc.HarvestedData, err = valueToProto(c.HarvestedData)
+	if err != nil {
+		return nil, err
+	}
+
+	pc.MicroData, err = valueToProto(c.MicroData)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MetaData != nil {
+		meta, err := valueToProto(c.MetaData)
+		if err != nil {
+			return nil, err
+		}
+		pc.MetaData = meta.GetStructValue()
+	}
+
+	for _, data := range c.JSONData {
+		v, err := valueToProto(data)
+		if err != nil {
+			return nil, err
+		}
+		pc.JsonData = append(pc.JsonData, v)
+	}
+
+	for _, v := range c.Validation {
+		pv := &crawlerpb.Validation{Host: v.Host, Rule: v.Rule, Valid: v.Valid}
+		for _, fe := range v.Errors {
+			pv.Errors = append(pv.Errors, &crawlerpb.FieldError{
+				Field:      fe.Field,
+				Constraint: fe.Constraint,
+				Message:    fe.Message,
+			})
+		}
+		pc.Validation = append(pc.Validation, pv)
+	}
+
+	return pc, nil
+}
+
+// crawlFromProto converts a gRPC crawl message back into a crawl
+func crawlFromProto(pc *crawlerpb.Crawl) (*Crawl, error) {
+	if pc == nil {
+		return &Crawl{}, nil
+	}
+
+	c := &Crawl{
+		URL:           pc.Url,
+		ID:            pc.Id,
+		PageHash:      pc.PageHash,
+		LoadedTime:    timeFromProto(pc.LoadedTime),
+		StartTime:     timeFromProto(pc.StartTime),
+		FetchTime:     timeFromProto(pc.FetchTime),
+		ExtractTime:   timeFromProto(pc.ExtractTime),
+		EndTime:       timeFromProto(pc.EndTime),
+		Title:         pc.Title,
+		Description:   pc.Description,
+		ContentType:   pc.ContentType,
+		Proxy:         pc.Proxy,
+		HarvestedURLs: pc.HarvestedUrls,
+		RawData:       pc.RawData,
+		Error:         pc.Error,
+		ErrorCode:     pc.ErrorCode,
+	}
+
+	var err error
+	c.HarvestedData, err = valueFromProto(pc.HarvestedData)
+	if err != nil {
+		return nil, err
+	}
+
+	c.MicroData, err = valueFromProto(pc.MicroData)
+	if err != nil {
+		return nil, err
+	}
+
+	if pc.MetaData != nil {
+		meta, err := valueFromProto(structpb.NewStructValue(pc.MetaData))
+		if err != nil {
+			return nil, err
+		}
+		c.MetaData, _ = meta.(map[string]interface{})
+	}
+
+	for _, v := range pc.JsonData {
+		data, err := valueFromProto(v)
+		if err != nil {
+			return nil, err
+		}
+		c.JSONData = append(c.JSONData, data)
+	}
+
+	for _, pv := range pc.Validation {
+		v := Validation{Host: pv.Host, Rule: pv.Rule, Valid: pv.Valid}
+		for _, fe := range pv.Errors {
+			v.Errors = append(v.Errors, FieldError{
+				Field:      fe.Field,
+				Constraint: fe.Constraint,
+				Message:    fe.Message,
+			})
+		}
+		c.Validation = append(c.Validation, v)
+	}
+
+	return c, nil
+}
+
+// eventToProto converts a crawl event into its gRPC message
+func eventToProto(e *CrawlEvent) (*crawlerpb.CrawlEvent, error) {
+	pe := &crawlerpb.CrawlEvent{
+		Id:         e.ID,
+		Url:        e.URL,
+		Host:       e.Host,
+		RequestId:  e.RequestID,
+		Time:       timeToProto(e.Time),
+		StatusCode: int32(e.StatusCode),
+		Bytes:      e.Bytes,
+		Error:      e.Error,
+	}
+
+	switch e.Stage {
+	case CrawlQueued:
+		pe.Stage = crawlerpb.CrawlEvent_STAGE_QUEUED
+	case CrawlFetchStarted:
+		pe.Stage = crawlerpb.CrawlEvent_STAGE_FETCH_STARTED
+	case CrawlFetched:
+		pe.Stage = crawlerpb.CrawlEvent_STAGE_FETCHED
+	case CrawlExtracted:
+		pe.Stage = crawlerpb.CrawlEvent_STAGE_EXTRACTED
+	case CrawlPublished:
+		pe.Stage = crawlerpb.CrawlEvent_STAGE_PUBLISHED
+	case CrawlCompleted:
+		pe.Stage = crawlerpb.CrawlEvent_STAGE_COMPLETED
+	case CrawlFailed:
+		pe.Stage = crawlerpb.CrawlEvent_STAGE_FAILED
+	}
+
+	if e.Crawl != nil {
+		pc, err := crawlToProto(e.Crawl)
+		if err != nil {
+			return nil, err
+		}
+		pe.Crawl = pc
+	}
+
+	return pe, nil
+}
+
+// eventFromProto converts a gRPC event message back into a crawl event
+func eventFromProto(pe *crawlerpb.CrawlEvent) (*CrawlEvent, error) {
+	e := &CrawlEvent{
+		ID:         pe.Id,
+		URL:        pe.Url,
+		Host:       pe.Host,
+		RequestID:  pe.RequestId,
+		Time:       timeFromProto(pe.Time),
+		StatusCode: int(pe.StatusCode),
+		Bytes:      pe.Bytes,
+		Error:      pe.Error,
+	}
+
+	switch pe.Stage {
+	case crawlerpb.CrawlEvent_STAGE_QUEUED:
+		e.Stage = CrawlQueued
+	case crawlerpb.CrawlEvent_STAGE_FETCH_STARTED:
+		e.Stage = CrawlFetchStarted
+	case crawlerpb.CrawlEvent_STAGE_FETCHED:
+		e.Stage = CrawlFetched
+	case crawlerpb.CrawlEvent_STAGE_EXTRACTED:
+		e.Stage = CrawlExtracted
+	case crawlerpb.CrawlEvent_STAGE_PUBLISHED:
+		e.Stage = CrawlPublished
+	case crawlerpb.CrawlEvent_STAGE_COMPLETED:
+		e.Stage = CrawlCompleted
+	case crawlerpb.CrawlEvent_STAGE_FAILED:
+		e.Stage = CrawlFailed
+	}
+
+	if pe.Crawl != nil {
+		c, err := crawlFromProto(pe.Crawl)
+		if err != nil {
+			return nil, err
+		}
+		e.Crawl = c
+	}
+
+	return e, nil
+}
+
+func valueToProto(v interface{}) (*structpb.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var pv structpb.Value
+	err = protojson.Unmarshal(out, &pv)
+	if err != nil {
+		return nil, err
+	}
+	return &pv, nil
+}
+
+func valueFromProto(pv *structpb.Value) (interface{}, error) {
+	if pv == nil {
+		return nil, nil
+	}
+
+	out, err := protojson.Marshal(pv)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	err = json.Unmarshal(out, &v)
+	return v, err
+}
+
+func timeToProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func timeFromProto(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime().Local()
+}
+
+// replyToProto converts a crawl reply into its protobuf message
+func replyToProto(r *CrawlReply) (*crawlerpb.CrawlReply, error) {
+	pc, err := crawlToProto(&r.Crawl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crawlerpb.CrawlReply{Crawl: pc, Error: errorToProto(r.Error)}, nil
+}
+
+// replyFromProto converts a protobuf reply message back into a crawl reply
+func replyFromProto(pr *crawlerpb.CrawlReply) (*CrawlReply, error) {
+	c, err := crawlFromProto(pr.Crawl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CrawlReply{Crawl: *c, Error: errorFromProto(pr.Error)}, nil
+}
+
+func errorToProto(e *Error) *crawlerpb.Error {
+	if e == nil {
+		return nil
+	}
+
+	return &crawlerpb.Error{
+		Code:      string(e.Code),
+		Message:   e.Message,
+		Retryable: e.Retryable,
+		Details:   e.Details,
+	}
+}
+
+func errorFromProto(pe *crawlerpb.Error) *Error {
+	if pe == nil {
+		return nil
+	}
+
+	return &Error{
+		Code:      ErrorCode(pe.Code),
+		Message:   pe.Message,
+		Retryable: pe.Retryable,
+		Details:   pe.Details,
+	}
+}
+
+func optionsToProto(o *CrawlOptions) *crawlerpb.CrawlOptions {
+	if o == nil {
+		return nil
+	}
+
+	po := &crawlerpb.CrawlOptions{
+		Method:     o.Method,
+		Body:       o.Body,
+		Headers:    o.Headers,
+		Cookies:    o.Cookies,
+		UserAgent:  o.UserAgent,
+		IncludeRaw: o.IncludeRaw,
+		Priority:   int32(o.Priority),
+	}
+	for _, stage := range o.Stages {
+		po.Stages = append(po.Stages, string(stage))
+	}
+	if o.Timeout > 0 {
+		po.Timeout = durationpb.New(o.Timeout)
+	}
+	return po
+}
+
+func optionsFromProto(po *crawlerpb.CrawlOptions) *CrawlOptions {
+	if po == nil {
+		return nil
+	}
+
+	o := &CrawlOptions{
+		Method:     po.Method,
+		Body:       po.Body,
+		Headers:    po.Headers,
+		Cookies:    po.Cookies,
+		UserAgent:  po.UserAgent,
+		IncludeRaw: po.IncludeRaw,
+		Priority:   int(po.Priority),
+	}
+	for _, stage := range po.Stages {
+		o.Stages = append(o.Stages, ExtractStage(stage))
+	}
+	if po.Timeout != nil {
+		o.Timeout = po.Timeout.AsDuration()
+	}
+	return o
+}
+
+func batchItemsToProto(items []BatchItem) []*crawlerpb.BatchItem {
+	pitems := make([]*crawlerpb.BatchItem, len(items))
+	for i, item := range items {
+		pitems[i] = &crawlerpb.BatchItem{
+			Id:      item.ID,
+			Url:     item.URL,
+			Options: optionsToProto(item.Options),
+		}
+	}
+	return pitems
+}
+
+func batchItemsFromProto(pitems []*crawlerpb.BatchItem) []BatchItem {
+	items := make([]BatchItem, len(pitems))
+	for i, pi := range pitems {
+		items[i] = BatchItem{
+			ID:      pi.Id,
+			URL:     pi.Url,
+			Options: optionsFromProto(pi.Options),
+		}
+	}
+	return items
+}
+
+// batchEventToProto converts a batch event into its protobuf message
+func batchEventToProto(e *BatchEvent) (*crawlerpb.BatchEvent, error) {
+	pe := &crawlerpb.BatchEvent{BatchId: e.BatchID}
+
+	switch {
+	case e.Result != nil:
+		pr := &crawlerpb.BatchResult{
+			ItemId: e.Result.ItemID,
+			Error:  errorToProto(e.Result.Error),
+		}
+
+		if e.Result.Crawl != nil {
+			pc, err := crawlToProto(e.Result.Crawl)
+			if err != nil {
+				return nil, err
+			}
+			pr.Crawl = pc
+		}
+		pe.Event = &crawlerpb.BatchEvent_Result{Result: pr}
+
+	case e.Summary != nil:
+		pe.Event = &crawlerpb.BatchEvent_Summary{Summary: &crawlerpb.BatchSummary{
+			Total:     int32(e.Summary.Total),
+			Succeeded: int32(e.Summary.Succeeded),
+			Failed:    int32(e.Summary.Failed),
+			StartTime: timeToProto(e.Summary.StartTime),
+			EndTime:   timeToProto(e.Summary.EndTime),
+		}}
+	}
+
+	return pe, nil
+}
+
+// batchEventFromProto converts a protobuf batch event back into a batch event
+func batchEventFromProto(pe *crawlerpb.BatchEvent) (*BatchEvent, error) {
+	e := &BatchEvent{BatchID: pe.BatchId}
+
+	if pr := pe.GetResult(); pr != nil {
+		e.Result = &BatchResult{
+			BatchID: pe.BatchId,
+			ItemID:  pr.ItemId,
+			Error:   errorFromProto(pr.Error),
+		}
+
+		if pr.Crawl != nil {
+			c, err := crawlFromProto(pr.Crawl)
+			if err != nil {
+				return nil, err
+			}
+			e.Result.Crawl = c
+		}
+	}
+
+	if ps := pe.GetSummary(); ps != nil {
+		e.Summary = &BatchSummary{
+			BatchID:   pe.BatchId,
+			Total:     int(ps.Total),
+			Succeeded: int(ps.Succeeded),
+			Failed:    int(ps.Failed),
+			StartTime: timeFromProto(ps.StartTime),
+			EndTime:   timeFromProto(ps.EndTime),
+		}
+	}
+
+	return e, nil
+}
@@ -11,6 +11,17 @@ import (
 	"github.com/satori/go.uuid"
 )
 
+// DefaultWorkerCount is the number of workers started when ServiceOpts does not set one
+const DefaultWorkerCount = 4
+
+// DefaultMaxQueued is how many crawls may wait for a worker when ServiceOpts does not set
+// it. Once it is reached crawls are not accepted until a worker is free
+const DefaultMaxQueued = 1000
+
+// ErrCrawlNotFound is returned when asking for the progress of a crawl the service does
+// not know about
+var ErrCrawlNotFound = NewError(CodeNotFound, "crawl not found")
+
 // The Transport is the interface for recieving and sending crawls over the
 // implmeneted methods
 type Transport interface {
@@ -20,15 +31,140 @@ type Transport interface {
 
 // CrawlRequest Sends a request to the service to crawl a page
 type CrawlRequest struct {
-	URL string
+	URL     string
+	Options *CrawlOptions `json:",omitempty"`
 }
 
 // CrawlAsyncRequest sends a request with a reply option
 type CrawlAsyncRequest struct {
-	URL   string
+	URL     string
+	Reply   string
+	Options *CrawlOptions `json:",omitempty"`
+}
+
+// CrawlOptions change how a single url is crawled
+type CrawlOptions struct {
+	// Method and Body make up the request sent for the page, a GET with no body
+	// when empty
+	Method string `json:",omitempty"`
+	Body   string `json:",omitempty"`
+
+	// Headers and Cookies are added to the request, and UserAgent replaces the
+	// default user agent
+	Headers   map[string]string `json:",omitempty"`
+	Cookies   map[string]string `json:",omitempty"`
+	UserAgent string            `json:",omitempty"`
+
+	// IncludeRaw returns the body of the page in RawData
+	IncludeRaw bool `json:",omitempty"`
+
+	// Stages limits extraction to the given stages, every stage runs when empty
+	Stages []ExtractStage `json:",omitempty"`
+
+	// Timeout limits how long the crawl may take from when it is queued, including
+	// the time spent waiting for a worker, no limit when zero
+	Timeout time.Duration `json:",omitempty"`
+
+	// Priority orders the queue of waiting crawls, higher first
+	Priority int `json:",omitempty"`
+}
+
+// ExtractStage is a part of the extraction run on a fetched page
+type ExtractStage string
+
+// The extraction stages. The title and description of a page are always extracted
+const (
+	StageLinks      ExtractStage = "links"
+	StageMetaData   ExtractStage = "metadata"
+	StageJSONLD     ExtractStage = "jsonld"
+	StageMicroData  ExtractStage = "microdata"
+	StageExtractors ExtractStage = "extractors"
+)
+
+// runs reports whether the stage should be run for a crawl with these options
+func (o *CrawlOptions) runs(stage ExtractStage) bool {
+	if o == nil || len(o.Stages) == 0 {
+		return true
+	}
+
+	for _, s := range o.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// crawlOptions picks the options passed to a variadic crawl call
+func crawlOptions(opts []CrawlOptions) (*CrawlOptions, error) {
+	switch len(opts) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &opts[0], nil
+	}
+	return nil, NewError(CodeInvalidRequest, "a crawl takes at most one CrawlOptions")
+}
+
+// requestOptions passes the options of a request on to a variadic crawl call
+func requestOptions(o *CrawlOptions) []CrawlOptions {
+	if o == nil {
+		return nil
+	}
+	return []CrawlOptions{*o}
+}
+
+// BatchItem is a url in a batch. ID is chosen by the caller and echoed on its result
+type BatchItem struct {
+	ID      string
+	URL     string
+	Options *CrawlOptions `json:",omitempty"`
+}
+
+// BatchResult is the outcome of crawling one url of a batch. Error is only set if the
+// url could not be crawled at all, a failed fetch is reported in the crawl
+type BatchResult struct {
+	BatchID string
+	ItemID  string
+	Crawl   *Crawl
+	Error   *Error `json:",omitempty"`
+}
+
+// Failed reports whether the url was not crawled successfully
+func (r *BatchResult) Failed() bool {
+	return r.Error != nil || r.Crawl == nil || r.Crawl.Error != ""
+}
+
+// BatchSummary is reported once every url in a batch has finished
+type BatchSummary struct {
+	BatchID   string
+	Total     int
+	Succeeded int
+	Failed    int
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// CrawlBatchRequest sends a batch of urls to crawl. The results and then the summary
+// are published to the reply subject
+type CrawlBatchRequest struct {
+	Items []BatchItem
 	Reply string
 }
 
+// CrawlBatchReply is the immediate reply to a batch request
+type CrawlBatchReply struct {
+	BatchID string
+	Error   *Error `json:",omitempty"`
+}
+
+// BatchEvent carries either a result or the summary of a batch to the client
+type BatchEvent struct {
+	BatchID string
+	Result  *BatchResult  `json:",omitempty"`
+	Summary *BatchSummary `json:",omitempty"`
+}
+
 // ProgressRequest asks the service how the crawl is progressing
 type ProgressRequest struct {
 	GUID string
@@ -37,24 +173,30 @@ type ProgressRequest struct {
 // CrawlReply - All requests return a crawl and an option error if something went wrong
 type CrawlReply struct {
 	Crawl Crawl
-	Error error
+	Error *Error `json:",omitempty"`
 }
 
 // The Service is the interface that must be implemented to communicate
 // with this service. It provides a means for receiving
 type Service interface {
-	// Crawl a url and return the result
-	Crawl(ctx context.Context, url string) (result *Crawl, err error)
+	// Crawl a url and return the result. The crawl is not fetched if ctx is done
+	// before a worker takes it
+	Crawl(ctx context.Context, url string, opts ...CrawlOptions) (result *Crawl, err error)
 
 	// Crawl a result and return a guid that points to an in progress crawl
-	CrawlAsync(ctx context.Context, url string, cb func(*Crawl)) (guid string, err error)
+	CrawlAsync(ctx context.Context, url string, cb func(*Crawl), opts ...CrawlOptions) (guid string, err error)
 
 	// Get the progress of a crawl.
 	CrawlProgress(ctx context.Context, guid string) (result *Crawl, err error)
+
+	// Crawl many urls and return the id of the batch. cb is called with each result as
+	// it finishes and done with the summary once every url has finished
+	CrawlBatch(ctx context.Context, items []BatchItem, cb func(*BatchResult), done func(*BatchSummary)) (batchID string, err error)
 }
 
 // The Publisher is an interface that will push out the result of a crawl to those
-// who want ictx context.Contextt
+// who want ictx context.Contextt. Crawls that failed are published too, with their
+// Error set. A FanoutPublisher sends crawls on to several publishers
 type Publisher interface {
 	Publish(crawl *Crawl) error
 }
@@ -66,16 +208,29 @@ type Listener interface {
 	Close() error
 }
 
+// An AckListener is a Listener that delivers a crawl again unless it is acknowledged
+// once it has been processed. Nak reports a crawl that could not be processed so it is
+// delivered again straight away, or given up on after too many attempts
+type AckListener interface {
+	Listener
+	Ack(crawl *Crawl) error
+	Nak(crawl *Crawl, reason error) error
+}
+
 // The Client interface is the
 type Client interface {
 	//An asynchronous request for crawling a webpage
-	CrawlAsync(ctx context.Context, url string, cb func(*Crawl)) (guid string, err error)
+	CrawlAsync(ctx context.Context, url string, cb func(*Crawl), opts ...CrawlOptions) (guid string, err error)
 
 	//A synchronous request for crawling a webpage
-	Crawl(ctx context.Context, url string) (result *Crawl, err error)
+	Crawl(ctx context.Context, url string, opts ...CrawlOptions) (result *Crawl, err error)
 
 	// Get the progress of a crawl
 	CrawlProgress(ctx context.Context, guid string) (result *Crawl, err error)
+
+	// Crawl many urls, calling cb with each result as it finishes and done with the
+	// summary of the batch
+	CrawlBatch(ctx context.Context, items []BatchItem, cb func(*BatchResult), done func(*BatchSummary)) (batchID string, err error)
 }
 
 // An Instrument is a way for the application to monitor the state of the running application
@@ -96,6 +251,7 @@ type crawler struct {
 	Open        map[string]*Crawl
 	Dispatcher  *dispatcher
 	Output      chan *Crawl
+	Events      EventSink
 	Lock        sync.RWMutex
 }
 
@@ -105,7 +261,31 @@ type ServiceOpts struct {
 	Instrument  Instrument
 	Extractors  Extractors
 	Publisher   Publisher
+	Events      EventSink
 	WorkerCount int64
+
+	// MaxQueued is how many crawls may wait for a worker, DefaultMaxQueued when zero
+	MaxQueued int
+
+	// Archiver keeps a record of every request and response, such as a WARCWriter
+	Archiver Archiver
+
+	// ContentHandlers turn each type of document into a crawl, the built in handlers
+	// are used when nil
+	ContentHandlers *ContentHandlers
+
+	// Proxies are the proxies pages are fetched through, pages are fetched directly
+	// when nil
+	Proxies *ProxyPool
+
+	// Sessions keep the cookies of each host and log in to the hosts that need it,
+	// pages are fetched without cookies when nil
+	Sessions *Sessions
+
+	// Network is the policy every address a page is fetched from is checked against.
+	// DefaultDeniedNetworks are denied when nil, and a policy built from empty
+	// NetworkOpts allows every address
+	Network *NetworkPolicy
 }
 
 // New creates the core service that will be used to crawl with
@@ -116,6 +296,8 @@ func New(opts ServiceOpts, workerFactoryInv WorkerFactoryInvoker) (Service, erro
 	var ins Instrument
 	var logger *log.Logger
 	var exes Extractors
+	var publisher Publisher
+	var events EventSink
 	var factory WorkerFactoryFunc
 
 	if opts.Instrument == nil {
@@ -136,12 +318,45 @@ func New(opts ServiceOpts, workerFactoryInv WorkerFactoryInvoker) (Service, erro
 		exes = opts.Extractors
 	}
 
+	if opts.Publisher == nil {
+		publisher = nullPublisher{}
+	} else {
+		publisher = opts.Publisher
+	}
+
+	if opts.Events == nil {
+		events = nullEventSink{}
+	} else {
+		events = opts.Events
+	}
+
+	network := opts.Network
+	if network == nil {
+		network = defaultNetworkPolicy()
+	}
+
+	workerCount := opts.WorkerCount
+	if workerCount <= 0 {
+		workerCount = DefaultWorkerCount
+	}
+
+	maxQueued := opts.MaxQueued
+	if maxQueued <= 0 {
+		maxQueued = DefaultMaxQueued
+	}
+
 	workerOpts := WorkerOpts{
 		logger:     logger,
 		extractors: exes,
 		instrument: ins,
 		results:    output,
-		publisher:  opts.Publisher,
+		publisher:  publisher,
+		events:     events,
+		archiver:   opts.Archiver,
+		handlers:   opts.ContentHandlers,
+		proxies:    opts.Proxies,
+		sessions:   opts.Sessions,
+		network:    network,
 	}
 
 	if workerFactoryInv == nil {
@@ -154,7 +369,7 @@ func New(opts ServiceOpts, workerFactoryInv WorkerFactoryInvoker) (Service, erro
 		factory = workerFactoryInv(workerOpts)
 	}
 
-	dispatcher := newDispatcher(opts.WorkerCount, queue, factory)
+	dispatcher := newDispatcher(workerCount, maxQueued, queue, factory)
 	err := dispatcher.Start()
 	if err != nil {
 		return nil, err
@@ -168,58 +383,181 @@ func New(opts ServiceOpts, workerFactoryInv WorkerFactoryInvoker) (Service, erro
 		Open:        make(map[string]*Crawl),
 		Dispatcher:  dispatcher,
 		Output:      output,
+		Events:      events,
 	}, nil
 }
 
 //An asynchronous request for crawling a webpage
-func (c *crawler) CrawlAsync(ctx context.Context, url string, cb func(*Crawl)) (guid string, err error) {
-	crawl := &Crawl{
-		URL: url,
-		sig: make(chan struct{}),
+func (c *crawler) CrawlAsync(ctx context.Context, url string, cb func(*Crawl), opts ...CrawlOptions) (guid string, err error) {
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return "", err
 	}
-	gd, err := uuid.NewV4()
-	crawl.ID = gd.String()
 
-	crawl.LoadedTime = time.Now()
-
-	c.loadCrawl(crawl)
+	crawl, err := c.newCrawl(url, o)
+	if err != nil {
+		return "", err
+	}
 
-	c.Queue <- crawl
+	c.enqueue(crawl)
 
+	// the callback runs before the crawl is unloaded so the result it records can be
+	// found by anything polling the progress of the crawl
 	go func() {
 		<-crawl.sig
-		c.unloadCrawl(crawl)
 		cb(crawl)
+		c.unloadCrawl(crawl)
 	}()
 
-	return crawl.ID, err
+	return crawl.ID, nil
 }
 
 //A synchronous request for crawling a webpage
-func (c *crawler) Crawl(ctx context.Context, url string) (result *Crawl, err error) {
+func (c *crawler) Crawl(ctx context.Context, url string, opts ...CrawlOptions) (result *Crawl, err error) {
 	log.Println(url)
-	crawl := &Crawl{
-		URL: url,
-		sig: make(chan struct{}),
+	o, err := crawlOptions(opts)
+	if err != nil {
+		return nil, err
 	}
+
+	crawl, err := c.newCrawl(url, o)
+	if err != nil {
+		return nil, err
+	}
+	crawl.ctx = ctx
+
+	c.enqueue(crawl)
+
+	select {
+	case <-crawl.sig:
+	case <-ctx.Done():
+		// the worker skips the crawl once it is taken off the queue, and still signals
+		// it is done with it
+		go func() {
+			<-crawl.sig
+			c.unloadCrawl(crawl)
+		}()
+		return nil, toError(ctx.Err())
+	}
+	c.unloadCrawl(crawl)
+
+	return crawl, nil
+}
+
+// CrawlBatch queues every url of a batch and returns straight away. The urls are
+// handed to the workers in order, and each result is passed to cb as it finishes
+func (c *crawler) CrawlBatch(ctx context.Context, items []BatchItem, cb func(*BatchResult), done func(*BatchSummary)) (batchID string, err error) {
 	gd, err := uuid.NewV4()
-	crawl.ID = gd.String()
+	if err != nil {
+		return "", err
+	}
+	batchID = gd.String()
 
-	crawl.LoadedTime = time.Now()
+	summary := &BatchSummary{
+		BatchID:   batchID,
+		Total:     len(items),
+		StartTime: time.Now(),
+	}
 
-	c.loadCrawl(crawl)
+	var mu sync.Mutex
+	var pending sync.WaitGroup
+	pending.Add(len(items))
 
-	c.Queue <- crawl
+	finish := func(r *BatchResult) {
+		mu.Lock()
+		if r.Failed() {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+		mu.Unlock()
 
-	<-crawl.sig
-	c.unloadCrawl(crawl)
+		if cb != nil {
+			cb(r)
+		}
+		pending.Done()
+	}
+
+	go func() {
+		for _, item := range items {
+			result := &BatchResult{BatchID: batchID, ItemID: item.ID}
+
+			if item.URL == "" {
+				result.Error = NewError(CodeInvalidRequest, "a url to crawl is required")
+				finish(result)
+				continue
+			}
+
+			crawl, err := c.newCrawl(item.URL, item.Options)
+			if err != nil {
+				result.Error = toError(err)
+				finish(result)
+				continue
+			}
+
+			c.enqueue(crawl)
+
+			go func(crawl *Crawl, result *BatchResult) {
+				<-crawl.sig
+				c.unloadCrawl(crawl)
+				result.Crawl = crawl
+				finish(result)
+			}(crawl, result)
+		}
+
+		pending.Wait()
+		summary.EndTime = time.Now()
+		if done != nil {
+			done(summary)
+		}
+	}()
+
+	return batchID, nil
+}
+
+// newCrawl creates a crawl of the url that is ready to be queued
+func (c *crawler) newCrawl(url string, opts *CrawlOptions) (*Crawl, error) {
+	gd, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
 
-	return crawl, err
+	return &Crawl{
+		URL:        url,
+		ID:         gd.String(),
+		LoadedTime: time.Now(),
+		sig:        make(chan struct{}),
+		opts:       opts,
+	}, nil
+}
+
+// enqueue records the crawl as open and waits for a worker to take it
+func (c *crawler) enqueue(crawl *Crawl) {
+	c.loadCrawl(crawl)
+	c.Events.Emit(newEvent(CrawlQueued, crawl))
+	c.Queue <- crawl
 }
 
-// Get the progress of a crawl
+// Get the progress of a crawl. Only crawls that are still in progress are known to
+// the service, a finished crawl has been handed back to whoever requested it
 func (c *crawler) CrawlProgress(ctx context.Context, guid string) (result *Crawl, err error) {
-	return nil, nil
+	crawl := c.getCrawl(guid)
+	if crawl == nil {
+		return nil, ErrCrawlNotFound
+	}
+
+	return &Crawl{
+		URL:        crawl.URL,
+		ID:         crawl.ID,
+		LoadedTime: crawl.LoadedTime,
+	}, nil
+}
+
+// nullPublisher is used when the service is not given a publisher and drops every crawl
+type nullPublisher struct{}
+
+func (nullPublisher) Publish(crawl *Crawl) error {
+	return nil
 }
 
 func (c *crawler) getCrawl(guid string) *Crawl {
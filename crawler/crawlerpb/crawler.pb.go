@@ -0,0 +1,1616 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: crawler.proto
+
+package crawlerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CrawlEvent_Stage int32
+
+const (
+	CrawlEvent_STAGE_UNSPECIFIED CrawlEvent_Stage = 0
+	// The crawl has been accepted and is waiting for a worker
+	CrawlEvent_STAGE_QUEUED CrawlEvent_Stage = 1
+	// The crawl finished and the crawl field holds the result
+	CrawlEvent_STAGE_COMPLETED CrawlEvent_Stage = 2
+	// The crawl finished with an error, the crawl field holds what was collected
+	CrawlEvent_STAGE_FAILED CrawlEvent_Stage = 3
+	// A worker has started fetching the page
+	CrawlEvent_STAGE_FETCH_STARTED CrawlEvent_Stage = 4
+	// The page has been fetched, status_code and bytes describe the response
+	CrawlEvent_STAGE_FETCHED CrawlEvent_Stage = 5
+	// The content of the page has been extracted
+	CrawlEvent_STAGE_EXTRACTED CrawlEvent_Stage = 6
+	// The finished crawl has been published to the message bus
+	CrawlEvent_STAGE_PUBLISHED CrawlEvent_Stage = 7
+)
+
+// Enum value maps for CrawlEvent_Stage.
+var (
+	CrawlEvent_Stage_name = map[int32]string{
+		0: "STAGE_UNSPECIFIED",
+		1: "STAGE_QUEUED",
+		2: "STAGE_COMPLETED",
+		3: "STAGE_FAILED",
+		4: "STAGE_FETCH_STARTED",
+		5: "STAGE_FETCHED",
+		6: "STAGE_EXTRACTED",
+		7: "STAGE_PUBLISHED",
+	}
+	CrawlEvent_Stage_value = map[string]int32{
+		"STAGE_UNSPECIFIED":   0,
+		"STAGE_QUEUED":        1,
+		"STAGE_COMPLETED":     2,
+		"STAGE_FAILED":        3,
+		"STAGE_FETCH_STARTED": 4,
+		"STAGE_FETCHED":       5,
+		"STAGE_EXTRACTED":     6,
+		"STAGE_PUBLISHED":     7,
+	}
+)
+
+func (x CrawlEvent_Stage) Enum() *CrawlEvent_Stage {
+	p := new(CrawlEvent_Stage)
+	*p = x
+	return p
+}
+
+func (x CrawlEvent_Stage) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CrawlEvent_Stage) Descriptor() protoreflect.EnumDescriptor {
+	return file_crawler_proto_enumTypes[0].Descriptor()
+}
+
+func (CrawlEvent_Stage) Type() protoreflect.EnumType {
+	return &file_crawler_proto_enumTypes[0]
+}
+
+func (x CrawlEvent_Stage) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CrawlEvent_Stage.Descriptor instead.
+func (CrawlEvent_Stage) EnumDescriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{14, 0}
+}
+
+type CrawlRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Url   string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	// An optional id chosen by the caller that is echoed on every event for the crawl
+	RequestId     string        `protobuf:"bytes,2,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Options       *CrawlOptions `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrawlRequest) Reset() {
+	*x = CrawlRequest{}
+	mi := &file_crawler_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrawlRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrawlRequest) ProtoMessage() {}
+
+func (x *CrawlRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrawlRequest.ProtoReflect.Descriptor instead.
+func (*CrawlRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CrawlRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CrawlRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *CrawlRequest) GetOptions() *CrawlOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+// Options that change how a single url is crawled
+type CrawlOptions struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// How long fetching the page may take, no limit when unset
+	Timeout *durationpb.Duration `protobuf:"bytes,1,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	// The request sent for the page, a GET with no body when unset
+	Method    string            `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
+	Body      string            `protobuf:"bytes,3,opt,name=body,proto3" json:"body,omitempty"`
+	Headers   map[string]string `protobuf:"bytes,4,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Cookies   map[string]string `protobuf:"bytes,5,rep,name=cookies,proto3" json:"cookies,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	UserAgent string            `protobuf:"bytes,6,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	// Whether the body of the page is returned in raw_data
+	IncludeRaw bool `protobuf:"varint,7,opt,name=include_raw,json=includeRaw,proto3" json:"include_raw,omitempty"`
+	// The extraction stages to run, all of them when empty
+	Stages []string `protobuf:"bytes,8,rep,name=stages,proto3" json:"stages,omitempty"`
+	// Crawls with a higher priority are handed to a worker first
+	Priority      int32 `protobuf:"varint,9,opt,name=priority,proto3" json:"priority,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrawlOptions) Reset() {
+	*x = CrawlOptions{}
+	mi := &file_crawler_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrawlOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrawlOptions) ProtoMessage() {}
+
+func (x *CrawlOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrawlOptions.ProtoReflect.Descriptor instead.
+func (*CrawlOptions) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CrawlOptions) GetTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.Timeout
+	}
+	return nil
+}
+
+func (x *CrawlOptions) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *CrawlOptions) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+func (x *CrawlOptions) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *CrawlOptions) GetCookies() map[string]string {
+	if x != nil {
+		return x.Cookies
+	}
+	return nil
+}
+
+func (x *CrawlOptions) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+func (x *CrawlOptions) GetIncludeRaw() bool {
+	if x != nil {
+		return x.IncludeRaw
+	}
+	return false
+}
+
+func (x *CrawlOptions) GetStages() []string {
+	if x != nil {
+		return x.Stages
+	}
+	return nil
+}
+
+func (x *CrawlOptions) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+// A url in a batch. The id is chosen by the caller and echoed on its result
+type BatchItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	Options       *CrawlOptions          `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchItem) Reset() {
+	*x = BatchItem{}
+	mi := &file_crawler_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchItem) ProtoMessage() {}
+
+func (x *BatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchItem.ProtoReflect.Descriptor instead.
+func (*BatchItem) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchItem) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *BatchItem) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *BatchItem) GetOptions() *CrawlOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type BatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Items []*BatchItem           `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	// The subject results are published to when the batch is sent over the message bus
+	Reply         string `protobuf:"bytes,2,opt,name=reply,proto3" json:"reply,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_crawler_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchRequest) GetItems() []*BatchItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *BatchRequest) GetReply() string {
+	if x != nil {
+		return x.Reply
+	}
+	return ""
+}
+
+// The reply to a batch sent over the message bus
+type BatchReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BatchId       string                 `protobuf:"bytes,1,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	Error         *Error                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchReply) Reset() {
+	*x = BatchReply{}
+	mi := &file_crawler_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchReply) ProtoMessage() {}
+
+func (x *BatchReply) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchReply.ProtoReflect.Descriptor instead.
+func (*BatchReply) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchReply) GetBatchId() string {
+	if x != nil {
+		return x.BatchId
+	}
+	return ""
+}
+
+func (x *BatchReply) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+type BatchResult struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	ItemId string                 `protobuf:"bytes,1,opt,name=item_id,json=itemId,proto3" json:"item_id,omitempty"`
+	Crawl  *Crawl                 `protobuf:"bytes,2,opt,name=crawl,proto3" json:"crawl,omitempty"`
+	// Set when the url could not be crawled at all, a crawl that failed to fetch or
+	// extract has its error in the crawl instead
+	Error         *Error `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResult) Reset() {
+	*x = BatchResult{}
+	mi := &file_crawler_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResult) ProtoMessage() {}
+
+func (x *BatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResult.ProtoReflect.Descriptor instead.
+func (*BatchResult) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *BatchResult) GetItemId() string {
+	if x != nil {
+		return x.ItemId
+	}
+	return ""
+}
+
+func (x *BatchResult) GetCrawl() *Crawl {
+	if x != nil {
+		return x.Crawl
+	}
+	return nil
+}
+
+func (x *BatchResult) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+type BatchSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Total         int32                  `protobuf:"varint,1,opt,name=total,proto3" json:"total,omitempty"`
+	Succeeded     int32                  `protobuf:"varint,2,opt,name=succeeded,proto3" json:"succeeded,omitempty"`
+	Failed        int32                  `protobuf:"varint,3,opt,name=failed,proto3" json:"failed,omitempty"`
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchSummary) Reset() {
+	*x = BatchSummary{}
+	mi := &file_crawler_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchSummary) ProtoMessage() {}
+
+func (x *BatchSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchSummary.ProtoReflect.Descriptor instead.
+func (*BatchSummary) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchSummary) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *BatchSummary) GetSucceeded() int32 {
+	if x != nil {
+		return x.Succeeded
+	}
+	return 0
+}
+
+func (x *BatchSummary) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *BatchSummary) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *BatchSummary) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+type BatchEvent struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	BatchId string                 `protobuf:"bytes,1,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*BatchEvent_Result
+	//	*BatchEvent_Summary
+	Event         isBatchEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchEvent) Reset() {
+	*x = BatchEvent{}
+	mi := &file_crawler_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchEvent) ProtoMessage() {}
+
+func (x *BatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchEvent.ProtoReflect.Descriptor instead.
+func (*BatchEvent) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BatchEvent) GetBatchId() string {
+	if x != nil {
+		return x.BatchId
+	}
+	return ""
+}
+
+func (x *BatchEvent) GetEvent() isBatchEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *BatchEvent) GetResult() *BatchResult {
+	if x != nil {
+		if x, ok := x.Event.(*BatchEvent_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+func (x *BatchEvent) GetSummary() *BatchSummary {
+	if x != nil {
+		if x, ok := x.Event.(*BatchEvent_Summary); ok {
+			return x.Summary
+		}
+	}
+	return nil
+}
+
+type isBatchEvent_Event interface {
+	isBatchEvent_Event()
+}
+
+type BatchEvent_Result struct {
+	Result *BatchResult `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+type BatchEvent_Summary struct {
+	Summary *BatchSummary `protobuf:"bytes,3,opt,name=summary,proto3,oneof"`
+}
+
+func (*BatchEvent_Result) isBatchEvent_Event() {}
+
+func (*BatchEvent_Summary) isBatchEvent_Event() {}
+
+// An asynchronous crawl request sent over the message bus. The finished crawl is
+// published to the reply subject
+type CrawlAsyncRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Reply         string                 `protobuf:"bytes,2,opt,name=reply,proto3" json:"reply,omitempty"`
+	Options       *CrawlOptions          `protobuf:"bytes,3,opt,name=options,proto3" json:"options,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrawlAsyncRequest) Reset() {
+	*x = CrawlAsyncRequest{}
+	mi := &file_crawler_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrawlAsyncRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrawlAsyncRequest) ProtoMessage() {}
+
+func (x *CrawlAsyncRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrawlAsyncRequest.ProtoReflect.Descriptor instead.
+func (*CrawlAsyncRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CrawlAsyncRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CrawlAsyncRequest) GetReply() string {
+	if x != nil {
+		return x.Reply
+	}
+	return ""
+}
+
+func (x *CrawlAsyncRequest) GetOptions() *CrawlOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+type ProgressRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProgressRequest) Reset() {
+	*x = ProgressRequest{}
+	mi := &file_crawler_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProgressRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProgressRequest) ProtoMessage() {}
+
+func (x *ProgressRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProgressRequest.ProtoReflect.Descriptor instead.
+func (*ProgressRequest) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ProgressRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CrawlReply struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Crawl *Crawl                 `protobuf:"bytes,1,opt,name=crawl,proto3" json:"crawl,omitempty"`
+	// Set when a reply is sent over the message bus and the request failed. Over gRPC
+	// the error is attached to the status instead
+	Error         *Error `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrawlReply) Reset() {
+	*x = CrawlReply{}
+	mi := &file_crawler_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrawlReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrawlReply) ProtoMessage() {}
+
+func (x *CrawlReply) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrawlReply.ProtoReflect.Descriptor instead.
+func (*CrawlReply) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CrawlReply) GetCrawl() *Crawl {
+	if x != nil {
+		return x.Crawl
+	}
+	return nil
+}
+
+func (x *CrawlReply) GetError() *Error {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+// The result of fetching a page. harvested_data, micro_data, meta_data and json_data
+// hold whatever the extractors produced so they are carried as JSON values
+type Crawl struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	PageHash      string                 `protobuf:"bytes,3,opt,name=page_hash,json=pageHash,proto3" json:"page_hash,omitempty"`
+	LoadedTime    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=loaded_time,json=loadedTime,proto3" json:"loaded_time,omitempty"`
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	FetchTime     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=fetch_time,json=fetchTime,proto3" json:"fetch_time,omitempty"`
+	ExtractTime   *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=extract_time,json=extractTime,proto3" json:"extract_time,omitempty"`
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	Title         string                 `protobuf:"bytes,9,opt,name=title,proto3" json:"title,omitempty"`
+	Description   string                 `protobuf:"bytes,10,opt,name=description,proto3" json:"description,omitempty"`
+	HarvestedUrls []string               `protobuf:"bytes,11,rep,name=harvested_urls,json=harvestedUrls,proto3" json:"harvested_urls,omitempty"`
+	HarvestedData *structpb.Value        `protobuf:"bytes,12,opt,name=harvested_data,json=harvestedData,proto3" json:"harvested_data,omitempty"`
+	MicroData     *structpb.Value        `protobuf:"bytes,13,opt,name=micro_data,json=microData,proto3" json:"micro_data,omitempty"`
+	MetaData      *structpb.Struct       `protobuf:"bytes,14,opt,name=meta_data,json=metaData,proto3" json:"meta_data,omitempty"`
+	JsonData      []*structpb.Value      `protobuf:"bytes,15,rep,name=json_data,json=jsonData,proto3" json:"json_data,omitempty"`
+	RawData       string                 `protobuf:"bytes,16,opt,name=raw_data,json=rawData,proto3" json:"raw_data,omitempty"`
+	Validation    []*Validation          `protobuf:"bytes,17,rep,name=validation,proto3" json:"validation,omitempty"`
+	Error         string                 `protobuf:"bytes,18,opt,name=error,proto3" json:"error,omitempty"`
+	ErrorCode     string                 `protobuf:"bytes,19,opt,name=error_code,json=errorCode,proto3" json:"error_code,omitempty"`
+	// The media type the page was served with
+	ContentType string `protobuf:"bytes,20,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// The proxy the page was fetched through, without its password
+	Proxy         string `protobuf:"bytes,21,opt,name=proxy,proto3" json:"proxy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Crawl) Reset() {
+	*x = Crawl{}
+	mi := &file_crawler_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Crawl) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Crawl) ProtoMessage() {}
+
+func (x *Crawl) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Crawl.ProtoReflect.Descriptor instead.
+func (*Crawl) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Crawl) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Crawl) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Crawl) GetPageHash() string {
+	if x != nil {
+		return x.PageHash
+	}
+	return ""
+}
+
+func (x *Crawl) GetLoadedTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LoadedTime
+	}
+	return nil
+}
+
+func (x *Crawl) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *Crawl) GetFetchTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FetchTime
+	}
+	return nil
+}
+
+func (x *Crawl) GetExtractTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExtractTime
+	}
+	return nil
+}
+
+func (x *Crawl) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *Crawl) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Crawl) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Crawl) GetHarvestedUrls() []string {
+	if x != nil {
+		return x.HarvestedUrls
+	}
+	return nil
+}
+
+func (x *Crawl) GetHarvestedData() *structpb.Value {
+	if x != nil {
+		return x.HarvestedData
+	}
+	return nil
+}
+
+func (x *Crawl) GetMicroData() *structpb.Value {
+	if x != nil {
+		return x.MicroData
+	}
+	return nil
+}
+
+func (x *Crawl) GetMetaData() *structpb.Struct {
+	if x != nil {
+		return x.MetaData
+	}
+	return nil
+}
+
+func (x *Crawl) GetJsonData() []*structpb.Value {
+	if x != nil {
+		return x.JsonData
+	}
+	return nil
+}
+
+func (x *Crawl) GetRawData() string {
+	if x != nil {
+		return x.RawData
+	}
+	return ""
+}
+
+func (x *Crawl) GetValidation() []*Validation {
+	if x != nil {
+		return x.Validation
+	}
+	return nil
+}
+
+func (x *Crawl) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Crawl) GetErrorCode() string {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ""
+}
+
+func (x *Crawl) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Crawl) GetProxy() string {
+	if x != nil {
+		return x.Proxy
+	}
+	return ""
+}
+
+type Validation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Rule          string                 `protobuf:"bytes,2,opt,name=rule,proto3" json:"rule,omitempty"`
+	Valid         bool                   `protobuf:"varint,3,opt,name=valid,proto3" json:"valid,omitempty"`
+	Errors        []*FieldError          `protobuf:"bytes,4,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Validation) Reset() {
+	*x = Validation{}
+	mi := &file_crawler_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Validation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Validation) ProtoMessage() {}
+
+func (x *Validation) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Validation.ProtoReflect.Descriptor instead.
+func (*Validation) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Validation) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Validation) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *Validation) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+func (x *Validation) GetErrors() []*FieldError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type FieldError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Constraint    string                 `protobuf:"bytes,2,opt,name=constraint,proto3" json:"constraint,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FieldError) Reset() {
+	*x = FieldError{}
+	mi := &file_crawler_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FieldError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldError) ProtoMessage() {}
+
+func (x *FieldError) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldError.ProtoReflect.Descriptor instead.
+func (*FieldError) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *FieldError) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *FieldError) GetConstraint() string {
+	if x != nil {
+		return x.Constraint
+	}
+	return ""
+}
+
+func (x *FieldError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type CrawlEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stage         CrawlEvent_Stage       `protobuf:"varint,1,opt,name=stage,proto3,enum=crawl3.crawler.v1.CrawlEvent_Stage" json:"stage,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Url           string                 `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
+	RequestId     string                 `protobuf:"bytes,4,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	Crawl         *Crawl                 `protobuf:"bytes,6,opt,name=crawl,proto3" json:"crawl,omitempty"`
+	Host          string                 `protobuf:"bytes,7,opt,name=host,proto3" json:"host,omitempty"`
+	StatusCode    int32                  `protobuf:"varint,8,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Bytes         int64                  `protobuf:"varint,9,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Error         string                 `protobuf:"bytes,10,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CrawlEvent) Reset() {
+	*x = CrawlEvent{}
+	mi := &file_crawler_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CrawlEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CrawlEvent) ProtoMessage() {}
+
+func (x *CrawlEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CrawlEvent.ProtoReflect.Descriptor instead.
+func (*CrawlEvent) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *CrawlEvent) GetStage() CrawlEvent_Stage {
+	if x != nil {
+		return x.Stage
+	}
+	return CrawlEvent_STAGE_UNSPECIFIED
+}
+
+func (x *CrawlEvent) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CrawlEvent) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *CrawlEvent) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *CrawlEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *CrawlEvent) GetCrawl() *Crawl {
+	if x != nil {
+		return x.Crawl
+	}
+	return nil
+}
+
+func (x *CrawlEvent) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *CrawlEvent) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *CrawlEvent) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *CrawlEvent) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Error is attached to the status of every failed call so clients can recover the code
+// and whether the call is worth retrying
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Retryable     bool                   `protobuf:"varint,3,opt,name=retryable,proto3" json:"retryable,omitempty"`
+	Details       map[string]string      `protobuf:"bytes,4,rep,name=details,proto3" json:"details,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_crawler_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_crawler_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_crawler_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *Error) GetDetails() map[string]string {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+var File_crawler_proto protoreflect.FileDescriptor
+
+const file_crawler_proto_rawDesc = "" +
+	"\n" +
+	"\rcrawler.proto\x12\x11crawl3.crawler.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"z\n" +
+	"\fCrawlRequest\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x02 \x01(\tR\trequestId\x129\n" +
+	"\aoptions\x18\x03 \x01(\v2\x1f.crawl3.crawler.v1.CrawlOptionsR\aoptions\"\xeb\x03\n" +
+	"\fCrawlOptions\x123\n" +
+	"\atimeout\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\atimeout\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\x12\x12\n" +
+	"\x04body\x18\x03 \x01(\tR\x04body\x12F\n" +
+	"\aheaders\x18\x04 \x03(\v2,.crawl3.crawler.v1.CrawlOptions.HeadersEntryR\aheaders\x12F\n" +
+	"\acookies\x18\x05 \x03(\v2,.crawl3.crawler.v1.CrawlOptions.CookiesEntryR\acookies\x12\x1d\n" +
+	"\n" +
+	"user_agent\x18\x06 \x01(\tR\tuserAgent\x12\x1f\n" +
+	"\vinclude_raw\x18\a \x01(\bR\n" +
+	"includeRaw\x12\x16\n" +
+	"\x06stages\x18\b \x03(\tR\x06stages\x12\x1a\n" +
+	"\bpriority\x18\t \x01(\x05R\bpriority\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\x1a:\n" +
+	"\fCookiesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"h\n" +
+	"\tBatchItem\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x129\n" +
+	"\aoptions\x18\x03 \x01(\v2\x1f.crawl3.crawler.v1.CrawlOptionsR\aoptions\"X\n" +
+	"\fBatchRequest\x122\n" +
+	"\x05items\x18\x01 \x03(\v2\x1c.crawl3.crawler.v1.BatchItemR\x05items\x12\x14\n" +
+	"\x05reply\x18\x02 \x01(\tR\x05reply\"W\n" +
+	"\n" +
+	"BatchReply\x12\x19\n" +
+	"\bbatch_id\x18\x01 \x01(\tR\abatchId\x12.\n" +
+	"\x05error\x18\x02 \x01(\v2\x18.crawl3.crawler.v1.ErrorR\x05error\"\x86\x01\n" +
+	"\vBatchResult\x12\x17\n" +
+	"\aitem_id\x18\x01 \x01(\tR\x06itemId\x12.\n" +
+	"\x05crawl\x18\x02 \x01(\v2\x18.crawl3.crawler.v1.CrawlR\x05crawl\x12.\n" +
+	"\x05error\x18\x03 \x01(\v2\x18.crawl3.crawler.v1.ErrorR\x05error\"\xcc\x01\n" +
+	"\fBatchSummary\x12\x14\n" +
+	"\x05total\x18\x01 \x01(\x05R\x05total\x12\x1c\n" +
+	"\tsucceeded\x18\x02 \x01(\x05R\tsucceeded\x12\x16\n" +
+	"\x06failed\x18\x03 \x01(\x05R\x06failed\x129\n" +
+	"\n" +
+	"start_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x125\n" +
+	"\bend_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\"\xa7\x01\n" +
+	"\n" +
+	"BatchEvent\x12\x19\n" +
+	"\bbatch_id\x18\x01 \x01(\tR\abatchId\x128\n" +
+	"\x06result\x18\x02 \x01(\v2\x1e.crawl3.crawler.v1.BatchResultH\x00R\x06result\x12;\n" +
+	"\asummary\x18\x03 \x01(\v2\x1f.crawl3.crawler.v1.BatchSummaryH\x00R\asummaryB\a\n" +
+	"\x05event\"v\n" +
+	"\x11CrawlAsyncRequest\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x14\n" +
+	"\x05reply\x18\x02 \x01(\tR\x05reply\x129\n" +
+	"\aoptions\x18\x03 \x01(\v2\x1f.crawl3.crawler.v1.CrawlOptionsR\aoptions\"!\n" +
+	"\x0fProgressRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"l\n" +
+	"\n" +
+	"CrawlReply\x12.\n" +
+	"\x05crawl\x18\x01 \x01(\v2\x18.crawl3.crawler.v1.CrawlR\x05crawl\x12.\n" +
+	"\x05error\x18\x02 \x01(\v2\x18.crawl3.crawler.v1.ErrorR\x05error\"\xf7\x06\n" +
+	"\x05Crawl\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x1b\n" +
+	"\tpage_hash\x18\x03 \x01(\tR\bpageHash\x12;\n" +
+	"\vloaded_time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"loadedTime\x129\n" +
+	"\n" +
+	"start_time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x129\n" +
+	"\n" +
+	"fetch_time\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tfetchTime\x12=\n" +
+	"\fextract_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\vextractTime\x125\n" +
+	"\bend_time\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x14\n" +
+	"\x05title\x18\t \x01(\tR\x05title\x12 \n" +
+	"\vdescription\x18\n" +
+	" \x01(\tR\vdescription\x12%\n" +
+	"\x0eharvested_urls\x18\v \x03(\tR\rharvestedUrls\x12=\n" +
+	"\x0eharvested_data\x18\f \x01(\v2\x16.google.protobuf.ValueR\rharvestedData\x125\n" +
+	"\n" +
+	"micro_data\x18\r \x01(\v2\x16.google.protobuf.ValueR\tmicroData\x124\n" +
+	"\tmeta_data\x18\x0e \x01(\v2\x17.google.protobuf.StructR\bmetaData\x123\n" +
+	"\tjson_data\x18\x0f \x03(\v2\x16.google.protobuf.ValueR\bjsonData\x12\x19\n" +
+	"\braw_data\x18\x10 \x01(\tR\arawData\x12=\n" +
+	"\n" +
+	"validation\x18\x11 \x03(\v2\x1d.crawl3.crawler.v1.ValidationR\n" +
+	"validation\x12\x14\n" +
+	"\x05error\x18\x12 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"error_code\x18\x13 \x01(\tR\terrorCode\x12!\n" +
+	"\fcontent_type\x18\x14 \x01(\tR\vcontentType\x12\x14\n" +
+	"\x05proxy\x18\x15 \x01(\tR\x05proxy\"\x81\x01\n" +
+	"\n" +
+	"Validation\x12\x12\n" +
+	"\x04host\x18\x01 \x01(\tR\x04host\x12\x12\n" +
+	"\x04rule\x18\x02 \x01(\tR\x04rule\x12\x14\n" +
+	"\x05valid\x18\x03 \x01(\bR\x05valid\x125\n" +
+	"\x06errors\x18\x04 \x03(\v2\x1d.crawl3.crawler.v1.FieldErrorR\x06errors\"\\\n" +
+	"\n" +
+	"FieldError\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x1e\n" +
+	"\n" +
+	"constraint\x18\x02 \x01(\tR\n" +
+	"constraint\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"\xf9\x03\n" +
+	"\n" +
+	"CrawlEvent\x129\n" +
+	"\x05stage\x18\x01 \x01(\x0e2#.crawl3.crawler.v1.CrawlEvent.StageR\x05stage\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x10\n" +
+	"\x03url\x18\x03 \x01(\tR\x03url\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x04 \x01(\tR\trequestId\x12.\n" +
+	"\x04time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12.\n" +
+	"\x05crawl\x18\x06 \x01(\v2\x18.crawl3.crawler.v1.CrawlR\x05crawl\x12\x12\n" +
+	"\x04host\x18\a \x01(\tR\x04host\x12\x1f\n" +
+	"\vstatus_code\x18\b \x01(\x05R\n" +
+	"statusCode\x12\x14\n" +
+	"\x05bytes\x18\t \x01(\x03R\x05bytes\x12\x14\n" +
+	"\x05error\x18\n" +
+	" \x01(\tR\x05error\"\xad\x01\n" +
+	"\x05Stage\x12\x15\n" +
+	"\x11STAGE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fSTAGE_QUEUED\x10\x01\x12\x13\n" +
+	"\x0fSTAGE_COMPLETED\x10\x02\x12\x10\n" +
+	"\fSTAGE_FAILED\x10\x03\x12\x17\n" +
+	"\x13STAGE_FETCH_STARTED\x10\x04\x12\x11\n" +
+	"\rSTAGE_FETCHED\x10\x05\x12\x13\n" +
+	"\x0fSTAGE_EXTRACTED\x10\x06\x12\x13\n" +
+	"\x0fSTAGE_PUBLISHED\x10\a\"\xd0\x01\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1c\n" +
+	"\tretryable\x18\x03 \x01(\bR\tretryable\x12?\n" +
+	"\adetails\x18\x04 \x03(\v2%.crawl3.crawler.v1.Error.DetailsEntryR\adetails\x1a:\n" +
+	"\fDetailsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x012\x99\x03\n" +
+	"\fCrawlService\x12G\n" +
+	"\x05Crawl\x12\x1f.crawl3.crawler.v1.CrawlRequest\x1a\x1d.crawl3.crawler.v1.CrawlReply\x12R\n" +
+	"\rCrawlProgress\x12\".crawl3.crawler.v1.ProgressRequest\x1a\x1d.crawl3.crawler.v1.CrawlReply\x12I\n" +
+	"\x05Watch\x12\x1f.crawl3.crawler.v1.CrawlRequest\x1a\x1d.crawl3.crawler.v1.CrawlEvent0\x01\x12Q\n" +
+	"\vCrawlStream\x12\x1f.crawl3.crawler.v1.CrawlRequest\x1a\x1d.crawl3.crawler.v1.CrawlEvent(\x010\x01\x12N\n" +
+	"\n" +
+	"CrawlBatch\x12\x1f.crawl3.crawler.v1.BatchRequest\x1a\x1d.crawl3.crawler.v1.BatchEvent0\x01BV\n" +
+	"!com.samjohnduke.crawl3.crawler.v1P\x01Z/github.com/samjohnduke/crawl3/crawler/crawlerpbb\x06proto3"
+
+var (
+	file_crawler_proto_rawDescOnce sync.Once
+	file_crawler_proto_rawDescData []byte
+)
+
+func file_crawler_proto_rawDescGZIP() []byte {
+	file_crawler_proto_rawDescOnce.Do(func() {
+		file_crawler_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_crawler_proto_rawDesc), len(file_crawler_proto_rawDesc)))
+	})
+	return file_crawler_proto_rawDescData
+}
+
+var file_crawler_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_crawler_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_crawler_proto_goTypes = []any{
+	(CrawlEvent_Stage)(0),         // 0: crawl3.crawler.v1.CrawlEvent.Stage
+	(*CrawlRequest)(nil),          // 1: crawl3.crawler.v1.CrawlRequest
+	(*CrawlOptions)(nil),          // 2: crawl3.crawler.v1.CrawlOptions
+	(*BatchItem)(nil),             // 3: crawl3.crawler.v1.BatchItem
+	(*BatchRequest)(nil),          // 4: crawl3.crawler.v1.BatchRequest
+	(*BatchReply)(nil),            // 5: crawl3.crawler.v1.BatchReply
+	(*BatchResult)(nil),           // 6: crawl3.crawler.v1.BatchResult
+	(*BatchSummary)(nil),          // 7: crawl3.crawler.v1.BatchSummary
+	(*BatchEvent)(nil),            // 8: crawl3.crawler.v1.BatchEvent
+	(*CrawlAsyncRequest)(nil),     // 9: crawl3.crawler.v1.CrawlAsyncRequest
+	(*ProgressRequest)(nil),       // 10: crawl3.crawler.v1.ProgressRequest
+	(*CrawlReply)(nil),            // 11: crawl3.crawler.v1.CrawlReply
+	(*Crawl)(nil),                 // 12: crawl3.crawler.v1.Crawl
+	(*Validation)(nil),            // 13: crawl3.crawler.v1.Validation
+	(*FieldError)(nil),            // 14: crawl3.crawler.v1.FieldError
+	(*CrawlEvent)(nil),            // 15: crawl3.crawler.v1.CrawlEvent
+	(*Error)(nil),                 // 16: crawl3.crawler.v1.Error
+	nil,                           // 17: crawl3.crawler.v1.CrawlOptions.HeadersEntry
+	nil,                           // 18: crawl3.crawler.v1.CrawlOptions.CookiesEntry
+	nil,                           // 19: crawl3.crawler.v1.Error.DetailsEntry
+	(*durationpb.Duration)(nil),   // 20: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil), // 21: google.protobuf.Timestamp
+	(*structpb.Value)(nil),        // 22: google.protobuf.Value
+	(*structpb.Struct)(nil),       // 23: google.protobuf.Struct
+}
+var file_crawler_proto_depIdxs = []int32{
+	2,  // 0: crawl3.crawler.v1.CrawlRequest.options:type_name -> crawl3.crawler.v1.CrawlOptions
+	20, // 1: crawl3.crawler.v1.CrawlOptions.timeout:type_name -> google.protobuf.Duration
+	17, // 2: crawl3.crawler.v1.CrawlOptions.headers:type_name -> crawl3.crawler.v1.CrawlOptions.HeadersEntry
+	18, // 3: crawl3.crawler.v1.CrawlOptions.cookies:type_name -> crawl3.crawler.v1.CrawlOptions.CookiesEntry
+	2,  // 4: crawl3.crawler.v1.BatchItem.options:type_name -> crawl3.crawler.v1.CrawlOptions
+	3,  // 5: crawl3.crawler.v1.BatchRequest.items:type_name -> crawl3.crawler.v1.BatchItem
+	16, // 6: crawl3.crawler.v1.BatchReply.error:type_name -> crawl3.crawler.v1.Error
+	12, // 7: crawl3.crawler.v1.BatchResult.crawl:type_name -> crawl3.crawler.v1.Crawl
+	16, // 8: crawl3.crawler.v1.BatchResult.error:type_name -> crawl3.crawler.v1.Error
+	21, // 9: crawl3.crawler.v1.BatchSummary.start_time:type_name -> google.protobuf.Timestamp
+	21, // 10: crawl3.crawler.v1.BatchSummary.end_time:type_name -> google.protobuf.Timestamp
+	6,  // 11: crawl3.crawler.v1.BatchEvent.result:type_name -> crawl3.crawler.v1.BatchResult
+	7,  // 12: crawl3.crawler.v1.BatchEvent.summary:type_name -> crawl3.crawler.v1.BatchSummary
+	2,  // 13: crawl3.crawler.v1.CrawlAsyncRequest.options:type_name -> crawl3.crawler.v1.CrawlOptions
+	12, // 14: crawl3.crawler.v1.CrawlReply.crawl:type_name -> crawl3.crawler.v1.Crawl
+	16, // 15: crawl3.crawler.v1.CrawlReply.error:type_name -> crawl3.crawler.v1.Error
+	21, // 16: crawl3.crawler.v1.Crawl.loaded_time:type_name -> google.protobuf.Timestamp
+	21, // 17: crawl3.crawler.v1.Crawl.start_time:type_name -> google.protobuf.Timestamp
+	21, // 18: crawl3.crawler.v1.Crawl.fetch_time:type_name -> google.protobuf.Timestamp
+	21, // 19: crawl3.crawler.v1.Crawl.extract_time:type_name -> google.protobuf.Timestamp
+	21, // 20: crawl3.crawler.v1.Crawl.end_time:type_name -> google.protobuf.Timestamp
+	22, // 21: crawl3.crawler.v1.Crawl.harvested_data:type_name -> google.protobuf.Value
+	22, // 22: crawl3.crawler.v1.Crawl.micro_data:type_name -> google.protobuf.Value
+	23, // 23: crawl3.crawler.v1.Crawl.meta_data:type_name -> google.protobuf.Struct
+	22, // 24: crawl3.crawler.v1.Crawl.json_data:type_name -> google.protobuf.Value
+	13, // 25: crawl3.crawler.v1.Crawl.validation:type_name -> crawl3.crawler.v1.Validation
+	14, // 26: crawl3.crawler.v1.Validation.errors:type_name -> crawl3.crawler.v1.FieldError
+	0,  // 27: crawl3.crawler.v1.CrawlEvent.stage:type_name -> crawl3.crawler.v1.CrawlEvent.Stage
+	21, // 28: crawl3.crawler.v1.CrawlEvent.time:type_name -> google.protobuf.Timestamp
+	12, // 29: crawl3.crawler.v1.CrawlEvent.crawl:type_name -> crawl3.crawler.v1.Crawl
+	19, // 30: crawl3.crawler.v1.Error.details:type_name -> crawl3.crawler.v1.Error.DetailsEntry
+	1,  // 31: crawl3.crawler.v1.CrawlService.Crawl:input_type -> crawl3.crawler.v1.CrawlRequest
+	10, // 32: crawl3.crawler.v1.CrawlService.CrawlProgress:input_type -> crawl3.crawler.v1.ProgressRequest
+	1,  // 33: crawl3.crawler.v1.CrawlService.Watch:input_type -> crawl3.crawler.v1.CrawlRequest
+	1,  // 34: crawl3.crawler.v1.CrawlService.CrawlStream:input_type -> crawl3.crawler.v1.CrawlRequest
+	4,  // 35: crawl3.crawler.v1.CrawlService.CrawlBatch:input_type -> crawl3.crawler.v1.BatchRequest
+	11, // 36: crawl3.crawler.v1.CrawlService.Crawl:output_type -> crawl3.crawler.v1.CrawlReply
+	11, // 37: crawl3.crawler.v1.CrawlService.CrawlProgress:output_type -> crawl3.crawler.v1.CrawlReply
+	15, // 38: crawl3.crawler.v1.CrawlService.Watch:output_type -> crawl3.crawler.v1.CrawlEvent
+	15, // 39: crawl3.crawler.v1.CrawlService.CrawlStream:output_type -> crawl3.crawler.v1.CrawlEvent
+	8,  // 40: crawl3.crawler.v1.CrawlService.CrawlBatch:output_type -> crawl3.crawler.v1.BatchEvent
+	36, // [36:41] is the sub-list for method output_type
+	31, // [31:36] is the sub-list for method input_type
+	31, // [31:31] is the sub-list for extension type_name
+	31, // [31:31] is the sub-list for extension extendee
+	0,  // [0:31] is the sub-list for field type_name
+}
+
+func init() { file_crawler_proto_init() }
+func file_crawler_proto_init() {
+	if File_crawler_proto != nil {
+		return
+	}
+	file_crawler_proto_msgTypes[7].OneofWrappers = []any{
+		(*BatchEvent_Result)(nil),
+		(*BatchEvent_Summary)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_crawler_proto_rawDesc), len(file_crawler_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   19,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_crawler_proto_goTypes,
+		DependencyIndexes: file_crawler_proto_depIdxs,
+		EnumInfos:         file_crawler_proto_enumTypes,
+		MessageInfos:      file_crawler_proto_msgTypes,
+	}.Build()
+	File_crawler_proto = out.File
+	file_crawler_proto_goTypes = nil
+	file_crawler_proto_depIdxs = nil
+}
@@ -0,0 +1,288 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: crawler.proto
+
+package crawlerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CrawlService_Crawl_FullMethodName         = "/crawl3.crawler.v1.CrawlService/Crawl"
+	CrawlService_CrawlProgress_FullMethodName = "/crawl3.crawler.v1.CrawlService/CrawlProgress"
+	CrawlService_Watch_FullMethodName         = "/crawl3.crawler.v1.CrawlService/Watch"
+	CrawlService_CrawlStream_FullMethodName   = "/crawl3.crawler.v1.CrawlService/CrawlStream"
+	CrawlService_CrawlBatch_FullMethodName    = "/crawl3.crawler.v1.CrawlService/CrawlBatch"
+)
+
+// CrawlServiceClient is the client API for CrawlService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CrawlServiceClient interface {
+	// Crawl a url and wait for the result
+	Crawl(ctx context.Context, in *CrawlRequest, opts ...grpc.CallOption) (*CrawlReply, error)
+	// Get the progress of a crawl that has not finished
+	CrawlProgress(ctx context.Context, in *ProgressRequest, opts ...grpc.CallOption) (*CrawlReply, error)
+	// Crawl a url and stream its lifecycle, ending with the finished crawl
+	Watch(ctx context.Context, in *CrawlRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CrawlEvent], error)
+	// Crawl every url sent on the stream. Events for each url are sent back as they
+	// happen and the stream is closed once the last crawl has finished
+	CrawlStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CrawlRequest, CrawlEvent], error)
+	// Crawl a batch of urls. The first event holds the batch id, then there is a result
+	// for each url as it finishes and the last event is the summary of the batch
+	CrawlBatch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchEvent], error)
+}
+
+type crawlServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCrawlServiceClient(cc grpc.ClientConnInterface) CrawlServiceClient {
+	return &crawlServiceClient{cc}
+}
+
+func (c *crawlServiceClient) Crawl(ctx context.Context, in *CrawlRequest, opts ...grpc.CallOption) (*CrawlReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CrawlReply)
+	err := c.cc.Invoke(ctx, CrawlService_Crawl_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlServiceClient) CrawlProgress(ctx context.Context, in *ProgressRequest, opts ...grpc.CallOption) (*CrawlReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CrawlReply)
+	err := c.cc.Invoke(ctx, CrawlService_CrawlProgress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *crawlServiceClient) Watch(ctx context.Context, in *CrawlRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CrawlEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CrawlService_ServiceDesc.Streams[0], CrawlService_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CrawlRequest, CrawlEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrawlService_WatchClient = grpc.ServerStreamingClient[CrawlEvent]
+
+func (c *crawlServiceClient) CrawlStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CrawlRequest, CrawlEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CrawlService_ServiceDesc.Streams[1], CrawlService_CrawlStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CrawlRequest, CrawlEvent]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrawlService_CrawlStreamClient = grpc.BidiStreamingClient[CrawlRequest, CrawlEvent]
+
+func (c *crawlServiceClient) CrawlBatch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CrawlService_ServiceDesc.Streams[2], CrawlService_CrawlBatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchRequest, BatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrawlService_CrawlBatchClient = grpc.ServerStreamingClient[BatchEvent]
+
+// CrawlServiceServer is the server API for CrawlService service.
+// All implementations must embed UnimplementedCrawlServiceServer
+// for forward compatibility.
+type CrawlServiceServer interface {
+	// Crawl a url and wait for the result
+	Crawl(context.Context, *CrawlRequest) (*CrawlReply, error)
+	// Get the progress of a crawl that has not finished
+	CrawlProgress(context.Context, *ProgressRequest) (*CrawlReply, error)
+	// Crawl a url and stream its lifecycle, ending with the finished crawl
+	Watch(*CrawlRequest, grpc.ServerStreamingServer[CrawlEvent]) error
+	// Crawl every url sent on the stream. Events for each url are sent back as they
+	// happen and the stream is closed once the last crawl has finished
+	CrawlStream(grpc.BidiStreamingServer[CrawlRequest, CrawlEvent]) error
+	// Crawl a batch of urls. The first event holds the batch id, then there is a result
+	// for each url as it finishes and the last event is the summary of the batch
+	CrawlBatch(*BatchRequest, grpc.ServerStreamingServer[BatchEvent]) error
+	mustEmbedUnimplementedCrawlServiceServer()
+}
+
+// UnimplementedCrawlServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCrawlServiceServer struct{}
+
+func (UnimplementedCrawlServiceServer) Crawl(context.Context, *CrawlRequest) (*CrawlReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Crawl not implemented")
+}
+func (UnimplementedCrawlServiceServer) CrawlProgress(context.Context, *ProgressRequest) (*CrawlReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CrawlProgress not implemented")
+}
+func (UnimplementedCrawlServiceServer) Watch(*CrawlRequest, grpc.ServerStreamingServer[CrawlEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedCrawlServiceServer) CrawlStream(grpc.BidiStreamingServer[CrawlRequest, CrawlEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method CrawlStream not implemented")
+}
+func (UnimplementedCrawlServiceServer) CrawlBatch(*BatchRequest, grpc.ServerStreamingServer[BatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method CrawlBatch not implemented")
+}
+func (UnimplementedCrawlServiceServer) mustEmbedUnimplementedCrawlServiceServer() {}
+func (UnimplementedCrawlServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeCrawlServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CrawlServiceServer will
+// result in compilation errors.
+type UnsafeCrawlServiceServer interface {
+	mustEmbedUnimplementedCrawlServiceServer()
+}
+
+func RegisterCrawlServiceServer(s grpc.ServiceRegistrar, srv CrawlServiceServer) {
+	// If the following call pancis, it indicates UnimplementedCrawlServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CrawlService_ServiceDesc, srv)
+}
+
+func _CrawlService_Crawl_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CrawlRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlServiceServer).Crawl(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CrawlService_Crawl_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlServiceServer).Crawl(ctx, req.(*CrawlRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CrawlService_CrawlProgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CrawlServiceServer).CrawlProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CrawlService_CrawlProgress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CrawlServiceServer).CrawlProgress(ctx, req.(*ProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CrawlService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CrawlRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CrawlServiceServer).Watch(m, &grpc.GenericServerStream[CrawlRequest, CrawlEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrawlService_WatchServer = grpc.ServerStreamingServer[CrawlEvent]
+
+func _CrawlService_CrawlStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CrawlServiceServer).CrawlStream(&grpc.GenericServerStream[CrawlRequest, CrawlEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrawlService_CrawlStreamServer = grpc.BidiStreamingServer[CrawlRequest, CrawlEvent]
+
+func _CrawlService_CrawlBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CrawlServiceServer).CrawlBatch(m, &grpc.GenericServerStream[BatchRequest, BatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CrawlService_CrawlBatchServer = grpc.ServerStreamingServer[BatchEvent]
+
+// CrawlService_ServiceDesc is the grpc.ServiceDesc for CrawlService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CrawlService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "crawl3.crawler.v1.CrawlService",
+	HandlerType: (*CrawlServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Crawl",
+			Handler:    _CrawlService_Crawl_Handler,
+		},
+		{
+			MethodName: "CrawlProgress",
+			Handler:    _CrawlService_CrawlProgress_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _CrawlService_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "CrawlStream",
+			Handler:       _CrawlService_CrawlStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "CrawlBatch",
+			Handler:       _CrawlService_CrawlBatch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "crawler.proto",
+}
@@ -0,0 +1,5 @@
+// Package crawlerpb holds the gRPC contract of the crawl service and the code generated
+// from it. Other languages can generate their own clients from crawler.proto
+package crawlerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative crawler.proto
@@ -1,9 +1,13 @@
 package crawler
 
-import "context"
+import (
+	"container/heap"
+	"context"
+)
 
 type dispatcher struct {
 	workerCount int64
+	maxQueued   int
 	workerQueue chan chan *Crawl
 	workQueue   chan *Crawl
 	workers     []Worker
@@ -11,9 +15,10 @@ type dispatcher struct {
 	newWorker   WorkerFactoryFunc
 }
 
-func newDispatcher(count int64, queue chan *Crawl, createWorkerFunc WorkerFactoryFunc) *dispatcher {
+func newDispatcher(count int64, maxQueued int, queue chan *Crawl, createWorkerFunc WorkerFactoryFunc) *dispatcher {
 	dispatcher := &dispatcher{
 		workerCount: count,
+		maxQueued:   maxQueued,
 		workerQueue: make(chan chan *Crawl, count+1),
 		workQueue:   queue,
 		workers:     []Worker{},
@@ -45,14 +50,32 @@ func (d *dispatcher) Start() error {
 	return nil
 }
 
+// Dispatcher takes crawls off the work queue and holds them until a worker is free, so
+// that waiting crawls can be handed out in order of priority. Once maxQueued crawls are
+// waiting no more are taken, and queueing a crawl blocks until a worker is free
 func (d *dispatcher) Dispatcher() {
+	pending := &crawlQueue{}
+
 	for {
+		// only wait on a free worker when there is a crawl to give it
+		var workers chan chan *Crawl
+		if pending.Len() > 0 {
+			workers = d.workerQueue
+		}
+
+		// a nil channel is never ready
+		jobs := d.workQueue
+		if pending.Len() >= d.maxQueued {
+			jobs = nil
+		}
+
 		select {
-		case job := <-d.workQueue:
+		case job := <-jobs:
 			// a job request has been received
-			jobChannel := <-d.workerQueue
-			jobChannel <- job
-			break
+			heap.Push(pending, job)
+
+		case jobChannel := <-workers:
+			jobChannel <- heap.Pop(pending).(*Crawl)
 
 		case q := <-d.quit:
 			for i := range d.workers {
@@ -2,6 +2,7 @@ package crawler
 
 import (
 	"testing"
+	"time"
 )
 
 // This test will detect contention of queuing channels
@@ -12,7 +13,7 @@ func TestSingleWorkerDispatcher(t *testing.T) {
 		return newWorkerMock(pool)
 	}
 
-	dispatcher := newDispatcher(1, queue, workerFactory)
+	dispatcher := newDispatcher(1, DefaultMaxQueued, queue, workerFactory)
 
 	err := dispatcher.Start()
 	if err != nil {
@@ -36,7 +37,7 @@ func TestMultiWorkerDispatcher(t *testing.T) {
 		return newWorkerMock(pool)
 	}
 
-	dispatcher := newDispatcher(4, queue, workerFactory)
+	dispatcher := newDispatcher(4, DefaultMaxQueued, queue, workerFactory)
 
 	err := dispatcher.Start()
 	if err != nil {
@@ -57,3 +58,37 @@ func TestMultiWorkerDispatcher(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// busyWorker never asks for a crawl, like a worker stuck on a slow page
+type busyWorker struct{}
+
+func (busyWorker) Start() error { return nil }
+func (busyWorker) Stop() error  { return nil }
+
+func TestDispatcherMaxQueued(t *testing.T) {
+	queue := make(chan *Crawl)
+
+	dispatcher := newDispatcher(1, 2, queue, func(pool chan chan *Crawl) Worker {
+		return busyWorker{}
+	})
+
+	err := dispatcher.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue <- &Crawl{URL: "first"}
+	queue <- &Crawl{URL: "second"}
+
+	// the queue is full so the next crawl has to wait for a worker
+	select {
+	case queue <- &Crawl{URL: "third"}:
+		t.Error("expected the crawl not to be taken while the queue is full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = dispatcher.Stop(nil)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// EnvelopeVersion is the version of the envelope written by this package. Readers
+// refuse envelopes from a newer version rather than guess at their layout
+const EnvelopeVersion = 1
+
+// envelopeMagic starts every envelope. Bare JSON can never start with a zero byte, which
+// is how messages from versions that predate envelopes are recognised
+var envelopeMagic = []byte{0x00, 'c', '3'}
+
+// An envelope is laid out as
+//
+//	magic (3 bytes) | version (1 byte) | header length (uvarint) | header (JSON) | body
+//
+// The header is JSON so new keys can be added without a new envelope version
+type envelopeHeader struct {
+	ContentType     string `json:"contentType"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+}
+
+// An Encoding describes how messages are written to the message bus. The zero value
+// writes JSON in an envelope without compression
+type Encoding struct {
+	// ContentType names the codec for the body, JSON when empty
+	ContentType string
+
+	// Compression names the compressor for the body, none when empty
+	Compression string
+
+	// Legacy writes bare JSON without an envelope, for peers that predate envelopes
+	Legacy bool
+}
+
+// LegacyEncoding is the bare JSON written before messages had an envelope
+var LegacyEncoding = Encoding{Legacy: true}
+
+// Encode writes a message in an envelope
+func (e Encoding) Encode(v interface{}) ([]byte, error) {
+	if e.Legacy {
+		return json.Marshal(v)
+	}
+
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+
+	codec, err := CodecFor(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Compression != "" {
+		compressor, err := CompressorFor(e.Compression)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err = compressor.Compress(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	header, err := json.Marshal(&envelopeHeader{
+		ContentType:     contentType,
+		ContentEncoding: e.Compression,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(envelopeMagic) + 1 + binary.MaxVarintLen64 + len(header) + len(body))
+	buf.Write(envelopeMagic)
+	buf.WriteByte(EnvelopeVersion)
+
+	var size [binary.MaxVarintLen64]byte
+	buf.Write(size[:binary.PutUvarint(size[:], uint64(len(header)))])
+	buf.Write(header)
+	buf.Write(body)
+
+	return buf.Bytes(), nil
+}
+
+// Decode reads a message written by Encode, or bare JSON from a version that predates
+// envelopes, and reports the encoding it was written with so a reply can match it
+func Decode(data []byte, v interface{}) (Encoding, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return LegacyEncoding, json.Unmarshal(data, v)
+	}
+
+	data = data[len(envelopeMagic):]
+	if len(data) == 0 {
+		return Encoding{}, errors.New("envelope is truncated")
+	}
+
+	version := data[0]
+	if version == 0 || version > EnvelopeVersion {
+		return Encoding{}, fmt.Errorf("unsupported envelope version %d", version)
+	}
+	data = data[1:]
+
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return Encoding{}, errors.New("envelope header is truncated")
+	}
+
+	var header envelopeHeader
+	err := json.Unmarshal(data[n:n+int(size)], &header)
+	if err != nil {
+		return Encoding{}, fmt.Errorf("invalid envelope header: %s", err)
+	}
+	body := data[n+int(size):]
+
+	enc := Encoding{ContentType: header.ContentType, Compression: header.ContentEncoding}
+
+	if header.ContentEncoding != "" {
+		compressor, err := CompressorFor(header.ContentEncoding)
+		if err != nil {
+			return enc, err
+		}
+
+		body, err = compressor.Decompress(body)
+		if err != nil {
+			return enc, err
+		}
+	}
+
+	codec, err := CodecFor(header.ContentType)
+	if err != nil {
+		return enc, err
+	}
+
+	return enc, codec.Unmarshal(body, v)
+}
@@ -0,0 +1,184 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func testEncodings() []Encoding {
+	var encodings []Encoding
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeMsgpack, ContentTypeProtobuf} {
+		for _, compression := range []string{"", CompressionGzip, CompressionZstd} {
+			encodings = append(encodings, Encoding{ContentType: contentType, Compression: compression})
+		}
+	}
+	return append(encodings, LegacyEncoding)
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	loaded := time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)
+	crawl := &Crawl{
+		URL:           "https://example.com/a",
+		ID:            "abc",
+		LoadedTime:    loaded,
+		Title:         "A page",
+		HarvestedURLs: []string{"https://example.com/b"},
+		HarvestedData: map[string]interface{}{"title": "A page", "tags": []interface{}{"x", "y"}},
+		Validation:    []Validation{{Host: "example.com", Rule: "Article", Valid: false, Errors: []FieldError{{Field: "title", Constraint: "required", Message: "missing"}}}},
+	}
+
+	for _, enc := range testEncodings() {
+		name := fmt.Sprintf("%+v", enc)
+
+		data, err := enc.Encode(crawl)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		var decoded *Crawl
+		got, err := Decode(data, &decoded)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if got.Legacy != enc.Legacy || (!enc.Legacy && (got.ContentType != enc.ContentType || got.Compression != enc.Compression)) {
+			t.Errorf("%s: decoded with encoding %+v", name, got)
+		}
+
+		if decoded.URL != crawl.URL || decoded.Title != crawl.Title || !decoded.LoadedTime.Equal(loaded) {
+			t.Errorf("%s: unexpected crawl %+v", name, decoded)
+		}
+
+		if !reflect.DeepEqual(decoded.HarvestedData, crawl.HarvestedData) || !reflect.DeepEqual(decoded.Validation, crawl.Validation) {
+			t.Errorf("%s: harvested data did not survive, got %#v %#v", name, decoded.HarvestedData, decoded.Validation)
+		}
+
+		reply := &CrawlReply{Crawl: Crawl{ID: "abc"}, Error: NewError(CodeTimeout, "slow")}
+		data, err = enc.Encode(reply)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		var decodedReply CrawlReply
+		_, err = Decode(data, &decodedReply)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if decodedReply.Crawl.ID != "abc" || decodedReply.Error == nil || decodedReply.Error.Code != CodeTimeout || !decodedReply.Error.Retryable {
+			t.Errorf("%s: unexpected reply %+v", name, decodedReply)
+		}
+	}
+}
+
+// An envelope written by a newer version of the crawler may carry header keys and body
+// fields this version does not know about, which are ignored
+func TestEnvelopeDecodeUnknownFields(t *testing.T) {
+	header := `{"contentType":"application/json","schema":"crawl/v2"}`
+	body := `{"URL":"https://example.com","ID":"abc","Priority":5}`
+
+	var data []byte
+	data = append(data, 0x00, 'c', '3', 1, byte(len(header)))
+	data = append(data, header...)
+	data = append(data, body...)
+
+	var c Crawl
+	enc, err := Decode(data, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enc.ContentType != ContentTypeJSON || c.URL != "https://example.com" || c.ID != "abc" {
+		t.Errorf("unexpected decode %+v %+v", enc, c)
+	}
+}
+
+func TestEnvelopeDecodeLegacy(t *testing.T) {
+	var req CrawlAsyncRequest
+	enc, err := Decode([]byte(`{"URL":"https://example.com","Reply":"inbox"}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !enc.Legacy || req.URL != "https://example.com" || req.Reply != "inbox" {
+		t.Errorf("unexpected decode %+v %+v", enc, req)
+	}
+}
+
+func TestEnvelopeDecodeErrors(t *testing.T) {
+	future := []byte{0x00, 'c', '3', EnvelopeVersion + 1, 2, '{', '}'}
+	unknownCodec := append([]byte{0x00, 'c', '3', 1, 23}, `{"contentType":"a/b"}{}`...)
+
+	tests := map[string][]byte{
+		"future version":     future,
+		"truncated":          {0x00, 'c', '3'},
+		"truncated header":   {0x00, 'c', '3', 1, 40, '{'},
+		"unknown codec":      unknownCodec,
+		"unknown compressor": append([]byte{0x00, 'c', '3', 1, 52}, `{"contentType":"application/json","contentEncoding":"lz"}{}`...),
+	}
+
+	for name, data := range tests {
+		var c Crawl
+		_, err := Decode(data, &c)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Clients from before envelopes send bare JSON and must get bare JSON back, while newer
+// clients can use any encoding over the same transport
+func TestNatsTransportMixedVersions(t *testing.T) {
+	ser := RunDefaultServer()
+	defer ser.Shutdown()
+
+	nc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", DefaultTestOptions.Host, DefaultTestOptions.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	transport := NewTransportNats(nc, newTestService(t, ServiceOpts{}))
+	err = transport.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Stop(context.Background())
+
+	msg, err := nc.Request("crawlProgress", []byte(`{"GUID":"not-a-crawl"}`), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.HasPrefix(msg.Data, envelopeMagic) {
+		t.Fatal("expected a bare json reply to a bare json request")
+	}
+
+	var legacy CrawlReply
+	err = json.Unmarshal(msg.Data, &legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Error == nil || legacy.Error.Code != CodeNotFound {
+		t.Errorf("unexpected legacy reply %+v", legacy)
+	}
+
+	for _, enc := range testEncodings() {
+		client := NewClientNats(nc, NatsOpts{Encoding: enc})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := client.CrawlProgress(ctx, "not-a-crawl")
+		cancel()
+
+		if err != ErrCrawlNotFound {
+			t.Errorf("%+v: expected crawl not found, got %v", enc, err)
+		}
+	}
+}
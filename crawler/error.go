@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrorCode classifies why a request to the crawl service failed. Codes are part of the
+// wire format so they never change once published
+type ErrorCode string
+
+// The codes an Error can have
+const (
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	CodeNotFound       ErrorCode = "not_found"
+	CodeUnavailable    ErrorCode = "unavailable"
+	CodeTimeout        ErrorCode = "timeout"
+	CodeCanceled       ErrorCode = "canceled"
+	CodeInternal       ErrorCode = "internal"
+
+	// CodeBlockedAddress is given to a crawl whose page is at an address the network
+	// policy of the service does not allow
+	CodeBlockedAddress ErrorCode = "blocked_address"
+)
+
+// Error is the error the crawl service replies with over every transport. Clients hand
+// it back unchanged so callers can inspect it with errors.As, and errors.Is matches any
+// Error with the same code
+type Error struct {
+	Code      ErrorCode         `json:"code"`
+	Message   string            `json:"message"`
+	Retryable bool              `json:"retryable"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// NewError creates an error with the given code. Errors that come from the service
+// being busy or slow are marked as worth retrying
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{
+		Code:      code,
+		Message:   message,
+		Retryable: code == CodeUnavailable || code == CodeTimeout,
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Is reports whether the target is an Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// toError converts an error returned by the service into the error sent over the wire
+func toError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	switch err {
+	case context.DeadlineExceeded:
+		return NewError(CodeTimeout, err.Error())
+	case context.Canceled:
+		return NewError(CodeCanceled, err.Error())
+	}
+
+	return NewError(CodeInternal, err.Error())
+}
+
+// fromError turns an error received over the wire back into the error the service
+// returned, so well known errors can still be compared directly
+func fromError(e *Error) error {
+	if e == nil {
+		return nil
+	}
+
+	if e.Code == CodeNotFound && e.Message == ErrCrawlNotFound.Message {
+		return ErrCrawlNotFound
+	}
+	return e
+}
@@ -0,0 +1,92 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorJSONRoundTrip(t *testing.T) {
+	reply := CrawlReply{
+		Crawl: Crawl{ID: "abc"},
+		Error: &Error{Code: CodeTimeout, Message: "took too long", Retryable: true, Details: map[string]string{"after": "10s"}},
+	}
+
+	out, err := json.Marshal(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded CrawlReply
+	err = json.Unmarshal(out, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Error == nil || decoded.Error.Code != CodeTimeout || !decoded.Error.Retryable || decoded.Error.Details["after"] != "10s" {
+		t.Errorf("error did not survive the round trip: %+v", decoded.Error)
+	}
+
+	out, _ = json.Marshal(CrawlReply{Crawl: Crawl{ID: "abc"}})
+	decoded = CrawlReply{}
+	json.Unmarshal(out, &decoded)
+	if decoded.Error != nil {
+		t.Errorf("expected no error, got %v", decoded.Error)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	if !errors.Is(NewError(CodeNotFound, "gone"), ErrCrawlNotFound) {
+		t.Error("expected errors with the same code to match")
+	}
+
+	if errors.Is(NewError(CodeInternal, "crawl not found"), ErrCrawlNotFound) {
+		t.Error("expected errors with different codes not to match")
+	}
+
+	if e := toError(context.DeadlineExceeded); e.Code != CodeTimeout || !e.Retryable {
+		t.Errorf("unexpected error for a deadline %+v", e)
+	}
+
+	if e := toError(errors.New("boom")); e.Code != CodeInternal || e.Retryable {
+		t.Errorf("unexpected error for an unknown error %+v", e)
+	}
+}
+
+// every client should hand back the error the service replied with
+func TestClientsReturnTypedErrors(t *testing.T) {
+	service := newTestService(t, ServiceOpts{})
+
+	transport := NewTransportHTTP("", service, HTTPOpts{})
+	server := httptest.NewServer(transport.(http.Handler))
+	defer server.Close()
+
+	grpcClient, stop := newTestGRPCClient(t, service)
+	defer stop()
+
+	clients := map[string]Client{
+		"http": NewClientHTTP(server.URL, nil),
+		"grpc": grpcClient,
+	}
+
+	for name, client := range clients {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		_, err := client.Crawl(ctx, "")
+		var e *Error
+		if !errors.As(err, &e) || e.Code != CodeInvalidRequest || e.Retryable {
+			t.Errorf("%s: expected an invalid request error, got %#v", name, err)
+		}
+
+		_, err = client.CrawlProgress(ctx, "not-a-crawl")
+		if err != ErrCrawlNotFound {
+			t.Errorf("%s: expected crawl not found, got %v", name, err)
+		}
+
+		cancel()
+	}
+}
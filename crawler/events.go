@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"strings"
+	"time"
+)
+
+// EventsSubject is the prefix of the nats subjects lifecycle events are published on,
+// below the namespace if there is one. Each host has its own subject below it, so
+// crawl_events.> follows every host
+const EventsSubject = "crawl_events"
+
+// An EventSink is told about each stage of every crawl as it happens, so the crawler can
+// be watched live. Emit is called from the workers and must not block for long
+type EventSink interface {
+	Emit(e *CrawlEvent)
+}
+
+// nullEventSink is used when the service is not given a sink and drops every event
+type nullEventSink struct{}
+
+func (nullEventSink) Emit(e *CrawlEvent) {}
+
+type eventSinkChan struct {
+	c chan<- *CrawlEvent
+}
+
+// NewEventSinkChan creates a sink that sends events on a channel. Events are dropped
+// rather than holding up a crawl when the channel is full, so give it a buffer
+func NewEventSinkChan(c chan<- *CrawlEvent) EventSink {
+	return &eventSinkChan{c: c}
+}
+
+func (s *eventSinkChan) Emit(e *CrawlEvent) {
+	select {
+	case s.c <- e:
+	default:
+	}
+}
+
+// newEvent describes a crawl reaching a stage
+func newEvent(stage CrawlStage, c *Crawl) *CrawlEvent {
+	return &CrawlEvent{
+		Stage: stage,
+		ID:    c.ID,
+		URL:   c.URL,
+		Host:  c.Host(),
+		Time:  time.Now(),
+	}
+}
+
+// failedEvent describes a crawl that stopped at err
+func failedEvent(c *Crawl, err error) *CrawlEvent {
+	e := newEvent(CrawlFailed, c)
+	e.Error = err.Error()
+	return e
+}
+
+// eventsSubject is the subject the events of a host are published on. The dots of the
+// host are replaced as nats uses them to separate the tokens of a subject
+func eventsSubject(prefix, host string) string {
+	if host == "" {
+		host = "unknown"
+	}
+	return prefix + "." + strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(host)
+}
@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"log"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+type eventSinkNats struct {
+	conn     *nats.Conn
+	enc      Encoding
+	subjects Subjects
+	err      error
+}
+
+// NewEventSinkNats creates a sink that publishes every event on the subject of its host,
+// crawl_events.www_example_com for www.example.com, below the namespace of the options
+func NewEventSinkNats(conn *nats.Conn, opts ...NatsOpts) EventSink {
+	o := natsOpts(opts)
+	subjects, err := o.subjects()
+
+	return &eventSinkNats{
+		conn:     conn,
+		enc:      o.Encoding,
+		subjects: subjects,
+		err:      err,
+	}
+}
+
+func (s *eventSinkNats) Emit(e *CrawlEvent) {
+	if s.err != nil {
+		log.Println(s.err)
+		return
+	}
+
+	d, err := s.enc.Encode(e)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	err = s.conn.Publish(eventsSubject(s.subjects.Events, e.Host), d)
+	if err != nil {
+		log.Println(err)
+	}
+}
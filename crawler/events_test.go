@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// drainEvents collects the events that have been emitted for a crawl
+func drainEvents(events chan *CrawlEvent, id string) []*CrawlEvent {
+	var out []*CrawlEvent
+	for {
+		select {
+		case e := <-events:
+			if e.ID == id {
+				out = append(out, e)
+			}
+		default:
+			return out
+		}
+	}
+}
+
+func TestCrawlLifecycleEvents(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	events := make(chan *CrawlEvent, 100)
+	service := newTestService(t, ServiceOpts{Events: NewEventSinkChan(events)})
+
+	c, err := service.Crawl(context.Background(), page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := drainEvents(events, c.ID)
+	want := []CrawlStage{CrawlQueued, CrawlFetchStarted, CrawlFetched, CrawlExtracted, CrawlPublished}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(got))
+	}
+
+	for i, e := range got {
+		if e.Stage != want[i] || e.URL != page.URL || e.Host != c.Host() {
+			t.Errorf("event %d: expected stage %s, got %+v", i, want[i], e)
+		}
+	}
+
+	if got[2].StatusCode != http.StatusOK || got[2].Bytes == 0 {
+		t.Errorf("expected the status and size of the page, got %+v", got[2])
+	}
+}
+
+func TestCrawlFailedEvents(t *testing.T) {
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	events := make(chan *CrawlEvent, 100)
+	service := newTestService(t, ServiceOpts{Events: NewEventSinkChan(events)})
+
+	c, err := service.Crawl(context.Background(), missing.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := drainEvents(events, c.ID)
+	last := got[len(got)-1]
+	if last.Stage != CrawlFailed || last.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a failed event with the status, got %+v", last)
+	}
+
+	c, err = service.Crawl(context.Background(), "http://127.0.0.1:1/unreachable")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = drainEvents(events, c.ID)
+	last = got[len(got)-1]
+	if last.Stage != CrawlFailed || last.Error == "" {
+		t.Errorf("expected a failed event with the error, got %+v", last)
+	}
+}
+
+func TestEventSinkNats(t *testing.T) {
+	ser := RunDefaultServer()
+	defer ser.Shutdown()
+
+	nc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", DefaultTestOptions.Host, DefaultTestOptions.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync(EventsSubject + ".>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+
+	for _, enc := range testEncodings() {
+		sink := NewEventSinkNats(nc, NatsOpts{Encoding: enc})
+		sink.Emit(&CrawlEvent{Stage: CrawlFetched, ID: "1", URL: "https://www.example.com/", Host: "www.example.com", StatusCode: 200, Bytes: 10})
+
+		msg, err := sub.NextMsg(5 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Subject != "crawl_events.www_example_com" {
+			t.Errorf("%+v: unexpected subject %s", enc, msg.Subject)
+		}
+
+		var e CrawlEvent
+		_, err = Decode(msg.Data, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Stage != CrawlFetched || e.ID != "1" || e.StatusCode != 200 || e.Bytes != 10 {
+			t.Errorf("%+v: unexpected event %+v", enc, e)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/iand/microdata"
+)
+
+// ExtractPage parses the body of a fetched page and runs the extractors that match its
+// host, filling in the content of the crawl. It is the same path a worker takes once a
+// page has been fetched, so saved pages can be run through a host model without
+// crawling them again
+func ExtractPage(u *Crawl, body []byte, exes Extractors, logger *log.Logger) error {
+	parsedURL, err := url.Parse(u.URL)
+	if err != nil {
+		return err
+	}
+
+	s := sha256.Sum256(body)
+	sum := hex.EncodeToString(s[:])
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	doc.Url = parsedURL
+
+	title := doc.Find("title").First().Text()
+	description, _ := doc.Find("meta[name=description]").First().Attr("content")
+
+	var normalisedUrls []string
+	if u.opts.runs(StageLinks) {
+		urls := doc.Find("a[href]").Map(func(i int, sel *goquery.Selection) string {
+			if attr, ok := sel.Attr("href"); ok {
+				return attr
+			}
+			return ""
+		})
+
+		urls2 := doc.Find("area[href]").Map(func(i int, sel *goquery.Selection) string {
+			if attr, ok := sel.Attr("href"); ok {
+				return attr
+			}
+			return ""
+		})
+
+		urls = append(urls, urls2...)
+
+		normalisedUrls = normaliseUrls(urls, u.URL)
+	}
+
+	metadata := make(map[string]interface{})
+	if u.opts.runs(StageMetaData) {
+		extractMetaData(doc, metadata)
+	}
+
+	jld := []interface{}{}
+	if u.opts.runs(StageJSONLD) {
+		doc.Find("script[type='application/ld+json']").Each(func(_ int, sel *goquery.Selection) {
+			content := sel.Text()
+			var parsedContent interface{}
+			err := json.Unmarshal([]byte(content), &parsedContent)
+			if err != nil {
+				return
+			}
+			jld = append(jld, parsedContent)
+		})
+	}
+
+	var mdata *microdata.Microdata
+	if u.opts.runs(StageMicroData) {
+		ps := microdata.NewParser(bytes.NewReader(body), parsedURL)
+		mdata, err = ps.Parse()
+		if err != nil {
+			logger.Println(err)
+			u.Error = err.Error()
+		}
+	}
+
+	var harvested []interface{}
+	var validations []Validation
+	var fncs []extractor
+	if u.opts.runs(StageExtractors) {
+		fncs = exes.Matches(parsedURL.Host)
+	}
+	for _, fn := range fncs {
+		var h interface{}
+		var err error
+
+		if vfn, ok := fn.(validatingExtractor); ok {
+			var vs []Validation
+			h, vs, err = vfn.ExtractValidated(doc)
+			validations = append(validations, vs...)
+		} else {
+			h, err = fn.Extract(doc)
+		}
+
+		if err != nil {
+			logger.Println(err)
+			continue
+		}
+
+		if h != nil {
+			harvested = append(harvested, h)
+		}
+	}
+
+	u.ExtractTime = time.Now()
+	u.PageHash = sum
+
+	u.Title = title
+	u.Description = description
+	u.MicroData = mdata
+	u.HarvestedData = harvested
+	u.Validation = validations
+	u.HarvestedURLs = normalisedUrls
+	u.JSONData = jld
+	u.MetaData = metadata
+
+	return nil
+}
+
+// extractMetaData collects the name and property meta tags of a page. Article tags are
+// gathered into a list as a page usually has many
+func extractMetaData(doc *goquery.Document, metadata map[string]interface{}) {
+	doc.Find("meta[name]").Each(func(_ int, sel *goquery.Selection) {
+		var name string
+		var value string
+
+		if attr, ok := sel.Attr("name"); ok {
+			name = attr
+		}
+
+		if attr, ok := sel.Attr("content"); ok {
+			value = attr
+		}
+
+		if name != "" && value != "" {
+			if name == "article:tag" {
+				tagsIn, ok := metadata[name]
+				if !ok {
+					metadata[name] = []string{value}
+				} else {
+					tags := tagsIn.([]string)
+					metadata[name] = append(tags, value)
+				}
+			} else {
+				metadata[name] = value
+			}
+		}
+	})
+	doc.Find("meta[property]").Each(func(_ int, sel *goquery.Selection) {
+		var name string
+		var value string
+
+		if attr, ok := sel.Attr("property"); ok {
+			name = attr
+		}
+
+		if attr, ok := sel.Attr("content"); ok {
+			value = strings.TrimSpace(attr)
+		}
+
+		if name != "" && value != "" {
+			if name == "article:tag" {
+				tagsIn, ok := metadata[name]
+				if !ok {
+					metadata[name] = []string{strings.TrimSpace(value)}
+				} else {
+					tags := tagsIn.([]string)
+					metadata[name] = append(tags, strings.TrimSpace(value))
+				}
+
+			} else {
+				metadata[name] = value
+			}
+		}
+	})
+}
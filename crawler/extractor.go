@@ -1,6 +1,8 @@
 package crawler
 
 import (
+	"net/url"
+
 	"github.com/PuerkitoBio/goquery"
 )
 
@@ -14,3 +16,18 @@ type extractor interface {
 	Match() (url string)
 	Extract(doc *goquery.Document) (harvestedData interface{}, err error)
 }
+
+// validatingExtractor is implemented by extractors that can report whether the data
+// they harvested satisfies the rules of the host model it was extracted with
+type validatingExtractor interface {
+	extractor
+	ExtractValidated(doc *goquery.Document) (harvestedData interface{}, validations []Validation, err error)
+}
+
+// apiExtractor is implemented by extractors that read the JSON responses of an api
+// rather than html pages. Along with the records it returns the urls of any further
+// pages of the response
+type apiExtractor interface {
+	extractor
+	ExtractJSON(pageURL *url.URL, data interface{}) (harvestedData interface{}, urls []string, validations []Validation, err error)
+}
@@ -0,0 +1,370 @@
+package crawler
+
+import (
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/araddon/dateparse"
+	"github.com/pkg/errors"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// APIExtractor reads records from the JSON responses of an api with the JSONPath rules
+// of a host model, and finds the url of the next page of results from the pagination
+// of each rule. It does nothing for html pages. Build it with NewAPIExtractor so its
+// rules are compiled
+type APIExtractor struct {
+	URL   string
+	Rules []shared.APIOpts
+
+	compiled []apiRule
+}
+
+// apiRule is a rule of the host model with its paths and patterns compiled
+type apiRule struct {
+	opts    shared.APIOpts
+	paths   []*regexp.Regexp
+	records *shared.JSONPath
+	fields  map[string]*shared.JSONPath
+
+	next, cursor, page, pages *shared.JSONPath
+}
+
+// NewAPIExtractor builds an api extractor for a host, compiling the paths of its rules
+func NewAPIExtractor(url string, rules []shared.APIOpts) (*APIExtractor, error) {
+	ae := &APIExtractor{URL: url, Rules: rules}
+
+	for _, opts := range rules {
+		rule := apiRule{opts: opts, fields: make(map[string]*shared.JSONPath)}
+
+		for _, pattern := range opts.PathMatch {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid path matcher for {%s}", opts.Type)
+			}
+			rule.paths = append(rule.paths, re)
+		}
+
+		records := opts.Records
+		if records == "" {
+			records = "$"
+		}
+
+		var err error
+		rule.records, err = shared.CompileJSONPath(records)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid records for {%s}", opts.Type)
+		}
+
+		for field, f := range opts.Fields {
+			rule.fields[field], err = shared.CompileJSONPath(f.Path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid field {%s} for {%s}", field, opts.Type)
+			}
+		}
+
+		if p := opts.Pagination; p != nil {
+			for _, path := range []struct {
+				expr string
+				dst  **shared.JSONPath
+			}{{p.Next, &rule.next}, {p.Cursor, &rule.cursor}, {p.Page, &rule.page}, {p.Pages, &rule.pages}} {
+				if path.expr == "" {
+					continue
+				}
+
+				*path.dst, err = shared.CompileJSONPath(path.expr)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid pagination for {%s}", opts.Type)
+				}
+			}
+		}
+
+		ae.compiled = append(ae.compiled, rule)
+	}
+
+	return ae, nil
+}
+
+// Register the extractor in the list of extractors
+func (ae *APIExtractor) Register(ex Extractors) {
+	ex.Add(ae)
+}
+
+// Match the extractor to a url host
+func (ae *APIExtractor) Match() (url string) {
+	return ae.URL
+}
+
+// Extract does nothing as api rules only apply to JSON responses
+func (ae *APIExtractor) Extract(doc *goquery.Document) (interface{}, error) {
+	return nil, nil
+}
+
+// ExtractJSON reads the records of every rule that matches the path of the response,
+// checking each against the required fields and constraints of its rule, and returns
+// the urls of the next pages. The records are nil if no rule matched
+func (ae *APIExtractor) ExtractJSON(pageURL *url.URL, data interface{}) (interface{}, []string, []Validation, error) {
+	var harvested []interface{}
+	var urls []string
+	var validations []Validation
+
+	for _, rule := range ae.compiled {
+		if !rule.matches(pageURL.Path) {
+			continue
+		}
+
+		if harvested == nil {
+			harvested = []interface{}{}
+		}
+
+		nodes := rule.records.Find(data)
+		for _, node := range nodes {
+			record := map[string]interface{}{
+				"type": rule.opts.Type,
+			}
+
+			for field, path := range rule.fields {
+				value := apiValue(rule.opts.Fields[field].Kind, path.Find(node))
+				if value != nil {
+					record[field] = value
+				}
+			}
+
+			harvested = append(harvested, record)
+			validations = append(validations, validateRecord(ae.URL, shared.ExtractorOpts{
+				Type:        rule.opts.Type,
+				Required:    rule.opts.Required,
+				Constraints: rule.opts.Constraints,
+			}, record))
+		}
+
+		if next := rule.nextPage(pageURL, data, len(nodes)); next != "" {
+			urls = append(urls, next)
+		}
+	}
+
+	if harvested == nil {
+		// a nil list would not be a nil interface
+		return nil, urls, validations, nil
+	}
+	return harvested, urls, validations, nil
+}
+
+func (rule apiRule) matches(path string) bool {
+	if len(rule.paths) == 0 {
+		return true
+	}
+
+	for _, re := range rule.paths {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextPage works out the url of the page after this one, or returns nothing if this is
+// the last page. The url may be relative to the page
+func (rule apiRule) nextPage(pageURL *url.URL, data interface{}, records int) string {
+	p := rule.opts.Pagination
+	if p == nil {
+		return ""
+	}
+
+	if rule.next != nil {
+		next, _ := rule.next.First(data)
+		return jsonString(next)
+	}
+
+	if rule.cursor != nil {
+		cursor, _ := rule.cursor.First(data)
+		value := jsonString(cursor)
+		if value == "" {
+			return ""
+		}
+		return strings.Replace(p.Template, "{cursor}", url.QueryEscape(value), -1)
+	}
+
+	if records == 0 {
+		return ""
+	}
+
+	current := 1
+	if rule.page != nil {
+		value, _ := rule.page.First(data)
+		n, ok := jsonInt(value)
+		if !ok {
+			return ""
+		}
+		current = n
+	} else if param := templateParam(p.Template, "{page}"); param != "" {
+		if n, err := strconv.Atoi(pageURL.Query().Get(param)); err == nil {
+			current = n
+		}
+	}
+
+	next := current + 1
+	if rule.pages != nil {
+		value, _ := rule.pages.First(data)
+		if pages, ok := jsonInt(value); ok && next > pages {
+			return ""
+		}
+	}
+	if p.MaxPages > 0 && next > p.MaxPages {
+		return ""
+	}
+
+	return strings.Replace(p.Template, "{page}", strconv.Itoa(next), -1)
+}
+
+// templateParam finds the query parameter of a url template whose value is the
+// placeholder
+func templateParam(template, placeholder string) string {
+	i := strings.IndexByte(template, '?')
+	if i < 0 {
+		return ""
+	}
+
+	for _, pair := range strings.Split(template[i+1:], "&") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 && kv[1] == placeholder {
+			return kv[0]
+		}
+	}
+	return ""
+}
+
+// apiValue converts the values found for a field into the kind of the field, or nil if
+// none could be
+func apiValue(kind string, values []interface{}) interface{} {
+	if len(values) == 0 {
+		return nil
+	}
+
+	switch kind {
+	case "String":
+		return jsonString(values[0])
+
+	case "[]String":
+		list := []string{}
+		for _, v := range values {
+			if items, ok := v.([]interface{}); ok && len(values) == 1 {
+				for _, item := range items {
+					list = append(list, jsonString(item))
+				}
+				continue
+			}
+			list = append(list, jsonString(v))
+		}
+		return list
+
+	case "Number":
+		switch v := values[0].(type) {
+		case float64:
+			return v
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f
+			}
+		}
+		return nil
+
+	case "Bool":
+		switch v := values[0].(type) {
+		case bool:
+			return v
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
+		}
+		return nil
+
+	case "Time":
+		switch v := values[0].(type) {
+		case float64:
+			return time.Unix(int64(v), 0).UTC()
+		case string:
+			t, err := dateparse.ParseAny(strings.TrimSpace(v))
+			if err != nil {
+				log.Println(err)
+				return nil
+			}
+			return t
+		}
+		return nil
+
+	case "Any":
+		return values[0]
+	}
+
+	log.Println("error, incorrect field rule type value, {" + kind + "}")
+	return nil
+}
+
+// jsonString turns a scalar JSON value into a string, and anything else into nothing
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func jsonInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// extractAPI runs the api extractors of the host of a crawl over a decoded JSON
+// response. The records are nil if the host has no api rule for the response
+func extractAPI(u *Crawl, data interface{}, exes Extractors, logger *log.Logger) ([]interface{}, []string, []Validation) {
+	if exes == nil || !u.opts.runs(StageExtractors) {
+		return nil, nil, nil
+	}
+
+	pageURL, err := url.Parse(u.URL)
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	var harvested []interface{}
+	var urls []string
+	var validations []Validation
+
+	for _, ex := range exes.Matches(pageURL.Host) {
+		ae, ok := ex.(apiExtractor)
+		if !ok {
+			continue
+		}
+
+		h, next, vs, err := ae.ExtractJSON(pageURL, data)
+		if err != nil {
+			logger.Printf("unable to extract %s: %s", u.URL, err)
+			continue
+		}
+
+		if h != nil {
+			harvested = append(harvested, h)
+		}
+		urls = append(urls, next...)
+		validations = append(validations, vs...)
+	}
+
+	return harvested, urls, validations
+}
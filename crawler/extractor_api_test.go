@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+func newTestAPIServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/v1/products":
+			page := r.URL.Query().Get("page")
+			if page == "" {
+				page = "1"
+			}
+			fmt.Fprintf(w, `{
+				"meta": { "page": %s, "totalPages": 2 },
+				"data": [
+					{ "name": "Widget", "price": { "amount": "9.50" }, "tags": ["a", "b"], "added": "2020-01-02T03:04:05Z" },
+					{ "price": { "amount": 4 } }
+				]
+			}`, page)
+
+		case "/v1/events":
+			fmt.Fprint(w, `{ "events": [{ "id": "e1" }], "cursor": { "next": "c 2" }, "links": { "next": "/v1/events?after=e1" } }`)
+
+		default:
+			fmt.Fprint(w, `{ "title": "Index" }`)
+		}
+	}))
+}
+
+func TestAPIExtractor(t *testing.T) {
+	server := newTestAPIServer()
+	defer server.Close()
+
+	host := (&Crawl{URL: server.URL}).Host()
+	exes := NewHostExtractors([]shared.Host{{
+		Host: host,
+		API: []shared.APIOpts{
+			{
+				Type:      "Product",
+				PathMatch: []string{"^/v1/products$"},
+				Records:   "$.data[*]",
+				Fields: map[string]shared.APIFieldRule{
+					"name":  {Kind: "String", Path: "$.name"},
+					"price": {Kind: "Number", Path: "$.price.amount"},
+					"tags":  {Kind: "[]String", Path: "$.tags"},
+					"added": {Kind: "Time", Path: "$.added"},
+				},
+				Required:   []string{"name"},
+				Pagination: &shared.PaginationOpts{Page: "$.meta.page", Pages: "$.meta.totalPages", Template: "/v1/products?page={page}"},
+			},
+			{
+				Type:       "Event",
+				PathMatch:  []string{"^/v1/events$"},
+				Records:    "$.events[*]",
+				Fields:     map[string]shared.APIFieldRule{"id": {Kind: "String", Path: "$.id"}},
+				Pagination: &shared.PaginationOpts{Cursor: "$.cursor.next", Template: "/v1/events?cursor={cursor}"},
+			},
+			{
+				Type:       "EventLink",
+				PathMatch:  []string{"^/v1/events$"},
+				Records:    "$.links",
+				Fields:     map[string]shared.APIFieldRule{"next": {Kind: "Any", Path: "$.next"}},
+				Pagination: &shared.PaginationOpts{Next: "$.links.next"},
+			},
+		},
+	}})
+
+	service := newTestService(t, ServiceOpts{Extractors: exes})
+
+	first, err := service.Crawl(context.Background(), server.URL+"/v1/products")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	harvested := first.HarvestedData.([]interface{})
+	records := harvested[0].([]interface{})
+	if len(harvested) != 1 || len(records) != 2 {
+		t.Fatalf("expected the records of the api, got %+v", first.HarvestedData)
+	}
+
+	product := records[0].(map[string]interface{})
+	if product["type"] != "Product" || product["name"] != "Widget" || product["price"] != 9.5 || len(product["tags"].([]string)) != 2 {
+		t.Errorf("unexpected record %+v", product)
+	}
+	if len(first.Validation) != 2 || !first.Validation[0].Valid || first.Validation[1].Valid {
+		t.Errorf("expected the record without a name to be invalid, got %+v", first.Validation)
+	}
+	if len(first.HarvestedURLs) != 1 || first.HarvestedURLs[0] != server.URL+"/v1/products?page=2" {
+		t.Errorf("expected the next page, got %v", first.HarvestedURLs)
+	}
+
+	last, err := service.Crawl(context.Background(), server.URL+"/v1/products?page=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last.HarvestedURLs) != 0 {
+		t.Errorf("expected no page after the last, got %v", last.HarvestedURLs)
+	}
+
+	events, err := service.Crawl(context.Background(), server.URL+"/v1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.HarvestedData.([]interface{})[0].([]interface{})) != 2 || len(events.HarvestedURLs) != 2 ||
+		events.HarvestedURLs[0] != server.URL+"/v1/events?cursor=c+2" || events.HarvestedURLs[1] != server.URL+"/v1/events?after=e1" {
+		t.Errorf("expected the cursor and next pages, got %v %+v", events.HarvestedURLs, events.HarvestedData)
+	}
+
+	// responses without a rule keep the whole document
+	index, err := service.Crawl(context.Background(), server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Title != "Index" || index.HarvestedData.([]interface{})[0].(map[string]interface{})["title"] != "Index" {
+		t.Errorf("expected the document as it is, got %+v", index.HarvestedData)
+	}
+}
+
+func TestAPIPageTemplate(t *testing.T) {
+	ae, err := NewAPIExtractor("api.example.com", []shared.APIOpts{{
+		Type:       "Item",
+		Records:    "$.items[*]",
+		Pagination: &shared.PaginationOpts{Template: "/items?size=10&p={page}", MaxPages: 3},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full := map[string]interface{}{"items": []interface{}{map[string]interface{}{}}}
+	empty := map[string]interface{}{"items": []interface{}{}}
+
+	tests := []struct {
+		page string
+		data interface{}
+		next string
+	}{
+		{"/items", full, "/items?size=10&p=2"},
+		{"/items?size=10&p=2", full, "/items?size=10&p=3"},
+		{"/items?size=10&p=3", full, ""},
+		{"/items?size=10&p=2", empty, ""},
+	}
+
+	for _, tt := range tests {
+		pageURL, _ := url.Parse("https://api.example.com" + tt.page)
+		_, urls, _, err := ae.ExtractJSON(pageURL, tt.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (tt.next == "" && len(urls) != 0) || (tt.next != "" && (len(urls) != 1 || urls[0] != tt.next)) {
+			t.Errorf("%s: expected next page %q, got %v", tt.page, tt.next, urls)
+		}
+	}
+}
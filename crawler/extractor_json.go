@@ -27,7 +27,15 @@ func (je *JSONExtractor) Match() (url string) {
 
 // Extract a data object from the goquery.Document
 func (je *JSONExtractor) Extract(doc *goquery.Document) (interface{}, error) {
+	data, _, err := je.ExtractValidated(doc)
+	return data, err
+}
+
+// ExtractValidated extracts a data object from the goquery.Document and checks each
+// record against the required fields and constraints of the rule that produced it
+func (je *JSONExtractor) ExtractValidated(doc *goquery.Document) (interface{}, []Validation, error) {
 	var harvestedData = []interface{}{}
+	var validations = []Validation{}
 
 	for _, rule := range je.Rules {
 		var sel *goquery.Selection
@@ -35,7 +43,7 @@ func (je *JSONExtractor) Extract(doc *goquery.Document) (interface{}, error) {
 			sel = doc.Find(pm)
 		}
 
-		if sel.Length() <= 0 {
+		if sel == nil || sel.Length() <= 0 {
 			continue
 		}
 
@@ -115,6 +123,7 @@ func (je *JSONExtractor) Extract(doc *goquery.Document) (interface{}, error) {
 		}
 
 		harvestedData = append(harvestedData, data)
+		validations = append(validations, validateRecord(je.URL, rule, data))
 	}
-	return harvestedData, nil
+	return harvestedData, validations, nil
 }
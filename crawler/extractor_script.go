@@ -0,0 +1,224 @@
+package crawler
+
+import (
+	"runtime/metrics"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/dop251/goja"
+	"github.com/pkg/errors"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// The default limits placed on a script extractor when the host model does not set them
+const (
+	DefaultScriptTimeout     = time.Second
+	DefaultScriptMemoryLimit = 64 << 20
+
+	// how often a running script is checked against its memory limit, and the heap
+	// metric it is checked with
+	scriptMemoryCheck  = 10 * time.Millisecond
+	scriptMemoryMetric = "/memory/classes/heap/objects:bytes"
+
+	// the most elements a single query from a script will return
+	scriptMaxQueryResults = 10000
+	scriptMaxCallStack    = 1024
+)
+
+// ScriptExtractor runs a JavaScript extractor from a host model inside a sandboxed
+// interpreter. The script must define a function extract(doc, url) which is given a
+// query api over the page and returns an object (or array of objects) of harvested
+// data. Each element exposes text(), html(), attr(name), query(selector) and
+// first(selector), and doc additionally exposes title().
+//
+// The script has no access to the network or filesystem. It is interrupted once it has
+// run for longer than Timeout, or once the heap has grown by more than MemoryLimit bytes
+// since it started. The timeout is wall-clock time rather than CPU time, so a script on
+// a busy machine gets less done before it is stopped. The heap is shared by the whole
+// process, so the memory limit is a guard against a runaway script taking the crawler
+// down rather than an exact account of what one script uses
+type ScriptExtractor struct {
+	URL         string
+	Type        string
+	Source      string
+	Timeout     time.Duration
+	MemoryLimit uint64
+
+	once    sync.Once
+	program *goja.Program
+	err     error
+}
+
+// NewScriptExtractor builds a script extractor for a host from the model options
+func NewScriptExtractor(url string, opts shared.ScriptOpts) (*ScriptExtractor, error) {
+	timeout := DefaultScriptTimeout
+	if opts.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timeout for script {%s}", opts.Type)
+		}
+	}
+
+	memoryLimit := uint64(DefaultScriptMemoryLimit)
+	if opts.MemoryLimit > 0 {
+		memoryLimit = uint64(opts.MemoryLimit) << 20
+	}
+
+	return &ScriptExtractor{
+		URL:         url,
+		Type:        opts.Type,
+		Source:      opts.Source,
+		Timeout:     timeout,
+		MemoryLimit: memoryLimit,
+	}, nil
+}
+
+// Register the extractor in the list of extractors
+func (se *ScriptExtractor) Register(ex Extractors) {
+	ex.Add(se)
+}
+
+// Match the extractor to a url host
+func (se *ScriptExtractor) Match() (url string) {
+	return se.URL
+}
+
+// Extract runs the script against the document and returns the records it produced
+func (se *ScriptExtractor) Extract(doc *goquery.Document) (interface{}, error) {
+	se.once.Do(func() {
+		se.program, se.err = goja.Compile(se.Type, se.Source, true)
+	})
+	if se.err != nil {
+		return nil, errors.Wrapf(se.err, "unable to compile script {%s}", se.Type)
+	}
+
+	vm := goja.New()
+	vm.SetMaxCallStackSize(scriptMaxCallStack)
+
+	done := make(chan struct{})
+	defer close(done)
+	go se.limit(vm, done)
+
+	_, err := vm.RunProgram(se.program)
+	if err != nil {
+		return nil, errors.Wrapf(err, "script {%s} failed", se.Type)
+	}
+
+	extract, ok := goja.AssertFunction(vm.Get("extract"))
+	if !ok {
+		return nil, errors.Errorf("script {%s} does not define an extract function", se.Type)
+	}
+
+	var pageURL string
+	if doc.Url != nil {
+		pageURL = doc.Url.String()
+	}
+
+	api := scriptElement(doc.Selection)
+	api["title"] = func() string {
+		return doc.Find("title").First().Text()
+	}
+
+	result, err := extract(goja.Undefined(), vm.ToValue(api), vm.ToValue(pageURL))
+	if err != nil {
+		return nil, errors.Wrapf(err, "script {%s} failed", se.Type)
+	}
+
+	return se.records(result.Export()), nil
+}
+
+// limit interrupts the script once it runs past its timeout or the heap grows past its
+// memory limit, until done is closed. The heap is read through runtime/metrics, which
+// does not stop the world
+func (se *ScriptExtractor) limit(vm *goja.Runtime, done chan struct{}) {
+	timeout := time.NewTimer(se.Timeout)
+	defer timeout.Stop()
+
+	check := time.NewTicker(scriptMemoryCheck)
+	defer check.Stop()
+
+	sample := []metrics.Sample{{Name: scriptMemoryMetric}}
+	metrics.Read(sample)
+	start := sample[0].Value.Uint64()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-timeout.C:
+			vm.Interrupt(errors.Errorf("script {%s} exceeded its time limit of %s", se.Type, se.Timeout))
+			return
+
+		case <-check.C:
+			metrics.Read(sample)
+			heap := sample[0].Value.Uint64()
+			if heap > start && heap-start > se.MemoryLimit {
+				vm.Interrupt(errors.Errorf("script {%s} exceeded its memory limit of %d MB", se.Type, se.MemoryLimit>>20))
+				return
+			}
+		}
+	}
+}
+
+// records turns the value returned by a script into the list of records that is
+// merged into the harvested data, tagging each with the type of the extractor
+func (se *ScriptExtractor) records(value interface{}) interface{} {
+	var list []interface{}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		list = v
+	default:
+		list = []interface{}{v}
+	}
+
+	for _, item := range list {
+		if record, ok := item.(map[string]interface{}); ok {
+			if _, exists := record["type"]; !exists {
+				record["type"] = se.Type
+			}
+		}
+	}
+
+	return list
+}
+
+// scriptElement exposes a selection to a script as an object of query functions
+func scriptElement(sel *goquery.Selection) map[string]interface{} {
+	return map[string]interface{}{
+		"text": func() string {
+			return sel.Text()
+		},
+		"html": func() string {
+			h, _ := sel.Html()
+			return h
+		},
+		"attr": func(name string) interface{} {
+			val, ok := sel.Attr(name)
+			if !ok {
+				return nil
+			}
+			return val
+		},
+		"query": func(selector string) []interface{} {
+			found := sel.Find(selector)
+			elements := []interface{}{}
+			found.EachWithBreak(func(i int, s *goquery.Selection) bool {
+				elements = append(elements, scriptElement(s))
+				return len(elements) < scriptMaxQueryResults
+			})
+			return elements
+		},
+		"first": func(selector string) interface{} {
+			found := sel.Find(selector).First()
+			if found.Length() == 0 {
+				return nil
+			}
+			return scriptElement(found)
+		},
+	}
+}
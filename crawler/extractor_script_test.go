@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+func TestScriptExtractor(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(scriptTestBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Url, _ = url.Parse("https://www.example.com/news/1")
+
+	se, err := NewScriptExtractor("www.example.com", shared.ScriptOpts{
+		Type: "NewsArticle",
+		Source: `
+			function extract(doc, url) {
+				var article = doc.first(".article");
+				if (article === null) {
+					return null;
+				}
+
+				return {
+					title: article.first("h1").text(),
+					tags: article.query(".tag").map(function(t) { return t.text(); }),
+					link: article.first("a").attr("href"),
+					url: url
+				};
+			}
+		`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := se.Extract(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := data.([]interface{})
+	if len(records) != 1 {
+		t.Fatalf("expected a single record, got %d", len(records))
+	}
+
+	record := records[0].(map[string]interface{})
+	if record["type"] != "NewsArticle" || record["title"] != "Headline" || record["url"] != "https://www.example.com/news/1" {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	if tags := record["tags"].([]interface{}); len(tags) != 2 || tags[1] != "two" {
+		t.Errorf("unexpected tags %+v", tags)
+	}
+}
+
+func TestScriptExtractorTimeout(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(scriptTestBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	se, err := NewScriptExtractor("www.example.com", shared.ScriptOpts{
+		Type:    "Forever",
+		Source:  `function extract(doc, url) { while (true) {} }`,
+		Timeout: "50ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = se.Extract(doc)
+	if err == nil || !strings.Contains(err.Error(), "time limit") {
+		t.Errorf("expected the script to be interrupted, got %v", err)
+	}
+}
+
+const scriptTestBody = `
+<html>
+	<head><title>Example</title></head>
+	<body>
+		<div class="article">
+			<h1>Headline</h1>
+			<a href="/news/2">Next</a>
+			<span class="tag">one</span><span class="tag">two</span>
+		</div>
+	</body>
+</html>
+`
+
+func TestScriptExtractorMemoryLimit(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(scriptTestBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	se, err := NewScriptExtractor("www.example.com", shared.ScriptOpts{
+		Type:        "Greedy",
+		Source:      `function extract(doc, url) { var s = "x"; while (1) s += s; }`,
+		Timeout:     "10s",
+		MemoryLimit: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = se.Extract(doc)
+	if err == nil || !strings.Contains(err.Error(), "memory limit") {
+		t.Errorf("expected the script to be interrupted, got %v", err)
+	}
+}
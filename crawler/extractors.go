@@ -1,5 +1,12 @@
 package crawler
 
+import (
+	"log"
+	"sync"
+
+	"github.com/samjohnduke/crawl3/shared"
+)
+
 // The Extractors is an object that builds a list of possible extractors.
 // the implementation will perform optimization based what the extractor's
 // listen for (thoughts for the future)
@@ -38,3 +45,72 @@ func (e *defaultExtractors) Add(ex extractor) {
 func (e *defaultExtractors) Matches(url string) []extractor {
 	return e.list[url]
 }
+
+// NewHostExtractors builds the JSON, api and script extractors for a list of host models,
+// registering each model against its host and all of its aliases
+func NewHostExtractors(hosts []shared.Host) Extractors {
+	execs := NewDefaultExtractors()
+	for _, host := range hosts {
+		for _, h := range append([]string{host.Host}, host.Alias...) {
+			execs.Add(&JSONExtractor{URL: h, Rules: host.Extractor})
+
+			if len(host.API) > 0 {
+				ae, err := NewAPIExtractor(h, host.API)
+				if err != nil {
+					log.Println(err)
+				} else {
+					execs.Add(ae)
+				}
+			}
+
+			for _, script := range host.Scripts {
+				se, err := NewScriptExtractor(h, script)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				execs.Add(se)
+			}
+		}
+	}
+	return execs
+}
+
+// ReloadableExtractors wraps a set of Extractors so that the whole set can be swapped
+// out while workers are using it, for example when the host models are reloaded
+type ReloadableExtractors struct {
+	current Extractors
+	mu      sync.RWMutex
+}
+
+// NewReloadableExtractors creates a reloadable wrapper around the initial extractors
+func NewReloadableExtractors(initial Extractors) *ReloadableExtractors {
+	return &ReloadableExtractors{
+		current: initial,
+	}
+}
+
+// Add an extractor to the current set
+func (e *ReloadableExtractors) Add(ex extractor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.current.Add(ex)
+}
+
+// Matches gets a list of extractors from the current set that match a given url
+func (e *ReloadableExtractors) Matches(url string) []extractor {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.current.Matches(url)
+}
+
+// Swap replaces the current set of extractors. Crawls already extracting keep using
+// the extractors they matched against
+func (e *ReloadableExtractors) Swap(next Extractors) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.current = next
+}
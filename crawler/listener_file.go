@@ -0,0 +1,279 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultFileCheckpointEvery is how many crawls are replayed between saves of the
+// checkpoint when FileListenerOpts does not say
+const DefaultFileCheckpointEvery = 100
+
+// FileListenerOpts configures the replay of the files written by PublisherFile
+type FileListenerOpts struct {
+	// Paths are the files, directories or glob patterns to replay. The files of a
+	// directory are replayed in the order of their names, which is the order they
+	// were written in
+	Paths []string
+
+	// Checkpoint is the file the position of the replay is saved in, so a replay that
+	// is stopped carries on from where it got to. Every crawl is replayed when empty
+	Checkpoint string
+
+	// CheckpointEvery is how many crawls are replayed between saves of the checkpoint
+	CheckpointEvery int
+}
+
+// FileCheckpoint is how far a replay has got, the number of lines of File that have been
+// replayed. Files that sort before File have all been replayed
+type FileCheckpoint struct {
+	File string
+	Line int64
+}
+
+// ListenerFile implements the Listener interface by replaying the crawls in files
+// written by PublisherFile. A crawl counts as replayed once it has been taken from the
+// channel, and the channel is closed once every file has been replayed
+type ListenerFile struct {
+	opts       FileListenerOpts
+	files      []string
+	checkpoint FileCheckpoint
+
+	c         chan *Crawl
+	quit      chan struct{}
+	quitOnce  sync.Once
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewListenerFile finds the files to replay and loads the checkpoint if there is one
+func NewListenerFile(opts FileListenerOpts) (Listener, error) {
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = DefaultFileCheckpointEvery
+	}
+
+	files, err := crawlFiles(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, NewError(CodeNotFound, fmt.Sprintf("no crawl files found in %s", strings.Join(opts.Paths, ", ")))
+	}
+
+	ln := &ListenerFile{
+		opts:  opts,
+		files: files,
+		c:     make(chan *Crawl),
+		quit:  make(chan struct{}),
+	}
+
+	if opts.Checkpoint != "" {
+		d, err := ioutil.ReadFile(opts.Checkpoint)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			err = json.Unmarshal(d, &ln.checkpoint)
+			if err != nil {
+				return nil, fmt.Errorf("checkpoint %s: %s", opts.Checkpoint, err)
+			}
+		}
+	}
+
+	return ln, nil
+}
+
+// Listen starts the replay and returns the channel the crawls are delivered on
+func (ln *ListenerFile) Listen() chan *Crawl {
+	ln.wg.Add(1)
+	go ln.replay()
+	return ln.c
+}
+
+// Close stops the replay, saves the checkpoint and closes the channel
+func (ln *ListenerFile) Close() error {
+	ln.quitOnce.Do(func() { close(ln.quit) })
+	ln.wg.Wait()
+	ln.closeOnce.Do(func() { close(ln.c) })
+	return nil
+}
+
+func (ln *ListenerFile) replay() {
+	defer ln.wg.Done()
+	defer ln.closeOnce.Do(func() { close(ln.c) })
+
+	for _, file := range ln.files {
+		name := filepath.Base(file)
+		if name < ln.checkpoint.File {
+			continue
+		}
+
+		skip := int64(0)
+		if name == ln.checkpoint.File {
+			skip = ln.checkpoint.Line
+		}
+
+		ok := ln.replayFile(file, skip)
+		ln.saveCheckpoint()
+		if !ok {
+			return
+		}
+	}
+}
+
+// replayFile delivers the crawls of a file after the first skip lines. It reports false
+// if the listener was closed first
+func (ln *ListenerFile) replayFile(file string, skip int64) bool {
+	ln.checkpoint = FileCheckpoint{File: filepath.Base(file), Line: skip}
+
+	finished, err := eachCrawlLine(file, func(line int64, d []byte) bool {
+		if line <= skip {
+			return true
+		}
+
+		var c *Crawl
+		err := json.Unmarshal(d, &c)
+		if err != nil || c == nil {
+			log.Printf("%s line %d: %v", file, line, err)
+		} else {
+			select {
+			case ln.c <- c:
+			case <-ln.quit:
+				return false
+			}
+		}
+
+		ln.checkpoint.Line = line
+		if line%int64(ln.opts.CheckpointEvery) == 0 {
+			ln.saveCheckpoint()
+		}
+		return true
+	})
+	if err != nil {
+		log.Println(file, err)
+	}
+	return finished
+}
+
+// eachCrawlLine calls fn with each line of a crawl file, and its number from 1, until fn
+// returns false. It reports whether fn took every line
+func eachCrawlLine(file string, fn func(line int64, d []byte) bool) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return true, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(file, fileGzipExt) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return true, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	br := bufio.NewReader(r)
+	var line int64
+	for {
+		d, err := br.ReadBytes('\n')
+		if len(d) == 0 && err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return true, err
+		}
+
+		line++
+		if !fn(line, d) {
+			return false, nil
+		}
+	}
+}
+
+// saveCheckpoint writes the checkpoint to a temporary file and renames it over the old
+// one, so a crash while saving leaves the previous checkpoint
+func (ln *ListenerFile) saveCheckpoint() {
+	if ln.opts.Checkpoint == "" {
+		return
+	}
+
+	d, err := json.Marshal(ln.checkpoint)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	tmp := ln.opts.Checkpoint + fileActiveSuffix
+	err = ioutil.WriteFile(tmp, d, 0644)
+	if err == nil {
+		err = os.Rename(tmp, ln.opts.Checkpoint)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// crawlFiles expands the paths into the finished crawl files they name, sorted by name
+func crawlFiles(paths []string) ([]string, error) {
+	return findFiles(paths, isCrawlFile)
+}
+
+// findFiles expands the files, directories and glob patterns into the files that match,
+// sorted by name
+func findFiles(paths []string, match func(string) bool) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+
+	add := func(file string) {
+		if match(file) && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		found, err := filepath.Glob(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range found {
+			info, err := os.Stat(name)
+			if err != nil {
+				return nil, err
+			}
+
+			if !info.IsDir() {
+				add(name)
+				continue
+			}
+
+			entries, err := ioutil.ReadDir(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					add(filepath.Join(name, entry.Name()))
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return filepath.Base(files[i]) < filepath.Base(files[j])
+	})
+	return files, nil
+}
@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFilePublishAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl3-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// every crawl is bigger than a byte so each one starts a new file
+	publisher, err := NewPublisherFile(FileOpts{Dir: dir, MaxBytes: 1, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		id := strconv.Itoa(i)
+		want = append(want, id)
+
+		err := publisher.Publish(&Crawl{ID: id, URL: "https://example.com/" + id, Title: "page " + id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the file still being written is not replayed
+	files, err := crawlFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Errorf("expected 4 finished files, got %v", files)
+	}
+
+	err = publisher.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err = crawlFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 5 || filepath.Ext(files[0]) != ".gz" {
+		t.Errorf("expected 5 compressed files, got %v", files)
+	}
+
+	checkpoint := filepath.Join(dir, "checkpoint.json")
+	opts := FileListenerOpts{Paths: []string{dir}, Checkpoint: checkpoint, CheckpointEvery: 1}
+
+	listener, err := NewListenerFile(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := receiveCrawls(t, listener.Listen(), 3)
+	listener.Close()
+
+	// the next replay carries on after the crawls already taken
+	listener, err = NewListenerFile(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := listener.Listen()
+	got = append(got, receiveCrawls(t, c, 2)...)
+
+	select {
+	case crawl, ok := <-c:
+		if ok {
+			t.Errorf("expected the replay to finish, got %s", crawl.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the replay to finish")
+	}
+	listener.Close()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFileReplayPlain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl3-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	publisher, err := NewPublisherFile(FileOpts{Dir: dir, Prefix: "day"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err := publisher.Publish(&Crawl{ID: strconv.Itoa(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	publisher.Close()
+
+	err = publisher.Publish(&Crawl{ID: "late"})
+	if err == nil {
+		t.Error("expected publishing after close to fail")
+	}
+
+	listener, err := NewListenerFile(FileListenerOpts{Paths: []string{filepath.Join(dir, "day-*.jsonl")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	got := receiveCrawls(t, listener.Listen(), 3)
+	if !reflect.DeepEqual(got, []string{"0", "1", "2"}) {
+		t.Errorf("expected the crawls in order, got %v", got)
+	}
+
+	_, err = NewListenerFile(FileListenerOpts{Paths: []string{filepath.Join(dir, "missing")}})
+	if err == nil {
+		t.Error("expected an error when there is nothing to replay")
+	}
+}
@@ -0,0 +1,244 @@
+package crawler
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// How long the listener waits for a crawl to arrive before checking it has not been
+// closed
+const jetStreamFetchWait = time.Second
+
+// ListenerJetStream implements the AckListener interface over a durable JetStream
+// consumer. Crawls are fetched one at a time and a crawl is only acknowledged by Ack,
+// once whoever took it from the channel has processed it, so a crawl that was not
+// processed before a crash, or within AckWait, is delivered again. After MaxDeliver
+// attempts, or if it cannot be decoded, a crawl is moved to the dead letter subject
+type ListenerJetStream struct {
+	js   nats.JetStreamContext
+	opts JetStreamOpts
+	sub  *nats.Subscription
+	c    chan *Crawl
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[*Crawl]pendingCrawl
+}
+
+// pendingCrawl is a crawl that has been handed over and not yet acknowledged. Once
+// AckWait has passed the server delivers it again and it can no longer be acknowledged
+type pendingCrawl struct {
+	msg     *nats.Msg
+	expires time.Time
+}
+
+// NewListenerJetStream creates a listener that consumes completed crawls from the
+// stream with a durable pull consumer, creating the stream if needed
+func NewListenerJetStream(js nats.JetStreamContext, opts JetStreamOpts) (AckListener, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	err = EnsureJetStream(js, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := js.PullSubscribe(opts.Subject, opts.Durable,
+		nats.BindStream(opts.Stream),
+		nats.ManualAck(),
+		nats.MaxDeliver(opts.MaxDeliver),
+		nats.AckWait(opts.AckWait),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ListenerJetStream{
+		js:      js,
+		opts:    opts,
+		sub:     sub,
+		c:       make(chan *Crawl),
+		quit:    make(chan struct{}),
+		pending: make(map[*Crawl]pendingCrawl),
+	}, nil
+}
+
+// Listen starts consuming the stream and returns the channel crawls are delivered on
+func (ln *ListenerJetStream) Listen() chan *Crawl {
+	ln.wg.Add(1)
+	go ln.consume()
+	return ln.c
+}
+
+// Close stops consuming and closes the channel. The consumer stays on the server so the
+// next listener with the same durable name carries on where this one stopped
+func (ln *ListenerJetStream) Close() error {
+	close(ln.quit)
+	ln.wg.Wait()
+	close(ln.c)
+	return nil
+}
+
+func (ln *ListenerJetStream) consume() {
+	defer ln.wg.Done()
+
+	for {
+		select {
+		case <-ln.quit:
+			return
+		default:
+		}
+
+		// a single crawl at a time, so none wait here long enough to be delivered again
+		msgs, err := ln.sub.Fetch(1, nats.MaxWait(jetStreamFetchWait))
+		if err == nats.ErrTimeout {
+			continue
+		}
+		if err != nil {
+			log.Println(err)
+			select {
+			case <-time.After(jetStreamFetchWait):
+			case <-ln.quit:
+				return
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			if !ln.deliver(msg) {
+				return
+			}
+		}
+	}
+}
+
+// Ack acknowledges a crawl taken from the channel once it has been processed, so it is
+// not delivered again
+func (ln *ListenerJetStream) Ack(c *Crawl) error {
+	ln.mu.Lock()
+	p, ok := ln.pending[c]
+	delete(ln.pending, c)
+	ln.mu.Unlock()
+
+	if !ok {
+		return NewError(CodeNotFound, "the crawl was not delivered by this listener or has already been acknowledged")
+	}
+	return p.msg.Ack()
+}
+
+// Nak reports a crawl taken from the channel that could not be processed. It is
+// delivered again, or moved to the dead letter subject with the reason once it has
+// been delivered MaxDeliver times
+func (ln *ListenerJetStream) Nak(c *Crawl, reason error) error {
+	ln.mu.Lock()
+	p, ok := ln.pending[c]
+	delete(ln.pending, c)
+	ln.mu.Unlock()
+
+	if !ok {
+		return NewError(CodeNotFound, "the crawl was not delivered by this listener or has already been acknowledged")
+	}
+
+	meta, err := p.msg.Metadata()
+	if err == nil && int(meta.NumDelivered) >= ln.opts.MaxDeliver {
+		ln.deadLetter(p.msg, reason.Error())
+		return nil
+	}
+	return p.msg.Nak()
+}
+
+// deliver hands a crawl to the channel, leaving it to be acknowledged by Ack. It
+// reports false if the listener was closed first, leaving the crawl to be delivered
+// again
+func (ln *ListenerJetStream) deliver(msg *nats.Msg) bool {
+	var c *Crawl
+	_, err := Decode(msg.Data, &c)
+	if err != nil {
+		ln.deadLetter(msg, err.Error())
+		return true
+	}
+
+	// the crawl is pending before it is handed over so it can be acknowledged as
+	// soon as it is taken. Crawls that were never acknowledged are dropped once they
+	// have been delivered again
+	now := time.Now()
+	ln.mu.Lock()
+	for pc, p := range ln.pending {
+		if now.After(p.expires) {
+			delete(ln.pending, pc)
+		}
+	}
+	ln.pending[c] = pendingCrawl{msg: msg, expires: now.Add(ln.opts.AckWait)}
+	ln.mu.Unlock()
+
+	// give up on the hand off in time for the crawl to be delivered again rather
+	// than have the server redeliver it while it is still waiting here
+	timeout := time.NewTimer(ln.opts.AckWait / 2)
+	defer timeout.Stop()
+
+	select {
+	case ln.c <- c:
+		return true
+
+	case <-timeout.C:
+		ln.forget(c)
+
+		meta, err := msg.Metadata()
+		if err == nil && int(meta.NumDelivered) >= ln.opts.MaxDeliver {
+			ln.deadLetter(msg, "not taken from the listener after "+strconv.Itoa(ln.opts.MaxDeliver)+" deliveries")
+			return true
+		}
+
+		err = msg.Nak()
+		if err != nil {
+			log.Println(err)
+		}
+
+	case <-ln.quit:
+		ln.forget(c)
+		msg.Nak()
+		return false
+	}
+
+	return true
+}
+
+func (ln *ListenerJetStream) forget(c *Crawl) {
+	ln.mu.Lock()
+	delete(ln.pending, c)
+	ln.mu.Unlock()
+}
+
+// deadLetter moves a crawl that cannot be delivered to the dead letter subject, with
+// the reason in its headers, and stops it being delivered again
+func (ln *ListenerJetStream) deadLetter(msg *nats.Msg, reason string) {
+	dead := nats.NewMsg(ln.opts.DeadLetterSubject)
+	dead.Data = msg.Data
+	dead.Header.Set("Crawl-Subject", msg.Subject)
+	dead.Header.Set("Crawl-Error", reason)
+
+	if meta, err := msg.Metadata(); err == nil {
+		dead.Header.Set("Crawl-Deliveries", strconv.FormatUint(meta.NumDelivered, 10))
+		dead.Header.Set("Crawl-Sequence", strconv.FormatUint(meta.Sequence.Stream, 10))
+	}
+
+	_, err := ln.js.PublishMsg(dead)
+	if err != nil {
+		// leave the crawl to be delivered again rather than lose it
+		log.Println(err)
+		msg.Nak()
+		return
+	}
+
+	err = msg.Term()
+	if err != nil {
+		log.Println(err)
+	}
+}
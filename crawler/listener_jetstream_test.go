@@ -0,0 +1,315 @@
+package crawler
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	nats "github.com/nats-io/nats.go"
+)
+
+// runJetStreamServer starts an embedded server with JetStream storing into a temporary
+// directory
+func runJetStreamServer(t *testing.T) (*server.Server, func()) {
+	dir, err := ioutil.TempDir("", "crawl3-jetstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: true,
+		StoreDir:  dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("unable to start the jetstream server")
+	}
+
+	return s, func() {
+		s.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func connectJetStream(t *testing.T, s *server.Server) (*nats.Conn, nats.JetStreamContext) {
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nc, js
+}
+
+func takeCrawls(t *testing.T, c chan *Crawl, n int) []*Crawl {
+	var crawls []*Crawl
+	for len(crawls) < n {
+		select {
+		case crawl := <-c:
+			crawls = append(crawls, crawl)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after receiving %d crawls", len(crawls))
+		}
+	}
+	return crawls
+}
+
+func receiveCrawls(t *testing.T, c chan *Crawl, n int) []string {
+	var ids []string
+	for _, crawl := range takeCrawls(t, c, n) {
+		ids = append(ids, crawl.ID)
+	}
+	return ids
+}
+
+// ackCrawls takes n crawls from the listener and acknowledges them
+func ackCrawls(t *testing.T, listener AckListener, c chan *Crawl, n int) []string {
+	var ids []string
+	for _, crawl := range takeCrawls(t, c, n) {
+		err := listener.Ack(crawl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, crawl.ID)
+	}
+	return ids
+}
+
+func TestJetStreamDurableDelivery(t *testing.T) {
+	s, stop := runJetStreamServer(t)
+	defer stop()
+
+	nc, js := connectJetStream(t, s)
+	defer nc.Close()
+
+	opts := JetStreamOpts{Durable: "test", AckWait: time.Second}
+	publisher, err := NewPublisherJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// published while nobody is listening, with a retried publish of b
+	for _, id := range []string{"a", "b", "b", "c"} {
+		err = publisher.Publish(&Crawl{ID: id, URL: "https://example.com/" + id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listener, err := NewListenerJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := ackCrawls(t, listener, listener.Listen(), 3)
+	if ids[0] != "a" || ids[1] != "b" || ids[2] != "c" {
+		t.Errorf("unexpected crawls %v", ids)
+	}
+
+	if listener.Ack(&Crawl{ID: "a"}) == nil {
+		t.Error("expected a crawl the listener did not deliver to be refused")
+	}
+
+	err = listener.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"d", "e"} {
+		err = publisher.Publish(&Crawl{ID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a new listener with the same durable name carries on from where the last stopped
+	listener, err = NewListenerJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ids = ackCrawls(t, listener, listener.Listen(), 2)
+	if ids[0] != "d" || ids[1] != "e" {
+		t.Errorf("unexpected crawls after restarting %v", ids)
+	}
+}
+
+func TestJetStreamAckAfterProcessing(t *testing.T) {
+	s, stop := runJetStreamServer(t)
+	defer stop()
+
+	nc, js := connectJetStream(t, s)
+	defer nc.Close()
+
+	opts := JetStreamOpts{Durable: "test", AckWait: time.Second}
+	publisher, err := NewPublisherJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		err = publisher.Publish(&Crawl{ID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listener, err := NewListenerJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a is processed, b is taken but the listener stops before it is processed
+	c := listener.Listen()
+	ids := ackCrawls(t, listener, c, 1)
+	ids = append(ids, receiveCrawls(t, c, 1)...)
+	if ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("unexpected crawls %v", ids)
+	}
+
+	err = listener.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err = NewListenerJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ids = ackCrawls(t, listener, listener.Listen(), 1)
+	if ids[0] != "b" {
+		t.Errorf("expected the crawl that was not processed to be delivered again, got %v", ids)
+	}
+}
+
+func TestJetStreamDeadLetter(t *testing.T) {
+	s, stop := runJetStreamServer(t)
+	defer stop()
+
+	nc, js := connectJetStream(t, s)
+	defer nc.Close()
+
+	opts := JetStreamOpts{Durable: "test", MaxDeliver: 2, AckWait: 200 * time.Millisecond}
+
+	dead, err := nc.SubscribeSync(DefaultJetStreamDeadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := NewListenerJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Listen()
+	defer listener.Close()
+
+	// nothing reads from the listener so the crawl is never acknowledged
+	publisher, err := NewPublisherJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = publisher.Publish(&Crawl{ID: "stuck"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := dead.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c Crawl
+	_, err = Decode(msg.Data, &c)
+	if err != nil || c.ID != "stuck" {
+		t.Errorf("unexpected dead letter %s %v", msg.Data, err)
+	}
+
+	if msg.Header.Get("Crawl-Deliveries") != "2" || msg.Header.Get("Crawl-Subject") != DefaultJetStreamSubject {
+		t.Errorf("unexpected dead letter headers %v", msg.Header)
+	}
+
+	// a crawl that cannot be decoded is dead lettered straight away
+	_, err = js.Publish(DefaultJetStreamSubject, []byte("not a crawl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = dead.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(msg.Data) != "not a crawl" || msg.Header.Get("Crawl-Deliveries") != "1" || msg.Header.Get("Crawl-Error") == "" {
+		t.Errorf("unexpected dead letter %q %v", msg.Data, msg.Header)
+	}
+}
+
+func TestJetStreamNak(t *testing.T) {
+	s, stop := runJetStreamServer(t)
+	defer stop()
+
+	nc, js := connectJetStream(t, s)
+	defer nc.Close()
+
+	opts := JetStreamOpts{Durable: "test", MaxDeliver: 2, AckWait: 5 * time.Second}
+
+	dead, err := nc.SubscribeSync(DefaultJetStreamDeadLetter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publisher, err := NewPublisherJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = publisher.Publish(&Crawl{ID: "unstored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := NewListenerJetStream(js, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	c := listener.Listen()
+
+	// a crawl that could not be stored is delivered again straight away, well
+	// before AckWait, and dead lettered once it runs out of deliveries
+	for i := 0; i < 2; i++ {
+		crawl := takeCrawls(t, c, 1)[0]
+		if crawl.ID != "unstored" {
+			t.Fatalf("unexpected crawl %s", crawl.ID)
+		}
+		err = listener.Nak(crawl, errors.New("store is down"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := dead.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Crawl-Error") != "store is down" || msg.Header.Get("Crawl-Deliveries") != "2" {
+		t.Errorf("unexpected dead letter headers %v", msg.Header)
+	}
+}
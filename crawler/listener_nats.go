@@ -1,35 +1,41 @@
 package crawler
 
 import (
-	"encoding/json"
 	"log"
 
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
 // ListenerNats implements the Listener interface over the nats message bus
 type ListenerNats struct {
-	nc  *nats.Conn
-	c   chan *Crawl
-	sub *nats.Subscription
+	nc   *nats.Conn
+	c    chan *Crawl
+	sub  *nats.Subscription
+	opts NatsOpts
 }
 
 // NewListenerNats creates a new Nats listener for observing the output
-// of successful crawls
-func NewListenerNats(nc *nats.Conn) Listener {
+// of successful crawls in the namespace of the options
+func NewListenerNats(nc *nats.Conn, opts ...NatsOpts) Listener {
 	return &ListenerNats{
-		nc:  nc,
-		c:   make(chan *Crawl, 100),
-		sub: nil,
+		nc:   nc,
+		opts: natsOpts(opts),
+		c:    make(chan *Crawl, 100),
+		sub:  nil,
 	}
 }
 
 // Listen creates a channel that you can use to consume crawls
 func (ln *ListenerNats) Listen() chan *Crawl {
-	var err error
-	ln.sub, err = ln.nc.Subscribe("crawl_complete", func(msg *nats.Msg) {
+	subjects, err := ln.opts.subjects()
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	ln.sub, err = ln.nc.Subscribe(subjects.CrawlComplete, func(msg *nats.Msg) {
 		var c *Crawl
-		err := json.Unmarshal(msg.Data, &c)
+		_, err := Decode(msg.Data, &c)
 		if err != nil {
 			log.Println(err)
 			return
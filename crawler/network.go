@@ -0,0 +1,199 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// namedNetworks are the ranges a NetworkPolicy can deny or allow by name
+var namedNetworks = map[string][]string{
+	"loopback":    {"127.0.0.0/8", "::1/128"},
+	"private":     {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"},
+	"link-local":  {"169.254.0.0/16", "fe80::/10"},
+	"unspecified": {"0.0.0.0/8", "::/128"},
+	"multicast":   {"224.0.0.0/4", "ff00::/8"},
+}
+
+// DefaultDeniedNetworks keep the crawler to the public internet, away from the machine
+// it runs on, its private network and cloud metadata services
+var DefaultDeniedNetworks = []string{"loopback", "private", "link-local", "unspecified", "multicast"}
+
+// The most redirects a page may take, the same as the default of http.Client
+const maxRedirects = 10
+
+// NetworkOpts configures the addresses pages may be fetched from. A policy built from
+// empty options allows every address
+type NetworkOpts struct {
+	// Deny and Allow are networks in CIDR notation or the names loopback, private,
+	// link-local, unspecified and multicast. An address in an allowed network may be
+	// connected to even if it is also in a denied one
+	Deny  []string
+	Allow []string
+}
+
+// NetworkPolicy checks every address the worker connects to against the denied
+// networks. The check is made as each connection is dialled, after the host has been
+// resolved, so neither redirects nor a host that resolves differently the second time
+// can get around it.
+//
+// A page fetched through a proxy is connected to by the proxy, which resolves its host
+// itself. The proxy is then where the policy has to be enforced: the worker only refuses
+// pages and redirects whose host is an address the policy denies, as a host name could
+// resolve to another address by the time the proxy looks it up. A nil policy allows
+// every address
+type NetworkPolicy struct {
+	deny  []*net.IPNet
+	allow []*net.IPNet
+
+	transport *http.Transport
+}
+
+// NewNetworkPolicy parses the networks of the policy
+func NewNetworkPolicy(opts NetworkOpts) (*NetworkPolicy, error) {
+	deny, err := parseNetworks(opts.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	allow, err := parseNetworks(opts.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &NetworkPolicy{deny: deny, allow: allow}
+
+	// a proxy from the environment would be the address checked instead of the page's,
+	// pages are only proxied by the proxy pool
+	p.transport = http.DefaultTransport.(*http.Transport).Clone()
+	p.transport.Proxy = nil
+	p.transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.control,
+	}).DialContext
+
+	return p, nil
+}
+
+// defaultNetworkPolicy denies DefaultDeniedNetworks
+func defaultNetworkPolicy() *NetworkPolicy {
+	p, err := NewNetworkPolicy(NetworkOpts{Deny: DefaultDeniedNetworks})
+	if err != nil {
+		// only possible if DefaultDeniedNetworks was changed to a name that is not known
+		panic(err)
+	}
+	return p
+}
+
+func parseNetworks(names []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		cidrs, ok := namedNetworks[strings.ToLower(name)]
+		if !ok {
+			cidrs = []string{name}
+		}
+
+		for _, cidr := range cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, NewError(CodeInvalidRequest, fmt.Sprintf("invalid network %q", name))
+			}
+			networks = append(networks, network)
+		}
+	}
+	return networks, nil
+}
+
+// Allowed reports whether pages may be fetched from the address
+func (p *NetworkPolicy) Allowed(ip net.IP) bool {
+	if p == nil {
+		return true
+	}
+
+	for _, network := range p.allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	for _, network := range p.deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAddress refuses a host that is written as an address the policy denies. Host
+// names are left to the proxy that resolves them
+func (p *NetworkPolicy) checkAddress(host string) error {
+	if p == nil {
+		return nil
+	}
+
+	ip := parseAddress(host)
+	if ip == nil {
+		return nil
+	}
+	return p.check(ip)
+}
+
+// parseAddress parses a host that is an ip address, which for ipv6 may carry the zone
+// of its interface
+func parseAddress(host string) net.IP {
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	return net.ParseIP(host)
+}
+
+func (p *NetworkPolicy) check(ip net.IP) error {
+	if p.Allowed(ip) {
+		return nil
+	}
+	return NewError(CodeBlockedAddress, fmt.Sprintf("connecting to %s is not allowed", ip))
+}
+
+// control checks the address a connection is about to be made to
+func (p *NetworkPolicy) control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := parseAddress(host)
+	if ip == nil {
+		return NewError(CodeBlockedAddress, fmt.Sprintf("unable to check the address %s", address))
+	}
+	return p.check(ip)
+}
+
+// guard makes a client keep to the policy. A client with a transport of its own, such
+// as one for a proxy, has the proxy make its connections so only the redirects to a
+// denied address are refused
+func (p *NetworkPolicy) guard(client *http.Client) {
+	if p == nil {
+		return
+	}
+
+	if client.Transport == nil {
+		client.Transport = p.transport
+		return
+	}
+
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return errors.New("stopped after 10 redirects")
+		}
+		return p.checkAddress(req.URL.Hostname())
+	}
+}
@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestNetwork(t *testing.T, opts NetworkOpts) *NetworkPolicy {
+	network, err := NewNetworkPolicy(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return network
+}
+
+func TestNetworkPolicyAllowed(t *testing.T) {
+	policy, err := NewNetworkPolicy(NetworkOpts{Deny: DefaultDeniedNetworks, Allow: []string{"10.1.0.0/16"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.0.0.1":        false,
+		"::ffff:10.0.0.1": false,
+		"172.20.1.1":      false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"0.0.0.0":         false,
+		"239.1.1.1":       false,
+		"10.1.2.3":        true,
+	}
+	for ip, allowed := range cases {
+		if policy.Allowed(net.ParseIP(ip)) != allowed {
+			t.Errorf("expected %s to be allowed %t", ip, allowed)
+		}
+	}
+
+	var none *NetworkPolicy
+	if !none.Allowed(net.ParseIP("127.0.0.1")) || none.checkAddress("127.0.0.1") != nil {
+		t.Error("expected a nil policy to allow everything")
+	}
+
+	if policy.checkAddress("fe80::1%eth0") == nil || policy.checkAddress("internal.test") != nil {
+		t.Error("expected only denied addresses to be refused")
+	}
+
+	_, err = NewNetworkPolicy(NetworkOpts{Deny: []string{"intranet"}})
+	if err == nil {
+		t.Error("expected an unknown network to be rejected")
+	}
+}
+
+func TestNetworkPolicyCrawl(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	blocked := newTestService(t, ServiceOpts{Network: newTestNetwork(t, NetworkOpts{Deny: DefaultDeniedNetworks})})
+	for _, u := range []string{page.URL, strings.Replace(page.URL, "127.0.0.1", "localhost", 1)} {
+		c, err := blocked.Crawl(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.ErrorCode != string(CodeBlockedAddress) || c.Title != "" {
+			t.Errorf("expected %s to be blocked, got %q %q", u, c.ErrorCode, c.Error)
+		}
+	}
+
+	allowed := newTestService(t, ServiceOpts{Network: newTestNetwork(t, NetworkOpts{Deny: DefaultDeniedNetworks, Allow: []string{"127.0.0.1/32"}})})
+	c, err := allowed.Crawl(context.Background(), page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Error != "" || c.Title != "Test Page" {
+		t.Errorf("expected the allowed page to be fetched, got %q %q", c.Title, c.Error)
+	}
+
+	// a service without a policy denies the default networks
+	service, err := New(ServiceOpts{Logger: log.New(ioutil.Discard, "", 0)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = service.Crawl(context.Background(), page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ErrorCode != string(CodeBlockedAddress) {
+		t.Errorf("expected the default policy to block the page, got %q %q", c.ErrorCode, c.Error)
+	}
+}
+
+func TestNetworkPolicyRedirect(t *testing.T) {
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	// the page itself is allowed but the metadata service it redirects to is not
+	service := newTestService(t, ServiceOpts{Network: newTestNetwork(t, NetworkOpts{Deny: []string{"private", "link-local"}})})
+	c, err := service.Crawl(context.Background(), redirect.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ErrorCode != string(CodeBlockedAddress) || !strings.Contains(c.Error, "169.254.169.254") {
+		t.Errorf("expected the redirect to be blocked, got %q %q", c.ErrorCode, c.Error)
+	}
+}
+
+func TestNetworkPolicyProxy(t *testing.T) {
+	proxy := newTestProxy("proxy")
+	defer proxy.Close()
+
+	pool, err := NewProxyPool(ProxyOpts{Proxies: []Proxy{{URL: proxy.URL}}, Logger: log.New(ioutil.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// the proxy is on loopback but only the pages it fetches are checked, and of those
+	// only the ones whose host is an address
+	service := newTestService(t, ServiceOpts{Network: newTestNetwork(t, NetworkOpts{Deny: DefaultDeniedNetworks}), Proxies: pool})
+	c, err := service.Crawl(context.Background(), "http://169.254.169.254/latest/meta-data/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ErrorCode != string(CodeBlockedAddress) || proxy.served("169.254.169.254") != 0 {
+		t.Errorf("expected the page to be blocked before the proxy, got %q", c.ErrorCode)
+	}
+
+	for _, u := range []string{"http://93.184.216.34/", "http://internal.test/"} {
+		c, err = service.Crawl(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Error != "" || c.Title != "proxy" {
+			t.Errorf("expected %s to be left to the proxy, got %q %q", u, c.Title, c.Error)
+		}
+	}
+}
+
+func TestNetworkPolicyEnvironmentProxy(t *testing.T) {
+	proxy := newTestProxy("proxy")
+	defer proxy.Close()
+
+	os.Setenv("HTTP_PROXY", proxy.URL)
+	defer os.Unsetenv("HTTP_PROXY")
+
+	// the proxy is allowed, so only checking its address would let the pages through
+	network := newTestNetwork(t, NetworkOpts{Deny: DefaultDeniedNetworks, Allow: []string{"127.0.0.1/32"}})
+	if network.transport.Proxy != nil {
+		t.Fatal("expected the proxy of the environment not to be used")
+	}
+
+	service := newTestService(t, ServiceOpts{Network: network})
+	for _, u := range []string{"http://169.254.169.254/latest/meta-data/", "http://[::1]/"} {
+		c, err := service.Crawl(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.ErrorCode != string(CodeBlockedAddress) {
+			t.Errorf("expected %s to be blocked, got %q %q", u, c.ErrorCode, c.Error)
+		}
+	}
+	if proxy.served("169.254.169.254") != 0 || proxy.served("[::1]") != 0 {
+		t.Error("expected no page to be fetched through the proxy")
+	}
+}
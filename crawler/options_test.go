@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// seenRequest is what the option test server saw of the last request for a page
+type seenRequest struct {
+	method, body, agent, header, cookie string
+}
+
+// newOptionsPageServer serves a page with links, meta tags and json-ld, recording each
+// request it is sent
+func newOptionsPageServer() (*httptest.Server, func() seenRequest) {
+	var mu sync.Mutex
+	var seen seenRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		cookie, _ := r.Cookie("session")
+
+		mu.Lock()
+		seen = seenRequest{method: r.Method, body: string(body), agent: r.UserAgent(), header: r.Header.Get("X-Search")}
+		if cookie != nil {
+			seen.cookie = cookie.Value
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Test Page</title><meta name="author" content="sam">` +
+			`<script type="application/ld+json">{"@type":"Thing"}</script></head>` +
+			`<body><a href="/next">next</a></body></html>`))
+	}))
+
+	return server, func() seenRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+}
+
+func TestCrawlOptions(t *testing.T) {
+	page, seen := newOptionsPageServer()
+	defer page.Close()
+
+	ser := RunDefaultServer()
+	defer ser.Shutdown()
+
+	nc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", DefaultTestOptions.Host, DefaultTestOptions.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	service := newTestService(t, ServiceOpts{})
+
+	natsTransport := NewTransportNats(nc, service)
+	err = natsTransport.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer natsTransport.Stop(context.Background())
+
+	httpServer := httptest.NewServer(NewTransportHTTP("", service, HTTPOpts{}).(http.Handler))
+	defer httpServer.Close()
+
+	grpcClient, stop := newTestGRPCClient(t, service)
+	defer stop()
+
+	clients := map[string]Client{
+		"local": NewClientLocal(service),
+		"http":  NewClientHTTP(httpServer.URL, nil),
+		"grpc":  grpcClient,
+		"nats":  NewClientNats(nc),
+	}
+
+	opts := CrawlOptions{
+		Method:     "post",
+		Body:       "q=crawl",
+		Headers:    map[string]string{"X-Search": "yes"},
+		Cookies:    map[string]string{"session": "abc"},
+		UserAgent:  "crawl3-test",
+		IncludeRaw: true,
+		Stages:     []ExtractStage{StageLinks},
+		Timeout:    5 * time.Second,
+	}
+
+	for name, client := range clients {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		result, err := client.Crawl(ctx, page.URL, opts)
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		want := seenRequest{method: "POST", body: "q=crawl", agent: "crawl3-test", header: "yes", cookie: "abc"}
+		if got := seen(); got != want {
+			t.Errorf("%s: expected the request %+v, got %+v", name, want, got)
+		}
+
+		if result.RawData == "" {
+			t.Errorf("%s: expected the raw page", name)
+		}
+
+		if len(result.HarvestedURLs) != 1 || len(result.MetaData) != 0 || len(result.JSONData) != 0 {
+			t.Errorf("%s: expected only the links stage to run, got %+v", name, result)
+		}
+	}
+
+	// without options the page is fetched and extracted as before
+	result, err := service.Crawl(context.Background(), page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := seen(); got.method != "GET" || got.agent != defaultUserAgent {
+		t.Errorf("unexpected default request %+v", got)
+	}
+
+	if result.RawData != "" || len(result.MetaData) != 1 || len(result.JSONData) != 1 {
+		t.Errorf("expected every stage and no raw page, got %+v", result)
+	}
+}
+
+func TestCrawlQueuePriority(t *testing.T) {
+	q := &crawlQueue{}
+	push := func(url string, priority int) {
+		heap.Push(q, &Crawl{URL: url, opts: &CrawlOptions{Priority: priority}})
+	}
+
+	push("low", -1)
+	heap.Push(q, &Crawl{URL: "default"})
+	push("high", 10)
+	push("default-2", 0)
+	push("high-2", 10)
+
+	var order []string
+	for q.Len() > 0 {
+		order = append(order, heap.Pop(q).(*Crawl).URL)
+	}
+
+	want := []string{"high", "high-2", "default", "default-2", "low"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, order)
+	}
+}
+
+func TestCrawlOptionsMoreThanOne(t *testing.T) {
+	service := newTestService(t, ServiceOpts{})
+
+	_, err := service.Crawl(context.Background(), "http://example.com/", CrawlOptions{}, CrawlOptions{IncludeRaw: true})
+	if e, ok := err.(*Error); !ok || e.Code != CodeInvalidRequest {
+		t.Errorf("expected more than one CrawlOptions to be rejected, got %v", err)
+	}
+}
+
+func TestCrawlOptionsTimeoutWhileQueued(t *testing.T) {
+	release := make(chan struct{})
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.Write([]byte(`<html><head><title>Page</title></head></html>`))
+	}))
+	defer page.Close()
+	defer close(release)
+
+	// the only worker is busy with the slow page for longer than the timeout
+	service := newTestService(t, ServiceOpts{WorkerCount: 1})
+	_, err := service.CrawlAsync(context.Background(), page.URL+"/slow", func(*Crawl) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan *Crawl, 1)
+	_, err = service.CrawlAsync(context.Background(), page.URL, func(c *Crawl) { result <- c }, CrawlOptions{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	release <- struct{}{}
+
+	select {
+	case c := <-result:
+		if c.ErrorCode != string(CodeTimeout) || c.Title != "" {
+			t.Errorf("expected the crawl to time out while queued, got %q %q", c.ErrorCode, c.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the queued crawl to finish")
+	}
+}
+
+func TestCrawlCanceledWhileQueued(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.Write([]byte(`<html><head><title>Page</title></head></html>`))
+	}))
+	defer page.Close()
+
+	events := make(chan *CrawlEvent, 100)
+	service := newTestService(t, ServiceOpts{WorkerCount: 1, Events: NewEventSinkChan(events)})
+
+	// the only worker is busy with the slow page while the next crawl is queued
+	_, err := service.CrawlAsync(context.Background(), page.URL+"/slow", func(*Crawl) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		_, err := service.Crawl(ctx, page.URL+"/queued")
+		result <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err = <-result:
+		if e, ok := err.(*Error); !ok || e.Code != CodeCanceled {
+			t.Errorf("expected the crawl to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the crawl to return once its context was canceled")
+	}
+
+	close(release)
+	for skipped := false; !skipped; {
+		select {
+		case e := <-events:
+			skipped = e.Stage == CrawlFailed && e.URL == page.URL+"/queued"
+			if skipped && e.Error != "canceled: context canceled while waiting for a worker" {
+				t.Errorf("expected the queued crawl to fail as canceled, got %q", e.Error)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the queued crawl to be skipped")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fetched["/queued"] != 0 {
+		t.Error("expected the canceled crawl not to be fetched")
+	}
+}
@@ -0,0 +1,490 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// The defaults used for a ProxyOpts field that is not set
+const (
+	DefaultProxyMaxFailures         = 3
+	DefaultProxyEjectFor            = 5 * time.Minute
+	DefaultProxyHealthCheckInterval = time.Minute
+	DefaultProxyHealthCheckTimeout  = 10 * time.Second
+	DefaultProxyHostIdle            = 30 * time.Minute
+)
+
+// A Proxy is a proxy of the pool. The url is an http, https or socks5 url and may
+// hold a user and password. Tags let host models pick the proxies they are fetched
+// through, such as by the country a proxy is in
+type Proxy struct {
+	URL  string
+	Tags []string
+}
+
+// ParseProxy reads a proxy written as a url, or as tag=url to give it a tag
+func ParseProxy(s string) (Proxy, error) {
+	var p Proxy
+	if i := strings.Index(s, "="); i > 0 && !strings.Contains(s[:i], "://") {
+		p.Tags = []string{s[:i]}
+		s = s[i+1:]
+	}
+	p.URL = strings.TrimSpace(s)
+
+	_, err := parseProxyURL(p.URL)
+	if err != nil {
+		return Proxy{}, err
+	}
+	return p, nil
+}
+
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, NewError(CodeInvalidRequest, fmt.Sprintf("invalid proxy %q: %s", s, err))
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, NewError(CodeInvalidRequest, fmt.Sprintf("proxy %q is not an http, https or socks5 url", s))
+	}
+	if u.Host == "" {
+		return nil, NewError(CodeInvalidRequest, fmt.Sprintf("proxy %q has no host", s))
+	}
+	return u, nil
+}
+
+// ProxyOpts configures a proxy pool
+type ProxyOpts struct {
+	Proxies []Proxy
+
+	// Mode is used for the hosts whose model does not say how they are fetched,
+	// rotating through every proxy if empty
+	Mode shared.ProxyMode
+
+	// A proxy is ejected from the pool after MaxFailures requests through it fail in a
+	// row, and is tried again once EjectFor has passed
+	MaxFailures int
+	EjectFor    time.Duration
+
+	// HealthCheckURL is fetched through every proxy each HealthCheckInterval. A proxy
+	// that passes is put back in the pool straight away and one that fails counts it as
+	// a failure. Proxies are not checked if it is empty
+	HealthCheckURL      string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+
+	// HostIdle is how long the pool remembers the rotation and pinned proxy of a host
+	// that has not been fetched, so a broad crawl does not keep every host it has seen
+	HostIdle time.Duration
+
+	Instrument Instrument
+	Logger     *log.Logger
+}
+
+// ProxyStats describe a proxy of the pool
+type ProxyStats struct {
+	Proxy        string
+	Tags         []string
+	Healthy      bool
+	Requests     int64
+	Failures     int64
+	EjectedUntil time.Time
+	Hosts        int
+}
+
+// proxyState is a proxy of the pool and how it has behaved
+type proxyState struct {
+	name      string
+	tags      []string
+	transport *http.Transport
+
+	requests     int64
+	failures     int64
+	failing      int
+	ejectedUntil time.Time
+}
+
+func (ps *proxyState) healthy(now time.Time) bool {
+	return ps.ejectedUntil.IsZero() || now.After(ps.ejectedUntil)
+}
+
+// proxyHost is where a host that has been fetched through the pool is in its rotation,
+// or the proxy it is pinned to
+type proxyHost struct {
+	next   int
+	pinned *proxyState
+	used   time.Time
+}
+
+func (ps *proxyState) tagged(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, t := range ps.tags {
+		if containsFold(tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyPool picks the proxy each page is fetched through. Every host is rotated through
+// the proxies or pinned to one of them as its model says, and proxies whose requests
+// keep failing are left out until they recover. A nil pool fetches everything directly
+type ProxyPool struct {
+	opts    ProxyOpts
+	proxies []*proxyState
+
+	mu    sync.Mutex
+	hosts map[string]shared.HostProxyOpts
+	seen  map[string]*proxyHost
+	swept time.Time
+
+	quit chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// NewProxyPool checks the proxies and starts their health checks if there are any
+func NewProxyPool(opts ProxyOpts) (*ProxyPool, error) {
+	if opts.Mode == "" {
+		opts.Mode = shared.ProxyRotate
+	}
+	switch opts.Mode {
+	case shared.ProxyRotate, shared.ProxyPin, shared.ProxyDirect:
+	default:
+		return nil, NewError(CodeInvalidRequest, fmt.Sprintf("unknown proxy mode %q", opts.Mode))
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = DefaultProxyMaxFailures
+	}
+	if opts.EjectFor <= 0 {
+		opts.EjectFor = DefaultProxyEjectFor
+	}
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = DefaultProxyHealthCheckInterval
+	}
+	if opts.HealthCheckTimeout <= 0 {
+		opts.HealthCheckTimeout = DefaultProxyHealthCheckTimeout
+	}
+	if opts.HostIdle <= 0 {
+		opts.HostIdle = DefaultProxyHostIdle
+	}
+	if opts.Instrument == nil {
+		opts.Instrument = NewInstrumentationMem()
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	p := &ProxyPool{
+		opts:  opts,
+		hosts: make(map[string]shared.HostProxyOpts),
+		seen:  make(map[string]*proxyHost),
+		swept: time.Now(),
+		quit:  make(chan struct{}),
+	}
+
+	for _, proxy := range opts.Proxies {
+		u, err := parseProxyURL(proxy.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		// the name is kept without the password so it can be logged and published
+		name := *u
+		name.User = nil
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(u)
+
+		p.proxies = append(p.proxies, &proxyState{
+			name:      name.String(),
+			tags:      proxy.Tags,
+			transport: transport,
+		})
+	}
+
+	if opts.HealthCheckURL != "" && len(p.proxies) > 0 {
+		p.wg.Add(1)
+		go p.checkEvery(opts.HealthCheckInterval)
+	}
+
+	return p, nil
+}
+
+// SetHosts sets how the hosts of the models are fetched, replacing the models set
+// before. A host keeps the proxy it is pinned to if it can still use it
+func (p *ProxyPool) SetHosts(hosts []shared.Host) {
+	if p == nil {
+		return
+	}
+
+	configured := make(map[string]shared.HostProxyOpts)
+	for _, host := range hosts {
+		if host.Proxy == nil {
+			continue
+		}
+		for _, h := range append([]string{host.Host}, host.Alias...) {
+			configured[strings.ToLower(h)] = *host.Proxy
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.hosts = configured
+}
+
+// pick returns the proxy to fetch a page of the host through, or nil to fetch it
+// directly
+func (p *ProxyPool) pick(host string) (*proxyState, error) {
+	if p == nil || len(p.proxies) == 0 {
+		return nil, nil
+	}
+	host = strings.ToLower(host)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	opts, ok := p.hosts[host]
+	if !ok || opts.Mode == "" {
+		opts.Mode = p.opts.Mode
+	}
+	if opts.Mode == shared.ProxyDirect {
+		return nil, nil
+	}
+
+	now := time.Now()
+	p.sweep(now)
+
+	var candidates []*proxyState
+	for _, ps := range p.proxies {
+		if ps.tagged(opts.Tags) && ps.healthy(now) {
+			candidates = append(candidates, ps)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, NewError(CodeUnavailable, fmt.Sprintf("no healthy proxy for %s", host))
+	}
+
+	ph, ok := p.seen[host]
+	if !ok {
+		ph = &proxyHost{}
+		p.seen[host] = ph
+	}
+	ph.used = now
+
+	if opts.Mode != shared.ProxyPin {
+		ps := candidates[ph.next%len(candidates)]
+		ph.next++
+		return ps, nil
+	}
+
+	for _, c := range candidates {
+		if c == ph.pinned {
+			return c, nil
+		}
+	}
+
+	// pin the host to the proxy with the fewest hosts so they are spread over the pool
+	counts := p.pinnedCounts()
+	ps := candidates[0]
+	for _, c := range candidates[1:] {
+		if counts[c] < counts[ps] {
+			ps = c
+		}
+	}
+	ph.pinned = ps
+	return ps, nil
+}
+
+// sweep forgets the hosts that have not been fetched for HostIdle. It is called with
+// the lock held and only looks through the hosts once every HostIdle
+func (p *ProxyPool) sweep(now time.Time) {
+	if now.Sub(p.swept) < p.opts.HostIdle {
+		return
+	}
+	p.swept = now
+
+	for host, ph := range p.seen {
+		if now.Sub(ph.used) >= p.opts.HostIdle {
+			delete(p.seen, host)
+		}
+	}
+}
+
+// pinnedCounts is how many hosts are pinned to each proxy, called with the lock held
+func (p *ProxyPool) pinnedCounts() map[*proxyState]int {
+	counts := make(map[*proxyState]int)
+	for _, ph := range p.seen {
+		if ph.pinned != nil {
+			counts[ph.pinned]++
+		}
+	}
+	return counts
+}
+
+// report records whether a request through a proxy worked, ejecting the proxy once
+// too many fail in a row
+func (p *ProxyPool) report(ps *proxyState, ok bool) {
+	if p == nil || ps == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ps.requests++
+	if ok {
+		ps.failing = 0
+		ps.ejectedUntil = time.Time{}
+		return
+	}
+
+	ps.failures++
+	ps.failing++
+	p.opts.Instrument.Count("proxy_error")
+
+	now := time.Now()
+	if ps.failing >= p.opts.MaxFailures && ps.healthy(now) {
+		ps.ejectedUntil = now.Add(p.opts.EjectFor)
+		p.opts.Instrument.Count("proxy_ejected")
+		p.opts.Logger.Printf("proxy %s ejected after %d failures until %s", ps.name, ps.failing, ps.ejectedUntil.Format(time.RFC3339))
+	}
+}
+
+// Stats describe every proxy of the pool
+func (p *ProxyPool) Stats() []ProxyStats {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	counts := p.pinnedCounts()
+
+	now := time.Now()
+	stats := make([]ProxyStats, len(p.proxies))
+	for i, ps := range p.proxies {
+		stats[i] = ProxyStats{
+			Proxy:        ps.name,
+			Tags:         ps.tags,
+			Healthy:      ps.healthy(now),
+			Requests:     ps.requests,
+			Failures:     ps.failures,
+			EjectedUntil: ps.ejectedUntil,
+			Hosts:        counts[ps],
+		}
+	}
+	return stats
+}
+
+// CheckHealth fetches the health check url through every proxy
+func (p *ProxyPool) CheckHealth(ctx context.Context) {
+	if p == nil || p.opts.HealthCheckURL == "" {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, ps := range p.proxies {
+		wg.Add(1)
+		go func(ps *proxyState) {
+			defer wg.Done()
+			err := p.check(ctx, ps)
+			if err != nil {
+				p.opts.Logger.Printf("proxy %s failed its health check: %s", ps.name, err)
+			}
+			p.report(ps, err == nil)
+		}(ps)
+	}
+	wg.Wait()
+}
+
+func (p *ProxyPool) check(ctx context.Context, ps *proxyState) error {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.HealthCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", p.opts.HealthCheckURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := (&http.Client{Transport: ps.transport}).Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (p *ProxyPool) checkEvery(interval time.Duration) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.CheckHealth(context.Background())
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// Close stops the health checks and closes the idle connections to the proxies
+func (p *ProxyPool) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	p.once.Do(func() { close(p.quit) })
+	p.wg.Wait()
+
+	for _, ps := range p.proxies {
+		ps.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// proxyFailed reports whether a response means the proxy rather than the page failed.
+// Only failing to connect to, handshake with or log in to the proxy counts, so a slow or
+// broken site does not eject the proxies it is fetched through
+func proxyFailed(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp.StatusCode == http.StatusProxyAuthRequired
+	}
+
+	// the transport wraps the errors of dialing the proxy and of a CONNECT through it
+	var op *net.OpError
+	if errors.As(err, &op) {
+		if op.Op == "proxyconnect" {
+			return true
+		}
+		if strings.HasPrefix(op.Op, "socks") && op.Err != nil {
+			return strings.Contains(op.Err.Error(), "authentication")
+		}
+	}
+
+	// a CONNECT that is refused fails with the status the proxy replied with
+	return strings.Contains(err.Error(), "Proxy Authentication Required")
+}
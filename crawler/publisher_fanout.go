@@ -0,0 +1,308 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The defaults used for a Sink field that is not set
+const (
+	DefaultSinkBuffer     = 100
+	DefaultSinkRetryDelay = time.Second
+)
+
+// A Sink is one of the publishers a FanoutPublisher hands crawls to. Each sink has its
+// own queue and goroutine, so a slow or failing sink only holds up itself
+type Sink struct {
+	// Name identifies the sink in its stats and metrics
+	Name      string
+	Publisher Publisher
+
+	// Filter picks the crawls the sink is sent, every crawl when nil
+	Filter *SinkFilter
+
+	// Fields are the fields of Crawl the sink is sent, ID and URL are always kept.
+	// Every field is sent when empty
+	Fields []string
+
+	// Retries is how many more times a failed publish is tried, waiting RetryDelay
+	// and then twice as long each time
+	Retries    int
+	RetryDelay time.Duration
+
+	// Buffer is how many crawls can wait for the sink before new ones are dropped
+	Buffer int
+}
+
+// SinkOutcome is how a crawl ended, as matched by a SinkFilter
+type SinkOutcome string
+
+// The outcomes a SinkFilter can match
+const (
+	OutcomeAny     SinkOutcome = ""
+	OutcomeSuccess SinkOutcome = "success"
+	OutcomeError   SinkOutcome = "error"
+)
+
+// SinkFilter matches crawls by the host they came from, the content type of the page
+// and whether they failed. A field that is empty matches every crawl
+type SinkFilter struct {
+	Hosts        []string
+	ContentTypes []string
+	Outcome      SinkOutcome
+}
+
+// Match reports whether the crawl should be sent to the sink
+func (f *SinkFilter) Match(c *Crawl) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Hosts) > 0 && !containsFold(f.Hosts, c.Host()) {
+		return false
+	}
+
+	if len(f.ContentTypes) > 0 && !containsFold(f.ContentTypes, c.ContentType) {
+		return false
+	}
+
+	switch f.Outcome {
+	case OutcomeSuccess:
+		return c.Error == ""
+	case OutcomeError:
+		return c.Error != ""
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// SinkStats count what has happened to the crawls sent to a sink
+type SinkStats struct {
+	Published int64
+	Failed    int64
+	Retried   int64
+	Dropped   int64
+	Filtered  int64
+}
+
+// A FanoutPublisher publishes every crawl to each of its sinks that wants it. Publish
+// only queues the crawl, so the worker is never held up by a sink
+type FanoutPublisher struct {
+	sinks      []*fanoutSink
+	instrument Instrument
+
+	closed bool
+	mu     sync.RWMutex
+	wg     sync.WaitGroup
+}
+
+type fanoutSink struct {
+	Sink
+	fields []int
+	queue  chan *Crawl
+	stats  SinkStats
+}
+
+// NewFanoutPublisher starts a queue for each sink. The instrument counts what happens
+// to the crawls of each sink and may be nil
+func NewFanoutPublisher(instrument Instrument, sinks ...Sink) (*FanoutPublisher, error) {
+	if instrument == nil {
+		instrument = NewInstrumentationMem()
+	}
+
+	f := &FanoutPublisher{instrument: instrument}
+	names := make(map[string]bool)
+
+	for i, s := range sinks {
+		if s.Publisher == nil {
+			return nil, fmt.Errorf("sink %d has no publisher", i)
+		}
+		if s.Name == "" {
+			s.Name = "sink-" + strconv.Itoa(i)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("sink name %q is used twice", s.Name)
+		}
+		names[s.Name] = true
+
+		if s.Buffer <= 0 {
+			s.Buffer = DefaultSinkBuffer
+		}
+		if s.RetryDelay <= 0 {
+			s.RetryDelay = DefaultSinkRetryDelay
+		}
+
+		fields, err := crawlFields(s.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %s", s.Name, err)
+		}
+
+		f.sinks = append(f.sinks, &fanoutSink{
+			Sink:   s,
+			fields: fields,
+			queue:  make(chan *Crawl, s.Buffer),
+		})
+	}
+
+	for _, s := range f.sinks {
+		f.wg.Add(1)
+		go f.run(s)
+	}
+
+	return f, nil
+}
+
+// Publish queues the crawl for every sink whose filter matches it. An error is returned
+// if a sink was too far behind to take the crawl
+func (f *FanoutPublisher) Publish(c *Crawl) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return NewError(CodeUnavailable, "publisher is closed")
+	}
+
+	var dropped []string
+	for _, s := range f.sinks {
+		if !s.Filter.Match(c) {
+			atomic.AddInt64(&s.stats.Filtered, 1)
+			continue
+		}
+
+		select {
+		case s.queue <- projectCrawl(c, s.fields):
+		default:
+			atomic.AddInt64(&s.stats.Dropped, 1)
+			f.instrument.Count("publish_dropped." + s.Name)
+			dropped = append(dropped, s.Name)
+		}
+	}
+
+	if len(dropped) > 0 {
+		return NewError(CodeUnavailable, fmt.Sprintf("crawl %s dropped by full sinks: %s", c.ID, strings.Join(dropped, ", ")))
+	}
+	return nil
+}
+
+// Stats returns the counters of every sink by name
+func (f *FanoutPublisher) Stats() map[string]SinkStats {
+	stats := make(map[string]SinkStats, len(f.sinks))
+	for _, s := range f.sinks {
+		stats[s.Name] = SinkStats{
+			Published: atomic.LoadInt64(&s.stats.Published),
+			Failed:    atomic.LoadInt64(&s.stats.Failed),
+			Retried:   atomic.LoadInt64(&s.stats.Retried),
+			Dropped:   atomic.LoadInt64(&s.stats.Dropped),
+			Filtered:  atomic.LoadInt64(&s.stats.Filtered),
+		}
+	}
+	return stats
+}
+
+// Close stops taking crawls and waits for the sinks to publish those already queued,
+// or for the context to be done
+func (f *FanoutPublisher) Close(ctx context.Context) error {
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		for _, s := range f.sinks {
+			close(s.queue)
+		}
+	}
+	f.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *FanoutPublisher) run(s *fanoutSink) {
+	defer f.wg.Done()
+
+	for c := range s.queue {
+		f.publish(s, c)
+	}
+}
+
+// publish sends a crawl to the sink, retrying with a growing delay until it succeeds
+// or the retries run out
+func (f *FanoutPublisher) publish(s *fanoutSink, c *Crawl) {
+	delay := s.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := s.Publisher.Publish(c)
+		if err == nil {
+			atomic.AddInt64(&s.stats.Published, 1)
+			f.instrument.Count("publish_sent." + s.Name)
+			return
+		}
+
+		if attempt >= s.Retries {
+			atomic.AddInt64(&s.stats.Failed, 1)
+			f.instrument.Count("publish_failed." + s.Name)
+			log.Printf("sink %s gave up on crawl %s: %s", s.Name, c.ID, err)
+			return
+		}
+
+		atomic.AddInt64(&s.stats.Retried, 1)
+		f.instrument.Count("publish_retried." + s.Name)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// crawlFields finds the index of each named field of Crawl
+func crawlFields(names []string) ([]int, error) {
+	t := reflect.TypeOf(Crawl{})
+
+	var fields []int
+	for _, name := range names {
+		field, ok := t.FieldByName(name)
+		if !ok || field.PkgPath != "" {
+			return nil, fmt.Errorf("crawl has no field %q", name)
+		}
+		fields = append(fields, field.Index[0])
+	}
+	return fields, nil
+}
+
+// projectCrawl copies the crawl for a sink, keeping only the given fields if there are
+// any. The sink gets its own copy as it publishes after the worker has moved on
+func projectCrawl(c *Crawl, fields []int) *Crawl {
+	if len(fields) == 0 {
+		cp := *c
+		return &cp
+	}
+
+	out := &Crawl{ID: c.ID, URL: c.URL}
+	src := reflect.ValueOf(c).Elem()
+	dst := reflect.ValueOf(out).Elem()
+	for _, i := range fields {
+		dst.Field(i).Set(src.Field(i))
+	}
+	return out
+}
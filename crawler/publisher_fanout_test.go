@@ -0,0 +1,233 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher keeps every crawl it is sent, failing the first fails publishes
+// and waiting on block before each one if it is set
+type recordingPublisher struct {
+	fails int
+	block chan struct{}
+
+	crawls []*Crawl
+	calls  int
+	mu     sync.Mutex
+}
+
+func (p *recordingPublisher) Publish(c *Crawl) error {
+	if p.block != nil {
+		<-p.block
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.calls <= p.fails {
+		return errors.New("sink is down")
+	}
+	p.crawls = append(p.crawls, c)
+	return nil
+}
+
+func (p *recordingPublisher) published() []*Crawl {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Crawl(nil), p.crawls...)
+}
+
+func closeFanout(t *testing.T, f *FanoutPublisher) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := f.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFanoutFilterAndProjection(t *testing.T) {
+	all := &recordingPublisher{}
+	errs := &recordingPublisher{}
+	html := &recordingPublisher{}
+
+	f, err := NewFanoutPublisher(nil,
+		Sink{Name: "all", Publisher: all},
+		Sink{Name: "errors", Publisher: errs, Filter: &SinkFilter{Outcome: OutcomeError}},
+		Sink{Name: "html", Publisher: html, Filter: &SinkFilter{Hosts: []string{"example.com"}, ContentTypes: []string{"text/html"}}, Fields: []string{"Title"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crawls := []*Crawl{
+		{ID: "1", URL: "https://example.com/a", Title: "A", Description: "about a", ContentType: "text/html"},
+		{ID: "2", URL: "https://example.com/b.pdf", Title: "B", ContentType: "application/pdf"},
+		{ID: "3", URL: "https://other.com/", Title: "C", ContentType: "text/html", Error: "timeout"},
+	}
+	for _, c := range crawls {
+		err := f.Publish(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	closeFanout(t, f)
+
+	if len(all.published()) != 3 {
+		t.Errorf("expected every crawl, got %d", len(all.published()))
+	}
+
+	if got := errs.published(); len(got) != 1 || got[0].ID != "3" {
+		t.Errorf("expected only the failed crawl, got %+v", got)
+	}
+
+	got := html.published()
+	if len(got) != 1 || got[0].ID != "1" || got[0].URL != crawls[0].URL || got[0].Title != "A" || got[0].Description != "" {
+		t.Errorf("expected the projected html crawl, got %+v", got)
+	}
+
+	stats := f.Stats()
+	if stats["errors"].Filtered != 2 || stats["html"].Published != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestFanoutRetries(t *testing.T) {
+	flaky := &recordingPublisher{fails: 2}
+	down := &recordingPublisher{fails: 100}
+
+	f, err := NewFanoutPublisher(nil,
+		Sink{Name: "flaky", Publisher: flaky, Retries: 2, RetryDelay: time.Millisecond},
+		Sink{Name: "down", Publisher: down, Retries: 1, RetryDelay: time.Millisecond},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Publish(&Crawl{ID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeFanout(t, f)
+
+	stats := f.Stats()
+	if stats["flaky"].Published != 1 || stats["flaky"].Retried != 2 || stats["flaky"].Failed != 0 {
+		t.Errorf("expected the flaky sink to succeed on its last retry, got %+v", stats["flaky"])
+	}
+
+	if stats["down"].Published != 0 || stats["down"].Retried != 1 || stats["down"].Failed != 1 {
+		t.Errorf("expected the down sink to give up, got %+v", stats["down"])
+	}
+}
+
+func TestFanoutSlowSinkDoesNotStall(t *testing.T) {
+	block := make(chan struct{})
+	slow := &recordingPublisher{block: block}
+	fast := &recordingPublisher{}
+
+	f, err := NewFanoutPublisher(nil,
+		Sink{Name: "slow", Publisher: slow, Buffer: 1},
+		Sink{Name: "fast", Publisher: fast},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	var dropped int
+	for i := 0; i < 10; i++ {
+		if f.Publish(&Crawl{ID: "crawl"}) != nil {
+			dropped++
+		}
+	}
+
+	if time.Since(start) > time.Second {
+		t.Error("publishing waited on the slow sink")
+	}
+
+	close(block)
+	closeFanout(t, f)
+
+	if len(fast.published()) != 10 {
+		t.Errorf("expected the fast sink to get every crawl, got %d", len(fast.published()))
+	}
+
+	stats := f.Stats()
+	if dropped == 0 || stats["slow"].Dropped != int64(dropped) || stats["slow"].Published+stats["slow"].Dropped != 10 {
+		t.Errorf("expected the slow sink to drop what it could not queue, got %+v", stats["slow"])
+	}
+}
+
+func TestFanoutInvalidSinks(t *testing.T) {
+	_, err := NewFanoutPublisher(nil, Sink{Name: "a", Publisher: &recordingPublisher{}, Fields: []string{"NotAField"}})
+	if err == nil {
+		t.Error("expected an unknown field to be rejected")
+	}
+
+	_, err = NewFanoutPublisher(nil, Sink{Name: "a"})
+	if err == nil {
+		t.Error("expected a sink without a publisher to be rejected")
+	}
+
+	_, err = NewFanoutPublisher(nil, Sink{Name: "a", Publisher: &recordingPublisher{}}, Sink{Name: "a", Publisher: &recordingPublisher{}})
+	if err == nil {
+		t.Error("expected sink names to be unique")
+	}
+}
+
+func TestServiceSinks(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	primary := &recordingPublisher{}
+	extra := &recordingPublisher{}
+	errs := &recordingPublisher{}
+
+	fanout, err := NewFanoutPublisher(nil,
+		Sink{Name: "default", Publisher: primary, Filter: &SinkFilter{Outcome: OutcomeSuccess}},
+		Sink{Name: "extra", Publisher: extra, Filter: &SinkFilter{ContentTypes: []string{"text/html"}}},
+		Sink{Name: "errors", Publisher: errs, Filter: &SinkFilter{Outcome: OutcomeError}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, ServiceOpts{Publisher: fanout})
+
+	c, err := service.Crawl(context.Background(), page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ContentType != "text/html" {
+		t.Errorf("expected the content type of the page, got %q", c.ContentType)
+	}
+
+	// a page that fails is published too, for the sinks that want failures
+	c, err = service.Crawl(context.Background(), missing.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Error != "404 Not Found" {
+		t.Errorf("expected the crawl to fail, got %q", c.Error)
+	}
+
+	closeFanout(t, fanout)
+
+	if len(primary.published()) != 1 || len(extra.published()) != 1 {
+		t.Errorf("expected only the page to be published to the default and extra sinks, got %d %d", len(primary.published()), len(extra.published()))
+	}
+	if failed := errs.published(); len(failed) != 1 || failed[0].URL != missing.URL {
+		t.Errorf("expected the failed crawl to be published to the errors sink, got %v", failed)
+	}
+}
@@ -0,0 +1,210 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The defaults used for a FileOpts field that is not set
+const (
+	DefaultFilePrefix      = "crawls"
+	DefaultFileMaxBytes    = 256 << 20
+	DefaultFileRotateEvery = 24 * time.Hour
+)
+
+// The extensions of the files written by PublisherFile. The file being written has
+// fileActiveSuffix on the end until it is rotated, so readers only see whole files
+const (
+	fileExt          = ".jsonl"
+	fileGzipExt      = ".jsonl.gz"
+	fileActiveSuffix = ".tmp"
+)
+
+// FileOpts configures the file publisher
+type FileOpts struct {
+	// Dir is the directory the files are written to, it is created if needed
+	Dir string
+
+	// Prefix starts the name of every file, which goes on with the time the file was
+	// started so the files sort in the order they were written
+	Prefix string
+
+	// MaxBytes is how many bytes of crawls are written to a file before starting the
+	// next one, counted before compression
+	MaxBytes int64
+
+	// RotateEvery is how long a file is written to before starting the next one
+	RotateEvery time.Duration
+
+	// Compress gzips the files
+	Compress bool
+}
+
+func (o FileOpts) withDefaults() FileOpts {
+	if o.Prefix == "" {
+		o.Prefix = DefaultFilePrefix
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultFileMaxBytes
+	}
+	if o.RotateEvery <= 0 {
+		o.RotateEvery = DefaultFileRotateEvery
+	}
+	return o
+}
+
+// PublisherFile writes every crawl as a line of JSON to a file in a directory, starting
+// a new file when the current one gets too big or too old. The files can be replayed
+// with a ListenerFile
+type PublisherFile struct {
+	opts FileOpts
+
+	file    *os.File
+	buf     *bufio.Writer
+	gz      *gzip.Writer
+	w       io.Writer
+	name    string
+	written int64
+	started time.Time
+	closed  bool
+	mu      sync.Mutex
+}
+
+// NewPublisherFile creates a publisher writing to the directory of the options. The
+// first file is only started when the first crawl is published
+func NewPublisherFile(opts FileOpts) (*PublisherFile, error) {
+	opts = opts.withDefaults()
+
+	if opts.Dir == "" {
+		return nil, NewError(CodeInvalidRequest, "the file publisher needs a directory")
+	}
+
+	err := os.MkdirAll(opts.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublisherFile{opts: opts}, nil
+}
+
+// Publish appends the crawl to the current file
+func (p *PublisherFile) Publish(c *Crawl) error {
+	d, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	d = append(d, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return NewError(CodeUnavailable, "publisher is closed")
+	}
+
+	if p.file != nil && (p.written >= p.opts.MaxBytes || time.Since(p.started) >= p.opts.RotateEvery) {
+		err = p.finish()
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.file == nil {
+		err = p.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := p.w.Write(d)
+	p.written += int64(n)
+	return err
+}
+
+// Rotate finishes the current file so it can be read, the next crawl starts a new one
+func (p *PublisherFile) Rotate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file == nil {
+		return nil
+	}
+	return p.finish()
+}
+
+// Close finishes the current file and stops taking crawls
+func (p *PublisherFile) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	if p.file == nil {
+		return nil
+	}
+	return p.finish()
+}
+
+func (p *PublisherFile) open() error {
+	ext := fileExt
+	if p.opts.Compress {
+		ext = fileGzipExt
+	}
+
+	p.started = time.Now()
+	p.name = filepath.Join(p.opts.Dir, p.opts.Prefix+"-"+p.started.UTC().Format("20060102T150405.000000000")+ext)
+
+	file, err := os.OpenFile(p.name+fileActiveSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	p.file = file
+	p.buf = bufio.NewWriter(file)
+	p.w = p.buf
+	if p.opts.Compress {
+		p.gz = gzip.NewWriter(p.buf)
+		p.w = p.gz
+	}
+	p.written = 0
+	return nil
+}
+
+// finish flushes and closes the current file and gives it its final name
+func (p *PublisherFile) finish() error {
+	file := p.file
+	p.file = nil
+
+	var err error
+	if p.gz != nil {
+		err = p.gz.Close()
+		p.gz = nil
+	}
+	if err == nil {
+		err = p.buf.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+
+	cerr := file.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(p.name+fileActiveSuffix, p.name)
+}
+
+// isCrawlFile reports whether the file was written by a PublisherFile and is finished
+func isCrawlFile(name string) bool {
+	return strings.HasSuffix(name, fileExt) || strings.HasSuffix(name, fileGzipExt)
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// The defaults used for a JetStreamOpts field that is not set
+const (
+	DefaultJetStreamStream     = "CRAWLS"
+	DefaultJetStreamSubject    = "crawl_complete"
+	DefaultJetStreamDeadLetter = "crawl_dead_letter"
+	DefaultJetStreamDurable    = "crawl_listener"
+	DefaultJetStreamMaxDeliver = 5
+	DefaultJetStreamAckWait    = 30 * time.Second
+)
+
+// JetStreamOpts configures the durable publisher and listener. Completed crawls and
+// dead letters are both kept in the stream so neither is lost while nobody is listening
+type JetStreamOpts struct {
+	// Stream is the name of the stream the crawls are stored in
+	Stream string
+
+	// Subject is where completed crawls are published
+	Subject string
+
+	// DeadLetterSubject is where crawls that could not be delivered end up
+	DeadLetterSubject string
+
+	// Durable is the name of the consumer, which remembers how far through the
+	// stream the listener has got between restarts
+	Durable string
+
+	// MaxDeliver is how many times a crawl is delivered before it is dead lettered
+	MaxDeliver int
+
+	// AckWait is how long the listener has to acknowledge a crawl before it is
+	// delivered again
+	AckWait time.Duration
+
+	// MaxAge is how long crawls are kept in the stream, forever when zero
+	MaxAge time.Duration
+
+	// Namespace prefixes the default stream and subjects, so it must match the
+	// namespace of the nats services
+	Namespace string
+
+	Encoding Encoding
+}
+
+func (o JetStreamOpts) withDefaults() (JetStreamOpts, error) {
+	subjects, err := NewSubjects(o.Namespace)
+	if err != nil {
+		return o, err
+	}
+
+	if o.Stream == "" {
+		o.Stream = DefaultJetStreamStream
+		if o.Namespace != "" {
+			// stream names cannot contain dots
+			o.Stream = strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(o.Namespace)) + "_" + o.Stream
+		}
+	}
+	if o.Subject == "" {
+		o.Subject = subjects.CrawlComplete
+	}
+	if o.DeadLetterSubject == "" {
+		o.DeadLetterSubject = strings.TrimSuffix(subjects.CrawlComplete, DefaultJetStreamSubject) + DefaultJetStreamDeadLetter
+	}
+	if o.Durable == "" {
+		o.Durable = DefaultJetStreamDurable
+	}
+	if o.MaxDeliver <= 0 {
+		o.MaxDeliver = DefaultJetStreamMaxDeliver
+	}
+	if o.AckWait <= 0 {
+		o.AckWait = DefaultJetStreamAckWait
+	}
+	return o, nil
+}
+
+// EnsureJetStream creates the stream the crawls are stored in if it does not exist
+func EnsureJetStream(js nats.JetStreamContext, opts JetStreamOpts) error {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return err
+	}
+
+	_, err = js.StreamInfo(opts.Stream)
+	if err == nil {
+		return nil
+	}
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     opts.Stream,
+		Subjects: []string{opts.Subject, opts.DeadLetterSubject},
+		Storage:  nats.FileStorage,
+		MaxAge:   opts.MaxAge,
+	})
+	return err
+}
+
+type publisherJetStream struct {
+	js   nats.JetStreamContext
+	opts JetStreamOpts
+}
+
+// NewPublisherJetStream creates a publisher that stores completed crawls in a JetStream
+// stream, creating the stream if needed. Publishing waits for the server to store the
+// crawl, and the crawl id is used to drop duplicates if a publish is retried
+func NewPublisherJetStream(js nats.JetStreamContext, opts JetStreamOpts) (Publisher, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	err = EnsureJetStream(js, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publisherJetStream{
+		js:   js,
+		opts: opts,
+	}, nil
+}
+
+// Publish stores a completed crawl in the stream
+func (p *publisherJetStream) Publish(c *Crawl) error {
+	d, err := p.opts.Encoding.Encode(c)
+	if err != nil {
+		return err
+	}
+
+	var pubOpts []nats.PubOpt
+	if c.ID != "" {
+		pubOpts = append(pubOpts, nats.MsgId(c.ID))
+	}
+
+	_, err = p.js.Publish(p.opts.Subject, d, pubOpts...)
+	return err
+}
@@ -1,30 +1,41 @@
 package crawler
 
 import (
-	"encoding/json"
-
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
 type publisherNats struct {
-	conn *nats.Conn
+	conn     *nats.Conn
+	enc      Encoding
+	subjects Subjects
+	err      error
 }
 
 // NewPublisherNats creates the transport for the nats service
-func NewPublisherNats(conn *nats.Conn) Publisher {
+func NewPublisherNats(conn *nats.Conn, opts ...NatsOpts) Publisher {
+	o := natsOpts(opts)
+	subjects, err := o.subjects()
+
 	return &publisherNats{
-		conn: conn,
+		conn:     conn,
+		enc:      o.Encoding,
+		subjects: subjects,
+		err:      err,
 	}
 }
 
 // Publish pushes a completed crawl onto the message bus
 func (p *publisherNats) Publish(c *Crawl) error {
-	d, err := json.Marshal(c)
+	if p.err != nil {
+		return p.err
+	}
+
+	d, err := p.enc.Encode(c)
 	if err != nil {
 		return err
 	}
 
-	err = p.conn.Publish("crawl_complete", d)
+	err = p.conn.Publish(p.subjects.CrawlComplete, d)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,439 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The headers of a webhook delivery. The signature is the hex HMAC-SHA256, keyed by
+// the secret of the endpoint, of the timestamp, a dot and the body
+const (
+	WebhookTimestampHeader = "X-Crawl3-Timestamp"
+	WebhookSignatureHeader = "X-Crawl3-Signature"
+	WebhookDeliveryHeader  = "X-Crawl3-Delivery"
+)
+
+// The defaults used for a WebhookOpts field that is not set
+const (
+	DefaultWebhookRetryDelay  = time.Second
+	DefaultWebhookTimeout     = 10 * time.Second
+	DefaultWebhookMaxAttempts = 100
+	DefaultWebhookMaxAge      = 7 * 24 * time.Hour
+)
+
+// webhookDeadDir is the directory of the outbox that deliveries which will not be tried
+// again are moved to
+const webhookDeadDir = "dead"
+
+// A WebhookEndpoint is a url crawls are posted to
+type WebhookEndpoint struct {
+	// Name identifies the endpoint in logs and the outbox, the url is used if empty
+	Name string
+	URL  string
+
+	// Secret signs every delivery, deliveries are not signed when empty
+	Secret string
+
+	// Filter picks the crawls the endpoint is sent, such as those of its hosts. Every
+	// crawl is sent when nil
+	Filter *SinkFilter
+
+	// Headers are added to every request
+	Headers map[string]string
+}
+
+// WebhookOpts configures the webhook publisher
+type WebhookOpts struct {
+	Endpoints []WebhookEndpoint
+
+	// Retries is how many more times a failed delivery is tried, waiting RetryDelay
+	// and then twice as long each time. Only network errors, 429 and 5xx responses
+	// are retried
+	Retries    int
+	RetryDelay time.Duration
+
+	// Timeout limits each request
+	Timeout time.Duration
+
+	// OutboxDir is the directory deliveries that still failed are saved in so they can
+	// be sent again with FlushOutbox. Failed deliveries are dropped when empty
+	OutboxDir string
+
+	// OutboxInterval is how often the outbox is flushed in the background, only when
+	// FlushOutbox is called if zero
+	OutboxInterval time.Duration
+
+	// MaxAttempts and MaxAge are how many times and for how long a delivery is tried
+	// before it is given up on. Deliveries that are given up on, or that fail in a way
+	// that is not retried, are moved to the dead directory of the outbox
+	MaxAttempts int
+	MaxAge      time.Duration
+
+	Client *http.Client
+}
+
+// webhookDelivery is a delivery saved in the outbox
+type webhookDelivery struct {
+	ID       string
+	Endpoint string
+	Body     json.RawMessage
+	Attempts int
+	Error    string
+	Created  time.Time
+	Failed   time.Time
+}
+
+// PublisherWebhook posts every crawl as JSON to each endpoint whose filter matches it.
+// Publish waits for the deliveries, so use it as a Sink of the service to keep the
+// workers from waiting on slow endpoints
+type PublisherWebhook struct {
+	opts      WebhookOpts
+	endpoints map[string]WebhookEndpoint
+
+	quit    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+	flushMu sync.Mutex
+}
+
+// NewPublisherWebhook checks the endpoints and creates the outbox directory if needed
+func NewPublisherWebhook(opts WebhookOpts) (*PublisherWebhook, error) {
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultWebhookRetryDelay
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultWebhookTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultWebhookMaxAge
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+
+	p := &PublisherWebhook{
+		opts:      opts,
+		endpoints: make(map[string]WebhookEndpoint),
+		quit:      make(chan struct{}),
+	}
+	p.opts.Endpoints = make([]WebhookEndpoint, len(opts.Endpoints))
+
+	for i, e := range opts.Endpoints {
+		if !strings.HasPrefix(e.URL, "http://") && !strings.HasPrefix(e.URL, "https://") {
+			return nil, NewError(CodeInvalidRequest, fmt.Sprintf("webhook %d has no http url", i))
+		}
+		if e.Name == "" {
+			e.Name = e.URL
+		}
+		if _, ok := p.endpoints[e.Name]; ok {
+			return nil, NewError(CodeInvalidRequest, fmt.Sprintf("webhook name %q is used twice", e.Name))
+		}
+		p.endpoints[e.Name] = e
+		p.opts.Endpoints[i] = e
+	}
+
+	if opts.OutboxDir != "" {
+		err := os.MkdirAll(opts.OutboxDir, 0755)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.OutboxInterval > 0 {
+			p.wg.Add(1)
+			go p.flushEvery(opts.OutboxInterval)
+		}
+	}
+
+	return p, nil
+}
+
+// Publish delivers the crawl to every endpoint that wants it. Deliveries that fail are
+// saved in the outbox, or in its dead directory if they are not worth retrying, and the
+// last of their errors is returned
+func (p *PublisherWebhook) Publish(c *Crawl) error {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	var last error
+	for _, e := range p.opts.Endpoints {
+		if !e.Filter.Match(c) {
+			continue
+		}
+
+		d := &webhookDelivery{ID: c.ID, Endpoint: e.Name, Body: body, Created: time.Now()}
+		retry, err := p.deliver(context.Background(), e, d, p.opts.Retries)
+		if err != nil {
+			last = fmt.Errorf("webhook %s: %s", e.Name, err)
+			if retry {
+				p.save(d, err)
+			} else {
+				p.bury(d, err)
+			}
+		}
+	}
+	return last
+}
+
+// FlushOutbox sends the deliveries in the outbox again, once each, and removes those
+// that succeed. Those that fail in a way that is not retried, or that have run out of
+// attempts or age, are moved to the dead directory. It returns how many were delivered
+func (p *PublisherWebhook) FlushOutbox(ctx context.Context) (int, error) {
+	if p.opts.OutboxDir == "" {
+		return 0, nil
+	}
+
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(p.opts.OutboxDir, "*.json"))
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		var d webhookDelivery
+		err = json.Unmarshal(data, &d)
+		if err != nil {
+			log.Println(file, err)
+			continue
+		}
+
+		// deliveries saved before they had a creation time are aged from their last try
+		if d.Created.IsZero() {
+			d.Created = d.Failed
+		}
+
+		e, ok := p.endpoints[d.Endpoint]
+		if !ok {
+			log.Printf("outbox %s is for unknown webhook %s", file, d.Endpoint)
+			continue
+		}
+
+		retry, err := p.deliver(ctx, e, &d, 0)
+		if err != nil && retry && d.Attempts < p.opts.MaxAttempts && time.Since(d.Created) < p.opts.MaxAge {
+			p.write(file, &d, err)
+			continue
+		}
+
+		if err != nil {
+			p.bury(&d, err)
+		} else {
+			delivered++
+		}
+		err = os.Remove(file)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return delivered, nil
+}
+
+// Close stops flushing the outbox in the background
+func (p *PublisherWebhook) Close() error {
+	p.once.Do(func() { close(p.quit) })
+	p.wg.Wait()
+	return nil
+}
+
+func (p *PublisherWebhook) flushEvery(interval time.Duration) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err := p.FlushOutbox(context.Background())
+			if err != nil {
+				log.Println(err)
+			}
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// deliver posts the body to the endpoint, retrying with a growing delay. It reports
+// whether a delivery that failed is worth trying again later
+func (p *PublisherWebhook) deliver(ctx context.Context, e WebhookEndpoint, d *webhookDelivery, retries int) (bool, error) {
+	delay := p.opts.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		d.Attempts++
+		retry, err := p.post(ctx, e, d)
+		if err == nil {
+			return false, nil
+		}
+
+		if !retry || attempt >= retries {
+			return retry, err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-p.quit:
+			return true, err
+		}
+		delay *= 2
+	}
+}
+
+// post makes one delivery and reports whether a failure is worth retrying
+func (p *PublisherWebhook) post(ctx context.Context, e WebhookEndpoint, d *webhookDelivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookDeliveryHeader, d.ID)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	if e.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(e.Secret, timestamp, d.Body))
+	}
+
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("%s replied %s", e.URL, resp.Status)
+}
+
+var outboxNameReplacer = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// save puts a delivery that failed in the outbox
+func (p *PublisherWebhook) save(d *webhookDelivery, err error) {
+	if p.opts.OutboxDir == "" {
+		log.Printf("dropped delivery of %s to %s: %s", d.ID, d.Endpoint, err)
+		return
+	}
+
+	p.write(filepath.Join(p.opts.OutboxDir, outboxName(d)), d, err)
+}
+
+// bury moves a delivery that will not be tried again to the dead directory of the
+// outbox, where it is kept to be looked at
+func (p *PublisherWebhook) bury(d *webhookDelivery, err error) {
+	if p.opts.OutboxDir == "" {
+		log.Printf("dropped delivery of %s to %s: %s", d.ID, d.Endpoint, err)
+		return
+	}
+
+	dir := filepath.Join(p.opts.OutboxDir, webhookDeadDir)
+	mkErr := os.MkdirAll(dir, 0755)
+	if mkErr != nil {
+		log.Println(mkErr)
+		return
+	}
+
+	log.Printf("gave up on delivery of %s to %s after %d attempts: %s", d.ID, d.Endpoint, d.Attempts, err)
+	p.write(filepath.Join(dir, outboxName(d)), d, err)
+}
+
+func outboxName(d *webhookDelivery) string {
+	return outboxNameReplacer.ReplaceAllString(d.Endpoint, "_") + "-" + strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + outboxNameReplacer.ReplaceAllString(d.ID, "_") + ".json"
+}
+
+// write saves the delivery to the file through a temporary file, so the outbox never
+// holds half a delivery
+func (p *PublisherWebhook) write(file string, d *webhookDelivery, err error) {
+	d.Error = err.Error()
+	d.Failed = time.Now()
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	tmp := file + fileActiveSuffix
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// SignWebhook returns the signature of a delivery, as sent in WebhookSignatureHeader
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature of a delivery received by an endpoint, and that it
+// was signed no more than tolerance ago so it cannot be replayed later
+func VerifyWebhook(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(WebhookTimestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return NewError(CodeInvalidRequest, "missing or invalid webhook timestamp")
+	}
+
+	if tolerance > 0 && math.Abs(time.Since(time.Unix(sent, 0)).Seconds()) > tolerance.Seconds() {
+		return NewError(CodeInvalidRequest, "webhook timestamp is too old")
+	}
+
+	expected := SignWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(WebhookSignatureHeader))) {
+		return NewError(CodeInvalidRequest, "webhook signature does not match")
+	}
+	return nil
+}
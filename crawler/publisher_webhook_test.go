@@ -0,0 +1,254 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the crawls posted to it, failing requests while down
+type webhookReceiver struct {
+	secret string
+	down   int
+	status int
+
+	crawls []string
+	calls  int
+	errs   []error
+	mu     sync.Mutex
+}
+
+func (rc *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.calls++
+	if rc.calls <= rc.down {
+		w.WriteHeader(rc.status)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	err := VerifyWebhook(rc.secret, r.Header, body, time.Minute)
+	if err != nil {
+		rc.errs = append(rc.errs, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var c Crawl
+	json.Unmarshal(body, &c)
+	rc.crawls = append(rc.crawls, c.ID)
+}
+
+func (rc *webhookReceiver) received() ([]string, []error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]string(nil), rc.crawls...), rc.errs
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	flaky := &webhookReceiver{secret: "one", down: 2, status: http.StatusServiceUnavailable}
+	other := &webhookReceiver{secret: "two"}
+
+	flakyServer := httptest.NewServer(flaky)
+	defer flakyServer.Close()
+	otherServer := httptest.NewServer(other)
+	defer otherServer.Close()
+
+	p, err := NewPublisherWebhook(WebhookOpts{
+		Endpoints: []WebhookEndpoint{
+			{Name: "flaky", URL: flakyServer.URL, Secret: "one"},
+			{Name: "other", URL: otherServer.URL, Secret: "two", Filter: &SinkFilter{Hosts: []string{"other.com"}}},
+		},
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, c := range []*Crawl{{ID: "1", URL: "https://example.com/"}, {ID: "2", URL: "https://other.com/"}} {
+		err := p.Publish(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, errs := flaky.received()
+	if len(got) != 2 || len(errs) > 0 {
+		t.Errorf("expected both crawls after retrying, got %v %v", got, errs)
+	}
+
+	got, errs = other.received()
+	if len(got) != 1 || got[0] != "2" || len(errs) > 0 {
+		t.Errorf("expected only the crawl of other.com, got %v %v", got, errs)
+	}
+}
+
+func TestWebhookOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl3-outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	receiver := &webhookReceiver{secret: "secret", down: 2, status: http.StatusInternalServerError}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	p, err := NewPublisherWebhook(WebhookOpts{
+		Endpoints:  []WebhookEndpoint{{Name: "partner", URL: server.URL, Secret: "secret"}},
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+		OutboxDir:  dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	err = p.Publish(&Crawl{ID: "1", URL: "https://example.com/"})
+	if err == nil {
+		t.Fatal("expected the delivery to fail")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("expected the delivery in the outbox, got %v", files)
+	}
+
+	delivered, err := p.FlushOutbox(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, errs := receiver.received()
+	if delivered != 1 || len(got) != 1 || got[0] != "1" || len(errs) > 0 {
+		t.Errorf("expected the outbox to be delivered, got %d %v %v", delivered, got, errs)
+	}
+
+	files, _ = filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 0 {
+		t.Errorf("expected the outbox to be empty, got %v", files)
+	}
+}
+
+func TestWebhookNotRetried(t *testing.T) {
+	receiver := &webhookReceiver{down: 1, status: http.StatusBadRequest}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	p, err := NewPublisherWebhook(WebhookOpts{
+		Endpoints:  []WebhookEndpoint{{URL: server.URL}},
+		Retries:    3,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	err = p.Publish(&Crawl{ID: "1"})
+
+	receiver.mu.Lock()
+	calls := receiver.calls
+	receiver.mu.Unlock()
+
+	if err == nil || calls != 1 {
+		t.Errorf("expected a bad request not to be retried, got %v after %d calls", err, calls)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl3-outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rejected := httptest.NewServer(&webhookReceiver{down: 1, status: http.StatusGone})
+	defer rejected.Close()
+	down := httptest.NewServer(&webhookReceiver{down: 100, status: http.StatusServiceUnavailable})
+	defer down.Close()
+
+	p, err := NewPublisherWebhook(WebhookOpts{
+		Endpoints:   []WebhookEndpoint{{Name: "gone", URL: rejected.URL}, {Name: "down", URL: down.URL}},
+		RetryDelay:  time.Millisecond,
+		OutboxDir:   dir,
+		MaxAttempts: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	err = p.Publish(&Crawl{ID: "1"})
+	if err == nil {
+		t.Fatal("expected the deliveries to fail")
+	}
+
+	outbox, _ := filepath.Glob(filepath.Join(dir, "down-*.json"))
+	dead, _ := filepath.Glob(filepath.Join(dir, webhookDeadDir, "gone-*.json"))
+	if len(outbox) != 1 || len(dead) != 1 {
+		t.Fatalf("expected only the retryable delivery in the outbox, got %v and %v", outbox, dead)
+	}
+
+	// the delivery that keeps failing is given up on after its last attempt
+	for i := 0; i < 2; i++ {
+		_, err = p.FlushOutbox(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outbox, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	dead, _ = filepath.Glob(filepath.Join(dir, webhookDeadDir, "*.json"))
+	if len(outbox) != 0 || len(dead) != 2 {
+		t.Fatalf("expected both deliveries to be dead, got %v and %v", outbox, dead)
+	}
+
+	data, err := ioutil.ReadFile(dead[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d webhookDelivery
+	err = json.Unmarshal(data, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Endpoint == "down" && d.Attempts != 3 || d.Endpoint == "gone" && d.Attempts != 1 || d.Created.IsZero() {
+		t.Errorf("unexpected dead delivery %+v", d)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"ID":"1"}`)
+	header := http.Header{}
+
+	timestamp := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	header.Set(WebhookTimestampHeader, timestamp)
+	header.Set(WebhookSignatureHeader, SignWebhook("secret", timestamp, body))
+
+	if err := VerifyWebhook("secret", header, body, 0); err != nil {
+		t.Errorf("expected the signature to match, got %s", err)
+	}
+	if err := VerifyWebhook("secret", header, body, time.Minute); err == nil {
+		t.Error("expected an old delivery to be rejected")
+	}
+	if err := VerifyWebhook("wrong", header, body, 0); err == nil {
+		t.Error("expected the wrong secret to be rejected")
+	}
+	if err := VerifyWebhook("secret", header, []byte(`{"ID":"2"}`), 0); err == nil {
+		t.Error("expected a changed body to be rejected")
+	}
+}
@@ -0,0 +1,46 @@
+package crawler
+
+// crawlQueue holds the crawls waiting for a worker as a heap. Crawls with a higher
+// priority come out first, and crawls of the same priority in the order they arrived
+type crawlQueue struct {
+	items []queuedCrawl
+	next  uint64
+}
+
+type queuedCrawl struct {
+	crawl    *Crawl
+	priority int
+	seq      uint64
+}
+
+func (q *crawlQueue) Len() int { return len(q.items) }
+
+func (q *crawlQueue) Less(i, j int) bool {
+	if q.items[i].priority != q.items[j].priority {
+		return q.items[i].priority > q.items[j].priority
+	}
+	return q.items[i].seq < q.items[j].seq
+}
+
+func (q *crawlQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+// Push adds a *Crawl, use heap.Push rather than calling it directly
+func (q *crawlQueue) Push(x interface{}) {
+	crawl := x.(*Crawl)
+
+	var priority int
+	if crawl.opts != nil {
+		priority = crawl.opts.Priority
+	}
+
+	q.items = append(q.items, queuedCrawl{crawl: crawl, priority: priority, seq: q.next})
+	q.next++
+}
+
+// Pop removes the last *Crawl, use heap.Pop rather than calling it directly
+func (q *crawlQueue) Pop() interface{} {
+	last := q.items[len(q.items)-1]
+	q.items[len(q.items)-1] = queuedCrawl{}
+	q.items = q.items[:len(q.items)-1]
+	return last.crawl
+}
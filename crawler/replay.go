@@ -0,0 +1,325 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ReplayOpts configures a replay of archived pages through the extractors
+type ReplayOpts struct {
+	// Paths are the WARC files and the files of a PublisherFile to replay, or the
+	// directories and glob patterns holding them. Saved crawls are only replayed if
+	// they kept their raw data
+	Paths []string
+
+	// Hosts limits the replay to the pages of these hosts
+	Hosts []string
+
+	// From and To limit the replay to the pages fetched from From up to To. Either
+	// can be left zero
+	From time.Time
+	To   time.Time
+
+	Extractors      Extractors
+	ContentHandlers *ContentHandlers
+	Publisher       Publisher
+	Instrument      Instrument
+	Logger          *log.Logger
+}
+
+// ReplayStats count what happened to the pages read by a replay
+type ReplayStats struct {
+	Read     int
+	Replayed int
+	Skipped  int
+	Failed   int
+}
+
+// archivedPage is a page read back from an archive
+type archivedPage struct {
+	id          string
+	url         string
+	fetched     time.Time
+	statusCode  int
+	contentType string
+	body        []byte
+	raw         string
+}
+
+// warcLocation is where a response record can be read again
+type warcLocation struct {
+	file   string
+	offset int64
+	id     string
+}
+
+type replayer struct {
+	opts  ReplayOpts
+	stats ReplayStats
+
+	// the responses read so far by id and payload digest, so revisits can find them
+	byID     map[string]warcLocation
+	byDigest map[string]warcLocation
+}
+
+// Replay runs archived pages through the same extraction as a worker and publishes the
+// crawls it gives. A crawl keeps the id it was saved with, or the record id of its WARC
+// response, so replaying the same page again gives the same id
+func Replay(ctx context.Context, opts ReplayOpts) (ReplayStats, error) {
+	if opts.Publisher == nil {
+		return ReplayStats{}, NewError(CodeInvalidRequest, "a replay needs a publisher")
+	}
+	if opts.Extractors == nil {
+		opts.Extractors = NewDefaultExtractors()
+	}
+	if opts.ContentHandlers == nil {
+		opts.ContentHandlers = NewContentHandlers()
+	}
+	if opts.Instrument == nil {
+		opts.Instrument = NewInstrumentationMem()
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	files, err := findFiles(opts.Paths, func(name string) bool {
+		return isCrawlFile(name) || isWARCFile(name)
+	})
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	if len(files) == 0 {
+		return ReplayStats{}, NewError(CodeNotFound, fmt.Sprintf("no archives found in %s", strings.Join(opts.Paths, ", ")))
+	}
+
+	r := &replayer{
+		opts:     opts,
+		byID:     make(map[string]warcLocation),
+		byDigest: make(map[string]warcLocation),
+	}
+
+	for _, file := range files {
+		if isWARCFile(file) {
+			err = r.replayWARC(ctx, file)
+		} else {
+			err = r.replayCrawls(ctx, file)
+		}
+
+		if ctx.Err() != nil {
+			return r.stats, ctx.Err()
+		}
+		if err != nil {
+			opts.Logger.Println(file, err)
+		}
+	}
+
+	return r.stats, nil
+}
+
+// replayWARC replays the responses of a WARC file, and the revisits whose response has
+// been read
+func (r *replayer) replayWARC(ctx context.Context, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader, err := NewWARCReader(f)
+	if err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		typ := rec.Type()
+		if typ != "response" && typ != "revisit" {
+			continue
+		}
+
+		if typ == "response" {
+			loc := warcLocation{file: file, offset: rec.Offset, id: rec.ID()}
+			r.byID[loc.id] = loc
+			if digest := rec.Header.Get("WARC-Payload-Digest"); digest != "" {
+				if _, ok := r.byDigest[digest]; !ok {
+					r.byDigest[digest] = loc
+				}
+			}
+		}
+
+		r.stats.Read++
+		if !r.wants(rec.TargetURI(), rec.Date()) {
+			r.stats.Skipped++
+			continue
+		}
+
+		resp, body, err := rec.HTTPResponse()
+		if err != nil {
+			r.opts.Logger.Printf("%s %s: %s", file, rec.ID(), err)
+			r.stats.Failed++
+			continue
+		}
+
+		if typ == "revisit" {
+			body, err = r.revisited(rec)
+			if err != nil {
+				r.opts.Logger.Printf("%s %s: %s", file, rec.ID(), err)
+				r.stats.Skipped++
+				continue
+			}
+		}
+
+		r.replay(&archivedPage{
+			id:          strings.TrimSuffix(strings.TrimPrefix(rec.ID(), "<urn:uuid:"), ">"),
+			url:         rec.TargetURI(),
+			fetched:     rec.Date(),
+			statusCode:  resp.StatusCode,
+			contentType: mediaType(resp.Header.Get("Content-Type")),
+			body:        body,
+		})
+	}
+	return ctx.Err()
+}
+
+// revisited reads the body of the response a revisit refers to
+func (r *replayer) revisited(rec *WARCRecord) ([]byte, error) {
+	loc, ok := r.byID[rec.Header.Get("WARC-Refers-To")]
+	if !ok {
+		loc, ok = r.byDigest[rec.Header.Get("WARC-Payload-Digest")]
+	}
+	if !ok {
+		return nil, NewError(CodeNotFound, "the response the revisit refers to has not been read")
+	}
+
+	f, err := os.Open(loc.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.Seek(loc.offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := NewWARCReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		original, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if original.ID() == loc.id {
+			_, body, err := original.HTTPResponse()
+			return body, err
+		}
+	}
+}
+
+// replayCrawls replays the crawls saved by a PublisherFile that kept their raw data
+func (r *replayer) replayCrawls(ctx context.Context, file string) error {
+	_, err := eachCrawlLine(file, func(line int64, d []byte) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		var c Crawl
+		err := json.Unmarshal(d, &c)
+		if err != nil {
+			r.opts.Logger.Printf("%s line %d: %s", file, line, err)
+			r.stats.Failed++
+			return true
+		}
+
+		r.stats.Read++
+
+		fetched := c.FetchTime
+		if fetched.IsZero() {
+			fetched = c.StartTime
+		}
+
+		if c.RawData == "" || c.Error != "" || !r.wants(c.URL, fetched) {
+			r.stats.Skipped++
+			return true
+		}
+
+		r.replay(&archivedPage{
+			id:          c.ID,
+			url:         c.URL,
+			fetched:     fetched,
+			contentType: c.ContentType,
+			body:        []byte(c.RawData),
+			raw:         c.RawData,
+		})
+		return true
+	})
+	return err
+}
+
+// wants reports whether a page fetched from the url at the time is part of the replay
+func (r *replayer) wants(pageURL string, fetched time.Time) bool {
+	if len(r.opts.Hosts) > 0 && !containsFold(r.opts.Hosts, (&Crawl{URL: pageURL}).Host()) {
+		return false
+	}
+	if !r.opts.From.IsZero() && fetched.Before(r.opts.From) {
+		return false
+	}
+	if !r.opts.To.IsZero() && !fetched.Before(r.opts.To) {
+		return false
+	}
+	return true
+}
+
+// replay extracts a page as a worker would once it had fetched it and publishes the crawl
+func (r *replayer) replay(p *archivedPage) {
+	if p.statusCode >= 400 {
+		r.stats.Skipped++
+		return
+	}
+
+	u := &Crawl{
+		ID:          p.id,
+		URL:         p.url,
+		LoadedTime:  time.Now(),
+		StartTime:   p.fetched,
+		FetchTime:   p.fetched,
+		ContentType: p.contentType,
+		RawData:     p.raw,
+	}
+
+	err := extractFetched(u, p.body, r.opts.ContentHandlers, r.opts.Extractors, r.opts.Instrument, r.opts.Logger)
+	if err != nil {
+		r.opts.Logger.Printf("unable to extract %s: %s", p.url, err)
+		r.stats.Failed++
+		return
+	}
+
+	u.EndTime = time.Now()
+
+	err = r.opts.Publisher.Publish(u)
+	if err != nil {
+		r.opts.Logger.Println(err)
+		r.stats.Failed++
+		return
+	}
+
+	r.opts.Instrument.Count("replay_crawl")
+	r.stats.Replayed++
+}
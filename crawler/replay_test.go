@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReplayWARC(t *testing.T) {
+	for _, compress := range []bool{true, false} {
+		testReplayWARC(t, compress)
+	}
+}
+
+func testReplayWARC(t *testing.T, compress bool) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	dir, err := ioutil.TempDir("", "crawl3-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writer, err := NewWARCWriter(WARCOpts{Dir: dir, Compress: compress})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, ServiceOpts{Archiver: writer})
+
+	// both urls serve the same page, so the second is archived as a revisit
+	urls := []string{page.URL + "/one", page.URL + "/two"}
+	for _, u := range urls {
+		_, err := service.Crawl(context.Background(), u)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+
+	logger := log.New(ioutil.Discard, "", 0)
+	replayed := &recordingPublisher{}
+	stats, err := Replay(context.Background(), ReplayOpts{Paths: []string{dir}, Publisher: replayed, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crawls := replayed.published()
+	if stats.Read != 2 || stats.Replayed != 2 || len(crawls) != 2 {
+		t.Fatalf("expected both pages to be replayed, got %+v", stats)
+	}
+
+	for i, c := range crawls {
+		if c.URL != urls[i] || c.Title != "Test Page" || c.ContentType != "text/html" || c.ID == "" {
+			t.Errorf("unexpected replayed crawl %+v", c)
+		}
+		if len(c.HarvestedURLs) != 1 || c.HarvestedURLs[0] != page.URL+"/next" {
+			t.Errorf("expected the links of the page, got %v", c.HarvestedURLs)
+		}
+	}
+
+	// a second replay gives the crawls the same ids
+	again := &recordingPublisher{}
+	_, err = Replay(context.Background(), ReplayOpts{Paths: []string{dir}, Publisher: again, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.published()[0].ID != crawls[0].ID {
+		t.Error("expected replays to keep the ids of the pages")
+	}
+
+	filtered := []ReplayOpts{
+		{Hosts: []string{"example.com"}},
+		{To: time.Now().Add(-time.Hour)},
+		{From: time.Now().Add(time.Hour)},
+	}
+	for _, opts := range filtered {
+		opts.Paths = []string{dir}
+		opts.Publisher = &recordingPublisher{}
+		opts.Logger = logger
+
+		stats, err := Replay(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Replayed != 0 || stats.Skipped != 2 {
+			t.Errorf("expected every page to be filtered out, got %+v", stats)
+		}
+	}
+}
+
+func TestReplayCrawlFiles(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	dir, err := ioutil.TempDir("", "crawl3-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := NewPublisherFile(FileOpts{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, ServiceOpts{Publisher: files})
+
+	raw, err := service.Crawl(context.Background(), page.URL, CrawlOptions{IncludeRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without its raw data a saved crawl cannot be replayed
+	_, err = service.Crawl(context.Background(), page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files.Close()
+
+	replayed := &recordingPublisher{}
+	stats, err := Replay(context.Background(), ReplayOpts{
+		Paths:     []string{dir},
+		Publisher: replayed,
+		Logger:    log.New(ioutil.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crawls := replayed.published()
+	if stats.Read != 2 || stats.Replayed != 1 || stats.Skipped != 1 || len(crawls) != 1 {
+		t.Fatalf("expected only the crawl with raw data to be replayed, got %+v", stats)
+	}
+
+	if crawls[0].ID != raw.ID || crawls[0].Title != "Test Page" || crawls[0].PageHash != raw.PageHash {
+		t.Errorf("expected the crawl to be regenerated, got %+v", crawls[0])
+	}
+}
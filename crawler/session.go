@@ -0,0 +1,722 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// The defaults used for a SessionOpts field that is not set
+const (
+	DefaultLoginBackoff    = time.Minute
+	DefaultLoginMaxBackoff = time.Hour
+	DefaultSessionHostIdle = 30 * time.Minute
+)
+
+// SessionOpts configures the cookie jars and logins of the hosts
+type SessionOpts struct {
+	// Dir is where the cookies of each host are saved so they last across restarts,
+	// they are only kept in memory when empty
+	Dir string
+
+	// SecretsFile is a JSON object of the values ${secret:NAME} references in a login
+	// can use. It is read each time a host logs in
+	SecretsFile string
+
+	// LoginBackoff is how long the crawls of a host fail without trying again after
+	// its login failed. It doubles with each failure in a row up to LoginMaxBackoff, so
+	// wrong credentials do not lock the account
+	LoginBackoff    time.Duration
+	LoginMaxBackoff time.Duration
+
+	// HostIdle is how long the session of a host that has not been crawled is kept
+	HostIdle time.Duration
+
+	Instrument Instrument
+	Logger     *log.Logger
+}
+
+// Sessions keep a cookie jar for every host so cookies last from one crawl of a host to
+// the next, and log in to the hosts whose model has a login, logging in again when the
+// session expires. A nil Sessions fetches every page without cookies
+type Sessions struct {
+	opts SessionOpts
+
+	mu       sync.Mutex
+	logins   map[string]*shared.HostLoginOpts
+	sessions map[string]*session
+	swept    time.Time
+}
+
+// NewSessions creates the directory the cookies are saved in if needed
+func NewSessions(opts SessionOpts) (*Sessions, error) {
+	if opts.Instrument == nil {
+		opts.Instrument = NewInstrumentationMem()
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+	if opts.LoginBackoff <= 0 {
+		opts.LoginBackoff = DefaultLoginBackoff
+	}
+	if opts.LoginMaxBackoff <= 0 {
+		opts.LoginMaxBackoff = DefaultLoginMaxBackoff
+	}
+	if opts.HostIdle <= 0 {
+		opts.HostIdle = DefaultSessionHostIdle
+	}
+
+	if opts.Dir != "" {
+		err := os.MkdirAll(opts.Dir, 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Sessions{
+		opts:     opts,
+		logins:   make(map[string]*shared.HostLoginOpts),
+		sessions: make(map[string]*session),
+		swept:    time.Now(),
+	}, nil
+}
+
+// SetHosts sets the logins of the hosts of the models, replacing the models set before.
+// A host whose login changed logs in again before its next page, and the session of a
+// host whose login was removed is forgotten once its cookies are saved
+func (s *Sessions) SetHosts(hosts []shared.Host) {
+	if s == nil {
+		return
+	}
+
+	logins := make(map[string]*shared.HostLoginOpts)
+	for _, host := range hosts {
+		if host.Login == nil {
+			continue
+		}
+		for _, h := range append([]string{host.Host}, host.Alias...) {
+			logins[strings.ToLower(h)] = host.Login
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logins = logins
+	for host, sess := range s.sessions {
+		if sess.hasLogin() && logins[host] == nil {
+			s.forget(host, sess)
+			continue
+		}
+		sess.setLogin(logins[host])
+	}
+}
+
+// session returns the session of a host, loading its saved cookies the first time
+func (s *Sessions) session(host string) (*session, error) {
+	if s == nil {
+		return nil, nil
+	}
+	host = strings.ToLower(host)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	if sess, ok := s.sessions[host]; ok {
+		sess.used = now
+		return sess, nil
+	}
+
+	jar, err := newSavedJar(s.jarFile(host), s.opts.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &session{host: host, jar: jar, sessions: s, used: now}
+	sess.setLogin(s.logins[host])
+	s.sessions[host] = sess
+	return sess, nil
+}
+
+// sweep forgets the hosts that have not been crawled for HostIdle. It is called with the
+// lock held and only looks through the hosts once every HostIdle
+func (s *Sessions) sweep(now time.Time) {
+	if now.Sub(s.swept) < s.opts.HostIdle {
+		return
+	}
+	s.swept = now
+
+	for host, sess := range s.sessions {
+		if now.Sub(sess.used) >= s.opts.HostIdle {
+			s.forget(host, sess)
+		}
+	}
+}
+
+// forget removes the session of a host, saving its cookies first so they are loaded
+// again if the host is crawled later. It is called with the lock held
+func (s *Sessions) forget(host string, sess *session) {
+	err := sess.jar.flush()
+	if err != nil {
+		s.opts.Logger.Println(err)
+	}
+	delete(s.sessions, host)
+}
+
+// Flush saves the cookies that changed since the jars were last saved, for when the
+// crawler shuts down
+func (s *Sessions) Flush() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	jars := make([]*savedJar, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		jars = append(jars, sess.jar)
+	}
+	s.mu.Unlock()
+
+	var failed error
+	for _, jar := range jars {
+		err := jar.flush()
+		if err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+func (s *Sessions) jarFile(host string) string {
+	if s.opts.Dir == "" {
+		return ""
+	}
+	return filepath.Join(s.opts.Dir, strings.NewReplacer(":", "_", "/", "_").Replace(host)+".json")
+}
+
+// credential reads the value a ${env:NAME} or ${secret:NAME} reference points at
+func (s *Sessions) credential(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", NewError(CodeInvalidRequest, fmt.Sprintf("the environment variable %s is not set", name))
+		}
+		return value, nil
+
+	case "secret":
+		if s.opts.SecretsFile == "" {
+			return "", NewError(CodeInvalidRequest, fmt.Sprintf("no secrets file to read %s from", name))
+		}
+
+		data, err := ioutil.ReadFile(s.opts.SecretsFile)
+		if err != nil {
+			return "", err
+		}
+
+		var secrets map[string]string
+		err = json.Unmarshal(data, &secrets)
+		if err != nil {
+			return "", fmt.Errorf("unable to read secrets file: %s", err)
+		}
+
+		value, ok := secrets[name]
+		if !ok {
+			return "", NewError(CodeInvalidRequest, fmt.Sprintf("the secret %s is not in the secrets file", name))
+		}
+		return value, nil
+	}
+
+	return "", NewError(CodeInvalidRequest, fmt.Sprintf("unknown credential %s:%s", kind, name))
+}
+
+// session is the cookie jar and login state of a host
+type session struct {
+	host     string
+	jar      *savedJar
+	sessions *Sessions
+
+	// used is when the host was last crawled, guarded by the lock of the sessions
+	used time.Time
+
+	mu         sync.Mutex
+	login      *shared.HostLoginOpts
+	loggedIn   bool
+	generation int
+
+	// the last login failure, which crawls fail with until retryAt
+	failure  error
+	failures int
+	retryAt  time.Time
+}
+
+func (sess *session) setLogin(login *shared.HostLoginOpts) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.login != login {
+		sess.login = login
+		sess.loggedIn = false
+		sess.failure = nil
+		sess.failures = 0
+	}
+}
+
+func (sess *session) hasLogin() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.login != nil
+}
+
+// ensure logs in before the first page of a host that has a login, unless cookies
+// saved from an earlier run hold the cookie the login is checked by. It returns the
+// generation of the session the page is fetched with
+func (sess *session) ensure(client *http.Client, page *url.URL) (int, error) {
+	if sess == nil {
+		return 0, nil
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.login == nil || sess.loggedIn {
+		return sess.generation, nil
+	}
+
+	// any other cookie, such as one for tracking, says nothing about the session
+	cookie := sess.login.Success.Cookie
+	if cookie != "" && hasCookie(sess.jar.Cookies(page), cookie) {
+		return sess.generation, nil
+	}
+
+	return sess.generation, sess.relogin(client)
+}
+
+// expired reports whether a page shows the session of the host has run out
+func (sess *session) expired(page *url.URL, resp *http.Response, body []byte) bool {
+	if sess == nil {
+		return false
+	}
+
+	sess.mu.Lock()
+	login := sess.login
+	sess.mu.Unlock()
+
+	if login == nil {
+		return false
+	}
+
+	check := login.Expired
+	if check == nil {
+		return resp.StatusCode == http.StatusUnauthorized
+	}
+
+	if len(check.Status) > 0 && containsInt(check.Status, resp.StatusCode) {
+		return true
+	}
+	if check.Contains != "" && bytes.Contains(body, []byte(check.Contains)) {
+		return true
+	}
+	if check.Cookie != "" && !hasCookie(sess.jar.Cookies(page), check.Cookie) {
+		return true
+	}
+	if check.URL != "" && matchesURL(check.URL, resp) {
+		return true
+	}
+	return false
+}
+
+// renew logs in again after a page of the session of the given generation expired,
+// unless another page has already done so
+func (sess *session) renew(client *http.Client, generation int) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.login == nil || sess.generation != generation {
+		return nil
+	}
+
+	sess.sessions.opts.Instrument.Count("session_expired")
+	return sess.relogin(client)
+}
+
+// relogin runs the login of the host, it is called holding the lock of the session. After
+// a failed login it returns the same error without trying again until the backoff ends
+func (sess *session) relogin(client *http.Client) error {
+	opts := sess.sessions.opts
+	if sess.failure != nil && time.Now().Before(sess.retryAt) {
+		return sess.failure
+	}
+
+	err := sess.doLogin(client, sess.login)
+	if err != nil {
+		backoff := opts.LoginBackoff
+		for i := 0; i < sess.failures && backoff < opts.LoginMaxBackoff; i++ {
+			backoff *= 2
+		}
+		if backoff > opts.LoginMaxBackoff {
+			backoff = opts.LoginMaxBackoff
+		}
+
+		opts.Instrument.Count("login_error")
+		opts.Logger.Printf("unable to log in to %s, trying again in %s: %s", sess.host, backoff, err)
+		sess.loggedIn = false
+		sess.failures++
+		sess.retryAt = time.Now().Add(backoff)
+		sess.failure = NewError(CodeUnavailable, fmt.Sprintf("unable to log in to %s: %s", sess.host, err))
+		return sess.failure
+	}
+
+	opts.Instrument.Count("login")
+	opts.Logger.Printf("logged in to %s", sess.host)
+	sess.loggedIn = true
+	sess.generation++
+	sess.failure = nil
+	sess.failures = 0
+	return nil
+}
+
+func (sess *session) doLogin(client *http.Client, login *shared.HostLoginOpts) error {
+	loginURL, err := url.Parse(login.URL)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{}
+	action := loginURL
+	if login.Action != "" {
+		action, err = loginURL.Parse(login.Action)
+		if err != nil {
+			return err
+		}
+	}
+
+	if login.Form != "" {
+		action, err = sess.readForm(client, loginURL, login, form)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, value := range login.Fields {
+		resolved, err := sess.resolve(value)
+		if err != nil {
+			return err
+		}
+		form.Set(name, resolved)
+	}
+
+	req, err := http.NewRequest("POST", action.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", defaultUserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return checkLogin(login.Success, resp, body, sess.jar.Cookies(loginURL))
+}
+
+// readForm fetches the login page and fills the form with the inputs it already has,
+// such as hidden tokens, returning where the form is posted
+func (sess *session) readForm(client *http.Client, loginURL *url.URL, login *shared.HostLoginOpts, form url.Values) (*url.URL, error) {
+	req, err := http.NewRequest("GET", loginURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("login page returned %s", resp.Status)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	sel := doc.Find(login.Form).First()
+	if sel.Length() == 0 {
+		return nil, fmt.Errorf("no form {%s} on the login page", login.Form)
+	}
+
+	sel.Find("input[name]").Each(func(_ int, input *goquery.Selection) {
+		name, _ := input.Attr("name")
+		value, _ := input.Attr("value")
+		typ, _ := input.Attr("type")
+
+		typ = strings.ToLower(typ)
+		if (typ == "checkbox" || typ == "radio") && input.AttrOr("checked", "-") == "-" {
+			return
+		}
+		if typ == "submit" || typ == "button" || typ == "image" {
+			return
+		}
+		form.Set(name, value)
+	})
+
+	// the form is posted to its action relative to the page it came from
+	action := resp.Request.URL
+	if login.Action != "" {
+		return action.Parse(login.Action)
+	}
+	if attr, ok := sel.Attr("action"); ok && attr != "" {
+		return action.Parse(attr)
+	}
+	return action, nil
+}
+
+// resolve replaces the credential references of a field with their values
+func (sess *session) resolve(value string) (string, error) {
+	var failed error
+	resolved := shared.CredentialPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		m := shared.CredentialPattern.FindStringSubmatch(ref)
+		v, err := sess.sessions.credential(m[1], m[2])
+		if err != nil && failed == nil {
+			failed = err
+		}
+		return v
+	})
+	return resolved, failed
+}
+
+// checkLogin reports why a login failed the success check, or nil if it succeeded
+func checkLogin(check shared.LoginCheck, resp *http.Response, body []byte, cookies []*http.Cookie) error {
+	if len(check.Status) > 0 {
+		if !containsInt(check.Status, resp.StatusCode) {
+			return fmt.Errorf("login returned %s", resp.Status)
+		}
+	} else if resp.StatusCode >= 400 {
+		return fmt.Errorf("login returned %s", resp.Status)
+	}
+
+	if check.Contains != "" && !bytes.Contains(body, []byte(check.Contains)) {
+		return fmt.Errorf("login response does not contain %q", check.Contains)
+	}
+	if check.Cookie != "" && !hasCookie(cookies, check.Cookie) {
+		return fmt.Errorf("login did not set the cookie %s", check.Cookie)
+	}
+	if check.URL != "" && !matchesURL(check.URL, resp) {
+		return fmt.Errorf("login ended at %s", resp.Request.URL)
+	}
+	return nil
+}
+
+func containsInt(list []int, n int) bool {
+	for _, i := range list {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCookie(cookies []*http.Cookie, name string) bool {
+	for _, c := range cookies {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesURL reports whether the url a response ended at, after any redirects, matches
+// the pattern
+func matchesURL(pattern string, resp *http.Response) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil || resp.Request == nil {
+		return false
+	}
+	return re.MatchString(resp.Request.URL.String())
+}
+
+// savedCookie is a cookie as it is saved, with the url it was set by
+type savedCookie struct {
+	URL    string
+	Cookie *http.Cookie
+}
+
+// jarSaveDelay is how long a jar waits after its cookies change before saving them, so
+// the cookies set by a run of responses are saved once
+const jarSaveDelay = time.Second
+
+// savedJar is a cookie jar that saves its cookies to a file shortly after they change
+type savedJar struct {
+	jar    *cookiejar.Jar
+	file   string
+	logger *log.Logger
+
+	mu      sync.Mutex
+	cookies map[string]savedCookie
+	pending *time.Timer
+
+	// saving keeps saves in the order their cookies were taken
+	saving sync.Mutex
+}
+
+func newSavedJar(file string, logger *log.Logger) (*savedJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &savedJar{jar: jar, file: file, logger: logger, cookies: make(map[string]savedCookie)}
+	if file == "" {
+		return j, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []savedCookie
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cookies from %s: %s", file, err)
+	}
+
+	now := time.Now()
+	for _, sc := range saved {
+		if sc.Cookie == nil || (!sc.Cookie.Expires.IsZero() && sc.Cookie.Expires.Before(now)) {
+			continue
+		}
+
+		u, err := url.Parse(sc.URL)
+		if err != nil {
+			continue
+		}
+
+		j.jar.SetCookies(u, []*http.Cookie{sc.Cookie})
+		j.cookies[cookieKey(u, sc.Cookie)] = sc
+	}
+	return j, nil
+}
+
+// Cookies returns the cookies to send to the url
+func (j *savedJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// SetCookies keeps the cookies of a response and saves the jar in the background
+func (j *savedJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+	if j.file == "" {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		key := cookieKey(u, c)
+
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+
+		// a max age is saved as the time it runs out so it is not restarted on load
+		saved := *c
+		if saved.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		j.cookies[key] = savedCookie{URL: u.String(), Cookie: &saved}
+	}
+
+	if j.pending == nil {
+		j.pending = time.AfterFunc(jarSaveDelay, func() {
+			err := j.flush()
+			if err != nil {
+				j.logger.Println(err)
+			}
+		})
+	}
+}
+
+// flush saves the cookies if they changed since they were last saved
+func (j *savedJar) flush() error {
+	j.saving.Lock()
+	defer j.saving.Unlock()
+
+	j.mu.Lock()
+	if j.pending == nil {
+		j.mu.Unlock()
+		return nil
+	}
+	j.pending.Stop()
+	j.pending = nil
+
+	saved := make([]savedCookie, 0, len(j.cookies))
+	for _, sc := range j.cookies {
+		saved = append(saved, sc)
+	}
+	j.mu.Unlock()
+
+	return j.save(saved)
+}
+
+// save writes the cookies to a temporary file and moves it over the last save
+func (j *savedJar) save(saved []savedCookie) error {
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	tmp := j.file + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.file)
+}
+
+func cookieKey(u *url.URL, c *http.Cookie) string {
+	domain := c.Domain
+	if domain == "" {
+		domain = u.Hostname()
+	}
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+	return strings.ToLower(domain) + "|" + path + "|" + c.Name
+}
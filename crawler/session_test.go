@@ -0,0 +1,401 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// testLoginServer is a site whose articles need a session from logging in with a form
+type testLoginServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	attempts int
+	logins   int
+	sessions map[string]bool
+}
+
+func newTestLoginServer() *testLoginServer {
+	s := &testLoginServer{sessions: make(map[string]bool)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><form id="login" action="/session" method="post">
+			<input type="hidden" name="token" value="t0k3n">
+			<input type="checkbox" name="remember" value="1">
+			<input type="text" name="user"><input type="password" name="pass">
+			<input type="submit" name="go" value="Log in">
+		</form></body></html>`)
+	})
+
+	mux.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		s.mu.Lock()
+		s.attempts++
+		s.mu.Unlock()
+
+		if r.Form.Get("token") != "t0k3n" || r.Form.Get("user") != "reader" || r.Form.Get("pass") != "hunter2" || r.Form.Get("go") != "" {
+			http.Error(w, "bad login", http.StatusForbidden)
+			return
+		}
+
+		s.mu.Lock()
+		s.logins++
+		id := fmt.Sprintf("s%d", s.logins)
+		s.sessions[id] = true
+		s.mu.Unlock()
+
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: id, Path: "/", MaxAge: 3600})
+		http.Redirect(w, r, "/account", http.StatusFound)
+	})
+
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><a href="/logout">Sign out</a></body></html>`)
+	})
+
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("sid")
+
+		s.mu.Lock()
+		valid := err == nil && s.sessions[c.Value]
+		s.mu.Unlock()
+
+		if !valid {
+			http.Error(w, "log in first", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Members Only</title></head></html>`)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *testLoginServer) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]bool)
+}
+
+func (s *testLoginServer) loginCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func (s *testLoginServer) attemptCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+// host is the model of the server, logging in with the credentials set by the test
+func (s *testLoginServer) host() shared.Host {
+	return shared.Host{
+		Host: (&Crawl{URL: s.URL}).Host(),
+		Login: &shared.HostLoginOpts{
+			URL:     s.URL + "/login",
+			Form:    "form#login",
+			Fields:  map[string]string{"user": "${env:CRAWL3_TEST_USER}", "pass": "${secret:example}"},
+			Success: shared.LoginCheck{Contains: "Sign out", Cookie: "sid"},
+		},
+	}
+}
+
+func newTestSessions(t *testing.T, dir, secrets string, server *testLoginServer) *Sessions {
+	sessions, err := NewSessions(SessionOpts{Dir: dir, SecretsFile: secrets, Logger: log.New(ioutil.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions.SetHosts([]shared.Host{server.host()})
+	return sessions
+}
+
+func TestSessionLogin(t *testing.T) {
+	server := newTestLoginServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crawl3-sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secrets := filepath.Join(dir, "secrets.json")
+	err = ioutil.WriteFile(secrets, []byte(`{"example": "hunter2"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CRAWL3_TEST_USER", "reader")
+	defer os.Unsetenv("CRAWL3_TEST_USER")
+
+	jars := filepath.Join(dir, "jars")
+	crawl := func(sessions *Sessions) *Crawl {
+		service := newTestService(t, ServiceOpts{Sessions: sessions})
+
+		c, err := service.Crawl(context.Background(), server.URL+"/article")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	sessions := newTestSessions(t, jars, secrets, server)
+	for i := 0; i < 2; i++ {
+		c := crawl(sessions)
+		if c.Title != "Members Only" || c.Error != "" {
+			t.Fatalf("expected the article after logging in, got %q %q", c.Title, c.Error)
+		}
+	}
+	if server.loginCount() != 1 {
+		t.Errorf("expected the session to be kept between crawls, logged in %d times", server.loginCount())
+	}
+
+	// an expired session logs in again and fetches the page once more
+	server.expire()
+	c := crawl(sessions)
+	if c.Title != "Members Only" || server.loginCount() != 2 {
+		t.Errorf("expected to log in again, got %q after %d logins", c.Title, server.loginCount())
+	}
+
+	// the cookies are saved so a restart keeps the session
+	err = sessions.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = crawl(newTestSessions(t, jars, secrets, server))
+	if c.Title != "Members Only" || server.loginCount() != 2 {
+		t.Errorf("expected the saved cookies to be used, got %q after %d logins", c.Title, server.loginCount())
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(jars, strings.Replace((&Crawl{URL: server.URL}).Host(), ":", "_", -1)+".json"))
+	if err != nil || !strings.Contains(string(data), `"Name":"sid"`) {
+		t.Errorf("expected the session cookie to be saved, got %s %v", data, err)
+	}
+
+	// a login that fails fails the crawl
+	err = ioutil.WriteFile(secrets, []byte(`{"example": "wrong"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = crawl(newTestSessions(t, "", secrets, server))
+	if !strings.Contains(c.Error, "unable to log in") {
+		t.Errorf("expected the login to fail, got %q", c.Error)
+	}
+
+	os.Unsetenv("CRAWL3_TEST_USER")
+	c = crawl(newTestSessions(t, "", secrets, server))
+	if !strings.Contains(c.Error, "CRAWL3_TEST_USER") {
+		t.Errorf("expected the missing credential to be reported, got %q", c.Error)
+	}
+}
+
+func TestSessionCookies(t *testing.T) {
+	var mu sync.Mutex
+	visits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("seen"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "seen", Value: "1"})
+		} else {
+			mu.Lock()
+			visits++
+			mu.Unlock()
+		}
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer server.Close()
+
+	sessions, err := NewSessions(SessionOpts{Logger: log.New(ioutil.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, ServiceOpts{Sessions: sessions})
+
+	for i := 0; i < 3; i++ {
+		_, err := service.Crawl(context.Background(), server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if visits != 2 {
+		t.Errorf("expected the cookie of the host to be sent on later crawls, got %d", visits)
+	}
+}
+
+func TestSessionSavedCookies(t *testing.T) {
+	server := newTestLoginServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crawl3-sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secrets := filepath.Join(dir, "secrets.json")
+	err = ioutil.WriteFile(secrets, []byte(`{"example": "hunter2"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CRAWL3_TEST_USER", "reader")
+	defer os.Unsetenv("CRAWL3_TEST_USER")
+
+	// a cookie saved from an earlier crawl that is not the session cookie
+	sessions := newTestSessions(t, dir, secrets, server)
+	sess, err := sessions.session((&Crawl{URL: server.URL}).Host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(server.URL)
+	sess.jar.SetCookies(u, []*http.Cookie{{Name: "tracking", Value: "1", Path: "/", MaxAge: 3600}})
+
+	// the save waits for more cookies, so nothing has been written yet
+	jarFile := sessions.jarFile((&Crawl{URL: server.URL}).Host())
+	if _, err := os.Stat(jarFile); !os.IsNotExist(err) {
+		t.Errorf("expected the save to be delayed, got %v", err)
+	}
+
+	err = sessions.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(t, ServiceOpts{Sessions: newTestSessions(t, dir, secrets, server)})
+	c, err := service.Crawl(context.Background(), server.URL+"/article")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Title != "Members Only" || server.loginCount() != 1 {
+		t.Errorf("expected to log in despite the saved cookie, got %q after %d logins", c.Title, server.loginCount())
+	}
+}
+
+func TestSessionLoginBackoff(t *testing.T) {
+	server := newTestLoginServer()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crawl3-sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secrets := filepath.Join(dir, "secrets.json")
+	err = ioutil.WriteFile(secrets, []byte(`{"example": "wrong"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CRAWL3_TEST_USER", "reader")
+	defer os.Unsetenv("CRAWL3_TEST_USER")
+
+	sessions, err := NewSessions(SessionOpts{
+		SecretsFile:  secrets,
+		LoginBackoff: 200 * time.Millisecond,
+		Logger:       log.New(ioutil.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions.SetHosts([]shared.Host{server.host()})
+
+	service := newTestService(t, ServiceOpts{Sessions: sessions})
+	crawl := func() *Crawl {
+		c, err := service.Crawl(context.Background(), server.URL+"/article")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// the crawls after a failed login fail with its error without logging in again
+	for i := 0; i < 3; i++ {
+		c := crawl()
+		if !strings.Contains(c.Error, "unable to log in") || c.ErrorCode != string(CodeUnavailable) {
+			t.Errorf("expected the login to fail, got %q %q", c.Error, c.ErrorCode)
+		}
+	}
+	if server.attemptCount() != 1 {
+		t.Errorf("expected one login until the backoff ends, got %d", server.attemptCount())
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	crawl()
+	if server.attemptCount() != 2 {
+		t.Errorf("expected to log in again after the backoff, got %d", server.attemptCount())
+	}
+
+	// fixing the credentials in the model logs in straight away
+	err = ioutil.WriteFile(secrets, []byte(`{"example": "hunter2"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions.SetHosts([]shared.Host{server.host()})
+	c := crawl()
+	if c.Title != "Members Only" || server.attemptCount() != 3 {
+		t.Errorf("expected the new login to be tried, got %q after %d logins", c.Title, server.attemptCount())
+	}
+}
+
+func TestSessionForgetHosts(t *testing.T) {
+	server := newTestLoginServer()
+	defer server.Close()
+
+	sessions, err := NewSessions(SessionOpts{HostIdle: 100 * time.Millisecond, Logger: log.New(ioutil.Discard, "", 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions.SetHosts([]shared.Host{server.host()})
+
+	known := func(host string) bool {
+		sessions.mu.Lock()
+		defer sessions.mu.Unlock()
+		_, ok := sessions.sessions[host]
+		return ok
+	}
+
+	host := strings.ToLower(server.host().Host)
+	for _, h := range []string{host, "plain.test"} {
+		_, err = sessions.session(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a host removed from the models is forgotten
+	sessions.SetHosts(nil)
+	if known(host) || !known("plain.test") {
+		t.Errorf("expected only the session of the removed host to be forgotten")
+	}
+
+	// and so is a host that is no longer crawled
+	time.Sleep(150 * time.Millisecond)
+	_, err = sessions.session("other.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known("plain.test") || !known("other.test") {
+		t.Errorf("expected the idle host to be forgotten")
+	}
+}
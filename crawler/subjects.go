@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// DiscoverySubject is shared by every namespace. Each nats transport answers requests
+// on it with its ServiceInfo, so a client can check that a service is running in the
+// namespace it was configured with
+const DiscoverySubject = "crawl3.discover"
+
+// DefaultQueueGroup is the queue group the nats transports of a namespace share, so
+// each request is handled by only one of them
+const DefaultQueueGroup = "crawl_worker"
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// Subjects are the nats subjects the crawler uses in a namespace. Without a namespace
+// they are the subjects used before namespaces existed, so older services still agree
+type Subjects struct {
+	Namespace string
+
+	Crawl         string
+	CrawlAsync    string
+	CrawlProgress string
+	CrawlBatch    string
+
+	// CrawlComplete is where finished crawls are published for the aggregator
+	CrawlComplete string
+
+	// Events is the prefix of the per host lifecycle event subjects
+	Events string
+
+	// Aggregate is where the aggregator answers queries
+	Aggregate string
+
+	QueueGroup string
+}
+
+// ServiceInfo is the reply of a nats transport to a discovery request
+type ServiceInfo struct {
+	Service   string
+	Namespace string
+}
+
+// ValidateNamespace checks that a namespace can be used as the first tokens of a
+// subject. An empty namespace is valid and keeps the original subjects
+func ValidateNamespace(namespace string) error {
+	if namespace == "" || namespacePattern.MatchString(namespace) {
+		return nil
+	}
+	return NewError(CodeInvalidRequest, fmt.Sprintf("invalid namespace %q: use letters, digits, _ and - separated by dots", namespace))
+}
+
+// NewSubjects derives every subject of a namespace
+func NewSubjects(namespace string) (Subjects, error) {
+	err := ValidateNamespace(namespace)
+	if err != nil {
+		return Subjects{}, err
+	}
+
+	prefix := ""
+	if namespace != "" {
+		prefix = namespace + "."
+	}
+
+	return Subjects{
+		Namespace:     namespace,
+		Crawl:         prefix + "crawl",
+		CrawlAsync:    prefix + "crawlAsync",
+		CrawlProgress: prefix + "crawlProgress",
+		CrawlBatch:    prefix + "crawlBatch",
+		CrawlComplete: prefix + "crawl_complete",
+		Events:        prefix + EventsSubject,
+		Aggregate:     prefix + "aggregate",
+		QueueGroup:    DefaultQueueGroup,
+	}, nil
+}
+
+// CheckNamespace asks every crawl service on the connection which namespace it is in,
+// and returns an error naming the namespaces found if none of them is in the given one
+func CheckNamespace(conn *nats.Conn, namespace string, timeout time.Duration) error {
+	err := ValidateNamespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := conn.SubscribeSync(inbox)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	err = conn.PublishRequest(DiscoverySubject, inbox, nil)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	found := map[string]bool{}
+	for {
+		msg, err := sub.NextMsg(time.Until(deadline))
+		if err != nil {
+			break
+		}
+
+		var info ServiceInfo
+		_, err = Decode(msg.Data, &info)
+		if err != nil {
+			continue
+		}
+
+		if info.Namespace == namespace {
+			return nil
+		}
+		found[fmt.Sprintf("%q", info.Namespace)] = true
+	}
+
+	if len(found) == 0 {
+		return NewError(CodeUnavailable, "no crawl service answered the discovery request")
+	}
+
+	var namespaces []string
+	for ns := range found {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	return NewError(CodeNotFound, fmt.Sprintf("no crawl service in namespace %q, found %s", namespace, strings.Join(namespaces, ", ")))
+}
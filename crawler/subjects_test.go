@@ -0,0 +1,99 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestNewSubjects(t *testing.T) {
+	legacy, err := NewSubjects("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if legacy.Crawl != "crawl" || legacy.CrawlAsync != "crawlAsync" || legacy.CrawlComplete != "crawl_complete" || legacy.QueueGroup != "crawl_worker" {
+		t.Errorf("expected the original subjects without a namespace, got %+v", legacy)
+	}
+
+	staging, err := NewSubjects("acme.staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if staging.Crawl != "acme.staging.crawl" || staging.CrawlComplete != "acme.staging.crawl_complete" || staging.Events != "acme.staging.crawl_events" {
+		t.Errorf("expected namespaced subjects, got %+v", staging)
+	}
+
+	if staging.Aggregate == staging.Crawl {
+		t.Error("the aggregator must not share a subject with the crawler")
+	}
+
+	for _, ns := range []string{"has space", "wild.*", "tail.>", ".leading", "trailing.", "a..b"} {
+		_, err := NewSubjects(ns)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", ns)
+		}
+	}
+}
+
+func TestNatsNamespaces(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	ser := RunDefaultServer()
+	defer ser.Shutdown()
+
+	nc, err := nats.Connect(fmt.Sprintf("nats://%s:%d", DefaultTestOptions.Host, DefaultTestOptions.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	for _, ns := range []string{"staging", "production"} {
+		transport := NewTransportNats(nc, newTestService(t, ServiceOpts{}), NatsOpts{Namespace: ns})
+		err = transport.Start(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer transport.Stop(context.Background())
+	}
+
+	err = NewTransportNats(nc, newTestService(t, ServiceOpts{}), NatsOpts{Namespace: "not valid"}).Start(context.Background())
+	if err == nil {
+		t.Error("expected an invalid namespace to stop the transport starting")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := NewClientNats(nc, NatsOpts{Namespace: "staging"}).Crawl(ctx, page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Title != "Test Page" {
+		t.Errorf("unexpected crawl result %+v", result)
+	}
+
+	lost, cancelLost := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelLost()
+
+	_, err = NewClientNats(nc, NatsOpts{Namespace: "testing"}).Crawl(lost, page.URL)
+	if err == nil {
+		t.Error("expected no service to answer in another namespace")
+	}
+
+	err = CheckNamespace(nc, "staging", time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = CheckNamespace(nc, "testing", 500*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), `"production"`) || !strings.Contains(err.Error(), `"staging"`) {
+		t.Errorf("expected the namespaces in use to be listed, got %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/samjohnduke/crawl3/crawler/crawlerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// transportGRPC serves the crawl service over gRPC using the contract in
+// crawlerpb/crawler.proto
+type transportGRPC struct {
+	crawlerpb.UnimplementedCrawlServiceServer
+
+	addr     string
+	service  Service
+	opts     []grpc.ServerOption
+	server   *grpc.Server
+	listener net.Listener
+}
+
+// NewTransportGRPC creates a transport that serves the crawl service over gRPC on the
+// given address
+func NewTransportGRPC(addr string, service Service, opts ...grpc.ServerOption) Transport {
+	return &transportGRPC{
+		addr:    addr,
+		service: service,
+		opts:    opts,
+	}
+}
+
+// Start listens on the address and serves requests until stopped
+func (t *transportGRPC) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return err
+	}
+	t.listener = ln
+
+	t.server = grpc.NewServer(t.opts...)
+	crawlerpb.RegisterCrawlServiceServer(t.server, t)
+
+	go func() {
+		err := t.server.Serve(ln)
+		if err != nil && err != grpc.ErrServerStopped {
+			log.Println(err)
+		}
+	}()
+
+	return nil
+}
+
+// Stop waits for open calls to finish, or for the context to be done, and closes the
+// listener
+func (t *transportGRPC) Stop(ctx context.Context) error {
+	if t.server == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		t.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		t.server.Stop()
+		return ctx.Err()
+	}
+}
+
+// Crawl a url and reply with the result
+func (t *transportGRPC) Crawl(ctx context.Context, req *crawlerpb.CrawlRequest) (*crawlerpb.CrawlReply, error) {
+	if req.Url == "" {
+		return nil, statusError(NewError(CodeInvalidRequest, "a url to crawl is required"))
+	}
+
+	result, err := t.service.Crawl(ctx, req.Url, requestOptions(optionsFromProto(req.Options))...)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	pc, err := crawlToProto(result)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &crawlerpb.CrawlReply{Crawl: pc}, nil
+}
+
+// CrawlProgress replies with the progress of a crawl that has not finished
+func (t *transportGRPC) CrawlProgress(ctx context.Context, req *crawlerpb.ProgressRequest) (*crawlerpb.CrawlReply, error) {
+	result, err := t.service.CrawlProgress(ctx, req.Id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	pc, err := crawlToProto(result)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &crawlerpb.CrawlReply{Crawl: pc}, nil
+}
+
+// Watch crawls a url and streams an event when it is queued and when it finishes
+func (t *transportGRPC) Watch(req *crawlerpb.CrawlRequest, stream grpc.ServerStreamingServer[crawlerpb.CrawlEvent]) error {
+	if req.Url == "" {
+		return statusError(NewError(CodeInvalidRequest, "a url to crawl is required"))
+	}
+
+	done := make(chan *Crawl, 1)
+	guid, err := t.service.CrawlAsync(context.Background(), req.Url, func(c *Crawl) {
+		done <- c
+	}, requestOptions(optionsFromProto(req.Options))...)
+	if err != nil {
+		return statusError(err)
+	}
+
+	err = t.send(stream.Send, queuedEvent(guid, req))
+	if err != nil {
+		return err
+	}
+
+	select {
+	case c := <-done:
+		return t.send(stream.Send, finishedEvent(c, req))
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+}
+
+// CrawlStream crawls every url sent on the stream, sending back the events of each crawl
+// as they happen. Once the caller has closed its side the stream is ended after the
+// last crawl finishes
+func (t *transportGRPC) CrawlStream(stream grpc.BidiStreamingServer[crawlerpb.CrawlRequest, crawlerpb.CrawlEvent]) error {
+	var (
+		mu      sync.Mutex
+		closed  bool
+		sendErr error
+		pending sync.WaitGroup
+	)
+
+	// the events of crawls finishing are sent from their callbacks, so sends are
+	// serialised and stop once the stream has ended
+	send := func(e *CrawlEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if closed || sendErr != nil {
+			return
+		}
+		sendErr = t.send(stream.Send, e)
+	}
+	defer func() {
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+	}()
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if req.Url == "" {
+			send(&CrawlEvent{Stage: CrawlFailed, RequestID: req.RequestId, Time: time.Now(), Crawl: &Crawl{Error: "a url to crawl is required", ErrorCode: string(CodeInvalidRequest)}})
+			continue
+		}
+
+		// a crawl can finish before CrawlAsync returns, so its finished event waits for
+		// the queued event to be sent first
+		queued := make(chan struct{})
+		pending.Add(1)
+		guid, err := t.service.CrawlAsync(context.Background(), req.Url, func(c *Crawl) {
+			go func() {
+				defer pending.Done()
+				<-queued
+				send(finishedEvent(c, req))
+			}()
+		}, requestOptions(optionsFromProto(req.Options))...)
+		if err != nil {
+			pending.Done()
+			send(&CrawlEvent{Stage: CrawlFailed, URL: req.Url, RequestID: req.RequestId, Time: time.Now(), Crawl: &Crawl{URL: req.Url, Error: err.Error(), ErrorCode: string(toError(err).Code)}})
+			continue
+		}
+
+		send(queuedEvent(guid, req))
+		close(queued)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return sendErr
+}
+
+// CrawlBatch crawls a batch of urls. The first event holds only the id of the batch,
+// then a result is sent as each crawl finishes and the summary ends the stream
+func (t *transportGRPC) CrawlBatch(req *crawlerpb.BatchRequest, stream grpc.ServerStreamingServer[crawlerpb.BatchEvent]) error {
+	if len(req.Items) == 0 {
+		return statusError(NewError(CodeInvalidRequest, "a list of urls to crawl is required"))
+	}
+
+	var (
+		mu      sync.Mutex
+		closed  bool
+		sendErr error
+	)
+
+	// results are sent from the callbacks of the crawls, so sends are serialised and
+	// stop once the stream has ended
+	send := func(e *BatchEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if closed || sendErr != nil {
+			return
+		}
+
+		pe, err := batchEventToProto(e)
+		if err != nil {
+			sendErr = statusError(err)
+			return
+		}
+		sendErr = stream.Send(pe)
+	}
+	defer func() {
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+	}()
+
+	// the batch id is sent before any result can be
+	mu.Lock()
+	summary := make(chan *BatchSummary, 1)
+	batchID, err := t.service.CrawlBatch(context.Background(), batchItemsFromProto(req.Items), func(res *BatchResult) {
+		send(&BatchEvent{BatchID: res.BatchID, Result: res})
+	}, func(sum *BatchSummary) {
+		summary <- sum
+	})
+	if err != nil {
+		mu.Unlock()
+		return statusError(err)
+	}
+
+	pe, err := batchEventToProto(&BatchEvent{BatchID: batchID})
+	if err == nil {
+		sendErr = stream.Send(pe)
+	}
+	mu.Unlock()
+	if err != nil {
+		return statusError(err)
+	}
+
+	select {
+	case sum := <-summary:
+		send(&BatchEvent{BatchID: batchID, Summary: sum})
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return sendErr
+}
+
+func (t *transportGRPC) send(send func(*crawlerpb.CrawlEvent) error, e *CrawlEvent) error {
+	pe, err := eventToProto(e)
+	if err != nil {
+		return statusError(err)
+	}
+	return send(pe)
+}
+
+func queuedEvent(guid string, req *crawlerpb.CrawlRequest) *CrawlEvent {
+	return &CrawlEvent{
+		Stage:     CrawlQueued,
+		ID:        guid,
+		URL:       req.Url,
+		RequestID: req.RequestId,
+		Time:      time.Now(),
+	}
+}
+
+func finishedEvent(c *Crawl, req *crawlerpb.CrawlRequest) *CrawlEvent {
+	stage := CrawlCompleted
+	if c.Error != "" {
+		stage = CrawlFailed
+	}
+
+	return &CrawlEvent{
+		Stage:     stage,
+		ID:        c.ID,
+		URL:       c.URL,
+		RequestID: req.RequestId,
+		Time:      time.Now(),
+		Crawl:     c,
+	}
+}
+
+// statusError converts an error from the service into a gRPC status that carries the
+// Error as a detail
+func statusError(err error) error {
+	e := toError(err)
+
+	st := status.New(grpcCode(e.Code), e.Message)
+	detailed, derr := st.WithDetails(errorToProto(e))
+	if derr == nil {
+		st = detailed
+	}
+
+	return st.Err()
+}
+
+func grpcCode(code ErrorCode) codes.Code {
+	switch code {
+	case CodeInvalidRequest:
+		return codes.InvalidArgument
+	case CodeNotFound:
+		return codes.NotFound
+	case CodeUnavailable:
+		return codes.Unavailable
+	case CodeTimeout:
+		return codes.DeadlineExceeded
+	case CodeCanceled:
+		return codes.Canceled
+	case CodeBlockedAddress:
+		return codes.PermissionDenied
+	}
+	return codes.Internal
+}
@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newTestGRPCClient serves the service over grpc on a local port and connects to it
+func newTestGRPCClient(t *testing.T, service Service) (GRPCClient, func()) {
+	transport := NewTransportGRPC("127.0.0.1:0", service)
+	err := transport.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := transport.(*transportGRPC).listener.Addr().String()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewClientGRPC(conn), func() {
+		conn.Close()
+		transport.Stop(context.Background())
+	}
+}
+
+func TestGRPCTransportCrawl(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	client, stop := newTestGRPCClient(t, newTestService(t, ServiceOpts{}))
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := client.Crawl(ctx, page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Title != "Test Page" || len(result.HarvestedURLs) != 1 || result.LoadedTime.IsZero() {
+		t.Errorf("unexpected crawl result %+v", result)
+	}
+
+	_, err = client.CrawlProgress(ctx, "not-a-crawl")
+	if err != ErrCrawlNotFound {
+		t.Errorf("expected crawl not found, got %v", err)
+	}
+}
+
+func TestGRPCTransportCrawlAsync(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	client, stop := newTestGRPCClient(t, newTestService(t, ServiceOpts{}))
+	defer stop()
+
+	done := make(chan *Crawl, 1)
+	guid, err := client.CrawlAsync(context.Background(), page.URL, func(c *Crawl) {
+		done <- c
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-done:
+		if c.ID != guid || c.Title != "Test Page" {
+			t.Errorf("unexpected crawl result %+v", c)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the crawl")
+	}
+}
+
+func TestGRPCTransportWatch(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	client, stop := newTestGRPCClient(t, newTestService(t, ServiceOpts{}))
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var events []*CrawlEvent
+	err := client.Watch(ctx, page.URL, func(e *CrawlEvent) {
+		events = append(events, e)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	if events[0].Stage != CrawlQueued || events[0].ID == "" {
+		t.Errorf("expected a queued event, got %+v", events[0])
+	}
+
+	if events[1].Stage != CrawlCompleted || events[1].ID != events[0].ID || events[1].Crawl.Title != "Test Page" {
+		t.Errorf("expected a completed event, got %+v", events[1])
+	}
+}
+
+func TestGRPCTransportCrawlStream(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	client, stop := newTestGRPCClient(t, newTestService(t, ServiceOpts{}))
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	urls := []string{page.URL + "/a", page.URL + "/b", "", page.URL + "/c"}
+
+	stages := make(map[string][]CrawlStage)
+	err := client.CrawlStream(ctx, urls, func(e *CrawlEvent) {
+		stages[e.RequestID] = append(stages[e.RequestID], e.Stage)
+		if e.Stage == CrawlCompleted && e.Crawl.Title != "Test Page" {
+			t.Errorf("unexpected crawl result %+v", e.Crawl)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for id := range stages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) != 4 {
+		t.Fatalf("expected events for 4 urls, got %v", ids)
+	}
+
+	for _, id := range []string{"0", "1", "3"} {
+		if len(stages[id]) != 2 || stages[id][0] != CrawlQueued || stages[id][1] != CrawlCompleted {
+			t.Errorf("unexpected stages for url %s: %v", id, stages[id])
+		}
+	}
+
+	if len(stages["2"]) != 1 || stages["2"][0] != CrawlFailed {
+		t.Errorf("expected the empty url to fail, got %v", stages["2"])
+	}
+}
+
+// instantService finishes every async crawl before CrawlAsync returns
+type instantService struct {
+	Service
+}
+
+func (s instantService) CrawlAsync(ctx context.Context, url string, cb func(*Crawl), opts ...CrawlOptions) (string, error) {
+	cb(&Crawl{ID: url, URL: url, Title: "Instant"})
+	return url, nil
+}
+
+func TestGRPCTransportCrawlStreamOrder(t *testing.T) {
+	client, stop := newTestGRPCClient(t, instantService{newTestService(t, ServiceOpts{})})
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stages := make(map[string][]CrawlStage)
+	err := client.CrawlStream(ctx, []string{"http://a.test/", "http://b.test/"}, func(e *CrawlEvent) {
+		stages[e.RequestID] = append(stages[e.RequestID], e.Stage)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"0", "1"} {
+		if len(stages[id]) != 2 || stages[id][0] != CrawlQueued || stages[id][1] != CrawlCompleted {
+			t.Errorf("expected url %s to be queued before it completed, got %v", id, stages[id])
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the http transport keeps the result of an async crawl for polling
+const httpResultTTL = 10 * time.Minute
+
+// The largest request body the http transport reads, enough for a batch of many urls
+const httpMaxRequestBytes = 4 << 20
+
+// transportHTTP serves the crawl service as a JSON api over http.
+//
+//	POST /crawl        {"URL": ..., "Options": ...}                 crawl a page and wait for the result
+//	POST /crawl/async  {"URL": ..., "Reply": ..., "Options": ...}   start a crawl and return its id
+//	GET  /crawl/{id}                                                the progress or result of a crawl
+//	POST /crawl/batch  {"Items": [...]}                             crawl many urls, streaming the results
+//
+// Options are the optional CrawlOptions of the crawl. Reply is an optional http or https
+// callback url that the finished crawl is POSTed to, as long as the network policy of the
+// transport allows its address. Without it the result can be polled, and is kept for ten
+// minutes after the crawl finishes. A batch replies with newline delimited BatchEvents,
+// the first holding only the batch id and the last the summary
+type transportHTTP struct {
+	addr    string
+	service Service
+	server  *http.Server
+	client  *http.Client
+	network *NetworkPolicy
+
+	results map[string]httpResult
+	mu      sync.Mutex
+}
+
+// HTTPOpts configures the http transport
+type HTTPOpts struct {
+	// Network is the policy the callback urls of async crawls are checked against,
+	// DefaultDeniedNetworks are denied when nil
+	Network *NetworkPolicy
+}
+
+type httpResult struct {
+	crawl   *Crawl
+	expires time.Time
+}
+
+// httpError is the body of every http response that is not a success
+type httpError struct {
+	Error *Error `json:"error"`
+}
+
+// NewTransportHTTP creates a transport that serves the crawl service over http on the
+// given address. The transport is also an http.Handler so it can be mounted elsewhere
+func NewTransportHTTP(addr string, service Service, opts HTTPOpts) Transport {
+	network := opts.Network
+	if network == nil {
+		network = defaultNetworkPolicy()
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	network.guard(client)
+
+	return &transportHTTP{
+		addr:    addr,
+		service: service,
+		client:  client,
+		network: network,
+		results: make(map[string]httpResult),
+	}
+}
+
+// Start listens on the address and serves requests until stopped
+func (t *transportHTTP) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return err
+	}
+
+	t.server = &http.Server{Handler: t}
+	go func() {
+		err := t.server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			log.Println(err)
+		}
+	}()
+
+	return nil
+}
+
+// Stop waits for open requests to finish and closes the listener
+func (t *transportHTTP) Stop(ctx context.Context) error {
+	if t.server == nil {
+		return nil
+	}
+	return t.server.Shutdown(ctx)
+}
+
+// ServeHTTP routes a request to the matching endpoint
+func (t *transportHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/crawl" && r.Method == http.MethodPost:
+		t.recieveCrawlRequest(w, r)
+
+	case r.URL.Path == "/crawl/async" && r.Method == http.MethodPost:
+		t.recieveCrawlAsyncRequest(w, r)
+
+	case r.URL.Path == "/crawl/batch" && r.Method == http.MethodPost:
+		t.recieveCrawlBatchRequest(w, r)
+
+	case strings.HasPrefix(r.URL.Path, "/crawl/") && r.Method == http.MethodGet:
+		t.recieveCrawlProgressRequest(w, r, strings.TrimPrefix(r.URL.Path, "/crawl/"))
+
+	case r.URL.Path == "/crawl" || r.URL.Path == "/crawl/async" || strings.HasPrefix(r.URL.Path, "/crawl/"):
+		writeHTTPError(w, http.StatusMethodNotAllowed, NewError(CodeInvalidRequest, "method not allowed"))
+
+	default:
+		writeHTTPError(w, http.StatusNotFound, NewError(CodeNotFound, "not found"))
+	}
+}
+
+// process a crawl request synchronous request
+func (t *transportHTTP) recieveCrawlRequest(w http.ResponseWriter, r *http.Request) {
+	var crawlRequest CrawlRequest
+	err := decodeHTTPRequest(w, r, &crawlRequest)
+	if err != nil || crawlRequest.URL == "" {
+		writeHTTPError(w, http.StatusBadRequest, NewError(CodeInvalidRequest, "a url to crawl is required"))
+		return
+	}
+
+	result, err := t.service.Crawl(r.Context(), crawlRequest.URL, requestOptions(crawlRequest.Options)...)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeHTTPJSON(w, http.StatusOK, &CrawlReply{Crawl: *result})
+}
+
+// process a crawl request asynchronously, replying with the id of the crawl
+func (t *transportHTTP) recieveCrawlAsyncRequest(w http.ResponseWriter, r *http.Request) {
+	var crawlRequest CrawlAsyncRequest
+	err := decodeHTTPRequest(w, r, &crawlRequest)
+	if err != nil || crawlRequest.URL == "" {
+		writeHTTPError(w, http.StatusBadRequest, NewError(CodeInvalidRequest, "a url to crawl is required"))
+		return
+	}
+
+	if crawlRequest.Reply != "" {
+		err = t.checkReply(crawlRequest.Reply)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+	}
+
+	guid, err := t.service.CrawlAsync(context.Background(), crawlRequest.URL, func(c *Crawl) {
+		t.storeResult(c)
+
+		if crawlRequest.Reply != "" {
+			go t.callback(crawlRequest.Reply, c)
+		}
+	}, requestOptions(crawlRequest.Options)...)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeHTTPJSON(w, http.StatusAccepted, &CrawlReply{Crawl: Crawl{ID: guid}})
+}
+
+// reply with a finished crawl, or the progress of one that is still running
+func (t *transportHTTP) recieveCrawlProgressRequest(w http.ResponseWriter, r *http.Request, guid string) {
+	if result := t.result(guid); result != nil {
+		writeHTTPJSON(w, http.StatusOK, &CrawlReply{Crawl: *result})
+		return
+	}
+
+	result, err := t.service.CrawlProgress(r.Context(), guid)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeHTTPJSON(w, http.StatusAccepted, &CrawlReply{Crawl: *result})
+}
+
+// process a batch of urls, streaming each result as it finishes
+func (t *transportHTTP) recieveCrawlBatchRequest(w http.ResponseWriter, r *http.Request) {
+	var batchRequest CrawlBatchRequest
+	err := decodeHTTPRequest(w, r, &batchRequest)
+	if err != nil || len(batchRequest.Items) == 0 {
+		writeHTTPError(w, http.StatusBadRequest, NewError(CodeInvalidRequest, "a list of urls to crawl is required"))
+		return
+	}
+
+	// events are written by this handler alone, the callbacks give up once it returns
+	events := make(chan *BatchEvent)
+	finished := make(chan struct{})
+	defer close(finished)
+
+	send := func(e *BatchEvent) {
+		select {
+		case events <- e:
+		case <-finished:
+		}
+	}
+
+	batchID, err := t.service.CrawlBatch(context.Background(), batchRequest.Items, func(res *BatchResult) {
+		send(&BatchEvent{BatchID: res.BatchID, Result: res})
+	}, func(sum *BatchSummary) {
+		send(&BatchEvent{BatchID: sum.BatchID, Summary: sum})
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	write := func(e *BatchEvent) bool {
+		err := enc.Encode(e)
+		if err != nil {
+			log.Println(err)
+			return false
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	if !write(&BatchEvent{BatchID: batchID}) {
+		return
+	}
+
+	for {
+		select {
+		case e := <-events:
+			if !write(e) || e.Summary != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// checkReply refuses a callback url that is not http or https, or whose host is an
+// address the network policy denies. Host names are checked as the callback connects
+func (t *transportHTTP) checkReply(reply string) error {
+	u, err := url.Parse(reply)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return NewError(CodeInvalidRequest, "the reply must be an http or https url")
+	}
+	return t.network.checkAddress(u.Hostname())
+}
+
+// callback posts a finished crawl to the url given with the async request
+func (t *transportHTTP) callback(url string, c *Crawl) {
+	out, err := json.Marshal(&CrawlReply{Crawl: *c})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	resp, err := t.client.Post(url, "application/json", bytes.NewReader(out))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("crawl callback to %s failed: %s", url, resp.Status)
+	}
+}
+
+func (t *transportHTTP) storeResult(c *Crawl) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for guid, res := range t.results {
+		if now.After(res.expires) {
+			delete(t.results, guid)
+		}
+	}
+
+	t.results[c.ID] = httpResult{crawl: c, expires: now.Add(httpResultTTL)}
+}
+
+func (t *transportHTTP) result(guid string) *Crawl {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res, ok := t.results[guid]
+	if !ok || time.Now().After(res.expires) {
+		return nil
+	}
+	return res.crawl
+}
+
+// decodeHTTPRequest reads the JSON body of a request, failing once it is larger than
+// httpMaxRequestBytes
+func decodeHTTPRequest(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxRequestBytes)).Decode(v)
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, e *Error) {
+	writeHTTPJSON(w, status, &httpError{Error: e})
+}
+
+// writeServiceError replies with an error returned by the service, choosing the status
+// from its code
+func writeServiceError(w http.ResponseWriter, err error) {
+	e := toError(err)
+	writeHTTPError(w, httpStatus(e.Code), e)
+}
+
+func httpStatus(code ErrorCode) int {
+	switch code {
+	case CodeInvalidRequest:
+		return http.StatusBadRequest
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeTimeout:
+		return http.StatusGatewayTimeout
+	case CodeCanceled:
+		return 499
+	case CodeBlockedAddress:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
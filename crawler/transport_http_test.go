@@ -0,0 +1,247 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestPageServer serves a small html page that the crawler can fetch without
+// leaving the machine
+func newTestPageServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Test Page</title></head><body><a href="/next">next</a></body></html>`))
+	}))
+}
+
+// newTestService creates a service with the options that discards its logs. Unless the
+// options have a network policy every address is allowed, so pages can be served from
+// loopback
+func newTestService(t *testing.T, opts ServiceOpts) Service {
+	if opts.Logger == nil {
+		opts.Logger = log.New(ioutil.Discard, "", 0)
+	}
+	if opts.Network == nil {
+		opts.Network = newTestNetwork(t, NetworkOpts{})
+	}
+
+	service, err := New(opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestHTTPTransportCrawl(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	transport := NewTransportHTTP("", newTestService(t, ServiceOpts{}), HTTPOpts{})
+	server := httptest.NewServer(transport.(http.Handler))
+	defer server.Close()
+
+	client := NewClientHTTP(server.URL, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := client.Crawl(ctx, page.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Title != "Test Page" || len(result.HarvestedURLs) != 1 {
+		t.Errorf("unexpected crawl result %+v", result)
+	}
+
+	_, err = client.CrawlProgress(ctx, "not-a-crawl")
+	if err != ErrCrawlNotFound {
+		t.Errorf("expected crawl not found, got %v", err)
+	}
+}
+
+func TestHTTPTransportCrawlAsyncPolling(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	transport := NewTransportHTTP("", newTestService(t, ServiceOpts{}), HTTPOpts{})
+	server := httptest.NewServer(transport.(http.Handler))
+	defer server.Close()
+
+	client := NewClientHTTP(server.URL, nil)
+
+	done := make(chan *Crawl, 1)
+	guid, err := client.CrawlAsync(context.Background(), page.URL, func(c *Crawl) {
+		done <- c
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-done:
+		if c.ID != guid || c.Title != "Test Page" {
+			t.Errorf("unexpected crawl result %+v", c)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the async crawl")
+	}
+}
+
+func TestHTTPClientPollNotFound(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			writeHTTPJSON(w, http.StatusAccepted, &CrawlReply{Crawl: Crawl{ID: "finishing"}})
+			return
+		}
+
+		// the crawl is not found until its result has been stored
+		mu.Lock()
+		polls++
+		n := polls
+		mu.Unlock()
+
+		if n < 3 {
+			writeHTTPError(w, http.StatusNotFound, NewError(CodeNotFound, "crawl not found"))
+			return
+		}
+		writeHTTPJSON(w, http.StatusOK, &CrawlReply{Crawl: Crawl{ID: "finishing", Title: "Stored"}})
+	}))
+	defer server.Close()
+
+	done := make(chan *Crawl, 1)
+	_, err := NewClientHTTP(server.URL, nil).CrawlAsync(context.Background(), "http://example.test/", func(c *Crawl) {
+		done <- c
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-done:
+		if c.Title != "Stored" {
+			t.Errorf("unexpected crawl result %+v", c)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the client to keep polling a crawl that was not found")
+	}
+}
+
+func TestHTTPTransportCrawlAsyncCallback(t *testing.T) {
+	page := newTestPageServer()
+	defer page.Close()
+
+	done := make(chan CrawlReply, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reply CrawlReply
+		err := json.NewDecoder(r.Body).Decode(&reply)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- reply
+	}))
+	defer callback.Close()
+
+	transport := NewTransportHTTP("", newTestService(t, ServiceOpts{}), HTTPOpts{Network: newTestNetwork(t, NetworkOpts{})})
+	server := httptest.NewServer(transport.(http.Handler))
+	defer server.Close()
+
+	body, _ := json.Marshal(CrawlAsyncRequest{URL: page.URL, Reply: callback.URL})
+	resp, err := http.Post(server.URL+"/crawl/async", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the crawl to be accepted, got %s", resp.Status)
+	}
+
+	select {
+	case reply := <-done:
+		if reply.Crawl.Title != "Test Page" {
+			t.Errorf("unexpected crawl result %+v", reply.Crawl)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the callback")
+	}
+}
+
+func TestHTTPTransportCallbackRefused(t *testing.T) {
+	called := make(chan struct{}, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer callback.Close()
+
+	// the default policy keeps callbacks off loopback and the metadata service
+	transport := NewTransportHTTP("", newTestService(t, ServiceOpts{}), HTTPOpts{})
+	server := httptest.NewServer(transport.(http.Handler))
+	defer server.Close()
+
+	cases := map[string]int{
+		"file:///etc/passwd":              http.StatusBadRequest,
+		"http://169.254.169.254/callback": http.StatusForbidden,
+		callback.URL:                      http.StatusForbidden,
+		strings.Replace(callback.URL, "127.0.0.1", "localhost", 1): http.StatusAccepted,
+	}
+	for reply, status := range cases {
+		body, _ := json.Marshal(CrawlAsyncRequest{URL: "http://example.test/", Reply: reply})
+		resp, err := http.Post(server.URL+"/crawl/async", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != status {
+			t.Errorf("expected %d for a reply to %s, got %s", status, reply, resp.Status)
+		}
+	}
+
+	// a host name that resolves to loopback is refused as the callback connects
+	select {
+	case <-called:
+		t.Error("expected the callback to loopback to be refused")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestHTTPTransportBadRequest(t *testing.T) {
+	transport := NewTransportHTTP("", newTestService(t, ServiceOpts{}), HTTPOpts{})
+	server := httptest.NewServer(transport.(http.Handler))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/crawl", "application/json", bytes.NewReader([]byte(`{}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a bad request, got %s", resp.Status)
+	}
+
+	// a body larger than the limit is not read to the end
+	huge := `{"URL": "http://example.com/` + strings.Repeat("a", httpMaxRequestBytes) + `"}`
+	resp, err = http.Post(server.URL+"/crawl", "application/json", strings.NewReader(huge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a body that is too large to be refused, got %s", resp.Status)
+	}
+}
@@ -2,10 +2,9 @@ package crawler
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 
-	"github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
 // TransportNats is the implementation of the crawl transport via the nats
@@ -13,35 +12,52 @@ import (
 type transportNats struct {
 	conn    *nats.Conn
 	service Service
+	opts    NatsOpts
 	subs    []*nats.Subscription
 }
 
-// NewTransportNats creates the transport for the nats service
-func NewTransportNats(conn *nats.Conn, service Service) Transport {
+// NewTransportNats creates the transport for the nats service. The options choose the
+// namespace and queue group it subscribes with, the encoding of replies always follows
+// the request
+func NewTransportNats(conn *nats.Conn, service Service, opts ...NatsOpts) Transport {
 	return &transportNats{
-		conn: conn, service: service,
+		conn: conn, service: service, opts: natsOpts(opts),
 	}
 }
 
 // Start subscribes to the nats channels for the service
 func (t *transportNats) Start(ctx context.Context) error {
-	sub, err := t.conn.QueueSubscribe("crawl", "crawl_worker", t.recieveCrawlRequest)
+	subjects, err := t.opts.subjects()
 	if err != nil {
 		return err
 	}
-	t.subs = append(t.subs, sub)
 
-	sub2, err := t.conn.QueueSubscribe("crawlAsync", "crawl_worker", t.recieveCrawlAsyncRequest)
-	if err != nil {
-		return err
+	handlers := []struct {
+		subject string
+		handler nats.MsgHandler
+	}{
+		{subjects.Crawl, t.recieveCrawlRequest},
+		{subjects.CrawlAsync, t.recieveCrawlAsyncRequest},
+		{subjects.CrawlProgress, t.recieveCrawlProgressRequest},
+		{subjects.CrawlBatch, t.recieveCrawlBatchRequest},
+	}
+
+	for _, h := range handlers {
+		sub, err := t.conn.QueueSubscribe(h.subject, subjects.QueueGroup, h.handler)
+		if err != nil {
+			return err
+		}
+		t.subs = append(t.subs, sub)
 	}
-	t.subs = append(t.subs, sub2)
 
-	sub3, err := t.conn.QueueSubscribe("crawlProgress", "crawl_worker", t.recieveCrawlProgressRequest)
+	// every transport answers discovery so that all of the namespaces in use are seen
+	sub, err := t.conn.Subscribe(DiscoverySubject, func(m *nats.Msg) {
+		t.publish(m.Reply, Encoding{}, &ServiceInfo{Service: "crawler", Namespace: subjects.Namespace})
+	})
 	if err != nil {
 		return err
 	}
-	t.subs = append(t.subs, sub3)
+	t.subs = append(t.subs, sub)
 
 	return nil
 }
@@ -65,106 +81,111 @@ func (t *transportNats) Publish(ctx context.Context, crawl *Crawl) error {
 // process a crawl request synchronous request
 func (t *transportNats) recieveCrawlRequest(m *nats.Msg) {
 	var crawlRequest CrawlRequest
-	err := json.Unmarshal(m.Data, &crawlRequest)
+	enc, err := Decode(m.Data, &crawlRequest)
 	if err != nil {
-		log.Println(err)
+		t.reply(m.Reply, enc, &CrawlReply{Error: NewError(CodeInvalidRequest, err.Error())})
 		return
 	}
 
 	ctx := context.Background()
-	result, err := t.service.Crawl(ctx, crawlRequest.URL)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	reply := &CrawlReply{
-		Crawl: *result,
-		Error: err,
-	}
-
-	out, err := json.Marshal(reply)
+	result, err := t.service.Crawl(ctx, crawlRequest.URL, requestOptions(crawlRequest.Options)...)
 	if err != nil {
 		log.Println(err)
+		t.reply(m.Reply, enc, &CrawlReply{Crawl: Crawl{URL: crawlRequest.URL}, Error: toError(err)})
 		return
 	}
 
-	err = t.conn.Publish(m.Reply, out)
-	if err != nil {
-		log.Println(err)
-		return
-	}
+	t.reply(m.Reply, enc, &CrawlReply{Crawl: *result})
 }
 
 // process a crawl request asynchronously
 func (t *transportNats) recieveCrawlAsyncRequest(m *nats.Msg) {
 	var crawlRequest CrawlAsyncRequest
-	err := json.Unmarshal(m.Data, &crawlRequest)
+	enc, err := Decode(m.Data, &crawlRequest)
 	if err != nil {
-		log.Println(err)
+		t.reply(m.Reply, enc, &CrawlReply{Error: NewError(CodeInvalidRequest, err.Error())})
 		return
 	}
 
 	ctx := context.Background()
 	guid, err := t.service.CrawlAsync(ctx, crawlRequest.URL, func(c *Crawl) {
-		reply := &CrawlReply{
-			Crawl: *c,
-			Error: nil,
-		}
-		out, err := json.Marshal(reply)
-		if err != nil {
-			log.Println(err)
-			return
-		}
+		t.reply(crawlRequest.Reply, enc, &CrawlReply{Crawl: *c})
+	}, requestOptions(crawlRequest.Options)...)
 
-		t.conn.Publish(crawlRequest.Reply, out)
-	})
-
-	reply := &CrawlReply{
+	t.reply(m.Reply, enc, &CrawlReply{
 		Crawl: Crawl{ID: guid},
-		Error: err,
-	}
+		Error: toError(err),
+	})
+}
 
-	out, err := json.Marshal(reply)
+func (t *transportNats) recieveCrawlProgressRequest(m *nats.Msg) {
+	var progressRequest ProgressRequest
+	enc, err := Decode(m.Data, &progressRequest)
 	if err != nil {
-		log.Println(err)
+		t.reply(m.Reply, enc, &CrawlReply{Error: NewError(CodeInvalidRequest, err.Error())})
 		return
 	}
 
-	err = t.conn.Publish(m.Reply, out)
+	ctx := context.Background()
+	result, err := t.service.CrawlProgress(ctx, progressRequest.GUID)
+	if result == nil {
+		result = &Crawl{ID: progressRequest.GUID}
+	}
 
+	t.reply(m.Reply, enc, &CrawlReply{
+		Crawl: *result,
+		Error: toError(err),
+	})
+}
+
+// process a batch of urls, replying with the id of the batch and then publishing each
+// result and the summary to the reply subject of the request
+func (t *transportNats) recieveCrawlBatchRequest(m *nats.Msg) {
+	var batchRequest CrawlBatchRequest
+	enc, err := Decode(m.Data, &batchRequest)
 	if err != nil {
-		log.Println(err)
+		t.publish(m.Reply, enc, &CrawlBatchReply{Error: NewError(CodeInvalidRequest, err.Error())})
 		return
 	}
-}
 
-func (t *transportNats) recieveCrawlProgressRequest(m *nats.Msg) {
-	var progressRequest ProgressRequest
-	err := json.Unmarshal(m.Data, &progressRequest)
-	if err != nil {
-		log.Println(err)
+	if batchRequest.Reply == "" {
+		t.publish(m.Reply, enc, &CrawlBatchReply{Error: NewError(CodeInvalidRequest, "a subject for the results is required")})
 		return
 	}
 
 	ctx := context.Background()
-	result, err := t.service.CrawlProgress(ctx, progressRequest.GUID)
+	batchID, err := t.service.CrawlBatch(ctx, batchRequest.Items, func(r *BatchResult) {
+		t.publish(batchRequest.Reply, enc, &BatchEvent{BatchID: r.BatchID, Result: r})
+	}, func(s *BatchSummary) {
+		t.publish(batchRequest.Reply, enc, &BatchEvent{BatchID: s.BatchID, Summary: s})
+	})
 
-	reply := &CrawlReply{
-		Crawl: *result,
-		Error: err,
+	t.publish(m.Reply, enc, &CrawlBatchReply{
+		BatchID: batchID,
+		Error:   toError(err),
+	})
+}
+
+// reply sends a reply to the subject the requester is waiting on, in the encoding of
+// the request so that older clients can still read it
+func (t *transportNats) reply(subject string, enc Encoding, reply *CrawlReply) {
+	t.publish(subject, enc, reply)
+}
+
+// publish sends any message to a subject in the given encoding
+func (t *transportNats) publish(subject string, enc Encoding, msg interface{}) {
+	if subject == "" {
+		return
 	}
 
-	out, err := json.Marshal(reply)
+	out, err := enc.Encode(msg)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	err = t.conn.Publish(m.Reply, out)
-
+	err = t.conn.Publish(subject, out)
 	if err != nil {
 		log.Println(err)
-		return
 	}
 }
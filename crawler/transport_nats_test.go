@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/nats-io/gnatsd/server"
-	nats "github.com/nats-io/go-nats"
+	nats "github.com/nats-io/nats.go"
 )
 
 // DefaultTestOptions are default options for the unit tests.
@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// Validation is the result of checking a record harvested by an extractor against the
+// required fields and constraints declared in its host model
+type Validation struct {
+	Host   string
+	Rule   string
+	Valid  bool
+	Errors []FieldError
+}
+
+// FieldError describes why a single field of a harvested record failed validation.
+// Constraint is the name of the rule that failed (required, minLength, pattern etc)
+type FieldError struct {
+	Field      string
+	Constraint string
+	Message    string
+}
+
+// validateRecord checks the record extracted by a rule for the given host and reports
+// every field that is missing or does not meet its constraints
+func validateRecord(host string, rule shared.ExtractorOpts, record map[string]interface{}) Validation {
+	v := Validation{
+		Host:  host,
+		Rule:  rule.Type,
+		Valid: true,
+	}
+
+	for _, field := range rule.Required {
+		if isEmptyValue(record[field]) {
+			v.fail(field, "required", "field is required but was not found")
+		}
+	}
+
+	// walk the constraints in a stable order so the errors are reported consistently
+	fields := make([]string, 0, len(rule.Constraints))
+	for field := range rule.Constraints {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		c := rule.Constraints[field]
+		value, ok := record[field]
+		if !ok || isEmptyValue(value) {
+			continue
+		}
+
+		switch val := value.(type) {
+		case string:
+			v.checkString(field, c, val)
+
+		case []string:
+			if c.MinItems > 0 && len(val) < c.MinItems {
+				v.fail(field, "minItems", fmt.Sprintf("expected at least %d items, found %d", c.MinItems, len(val)))
+			}
+			if c.MaxItems > 0 && len(val) > c.MaxItems {
+				v.fail(field, "maxItems", fmt.Sprintf("expected at most %d items, found %d", c.MaxItems, len(val)))
+			}
+			for _, item := range val {
+				v.checkString(field, c, item)
+			}
+		}
+	}
+
+	return v
+}
+
+func (v *Validation) checkString(field string, c shared.FieldConstraint, value string) {
+	length := len([]rune(value))
+	if c.MinLength > 0 && length < c.MinLength {
+		v.fail(field, "minLength", fmt.Sprintf("expected at least %d characters, found %d", c.MinLength, length))
+	}
+
+	if c.MaxLength > 0 && length > c.MaxLength {
+		v.fail(field, "maxLength", fmt.Sprintf("expected at most %d characters, found %d", c.MaxLength, length))
+	}
+
+	if c.Pattern != "" {
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			v.fail(field, "pattern", fmt.Sprintf("invalid pattern {%s}: %s", c.Pattern, err))
+		} else if !re.MatchString(value) {
+			v.fail(field, "pattern", fmt.Sprintf("value does not match pattern {%s}", c.Pattern))
+		}
+	}
+}
+
+func (v *Validation) fail(field, constraint, message string) {
+	v.Valid = false
+	v.Errors = append(v.Errors, FieldError{
+		Field:      field,
+		Constraint: constraint,
+		Message:    message,
+	})
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch val := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(val) == ""
+	case []string:
+		return len(val) == 0
+	case time.Time:
+		return val.IsZero()
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+func TestExtractValidated(t *testing.T) {
+	for _, vt := range validationTests {
+		var host shared.Host
+		err := json.Unmarshal([]byte(vt.hostJSON), &host)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader([]byte(vt.body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex := JSONExtractor{URL: host.Host, Rules: host.Extractor}
+		_, validations, err := ex.ExtractValidated(doc)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if len(validations) != 1 {
+			t.Fatalf("expected a single validation, got %d", len(validations))
+		}
+
+		v := validations[0]
+		if v.Host != "www.example.com" || v.Rule != "NewsArticle" {
+			t.Errorf("unexpected validation source %s/%s", v.Host, v.Rule)
+		}
+
+		if v.Valid != (len(vt.failures) == 0) {
+			t.Errorf("expected valid to be %t", len(vt.failures) == 0)
+		}
+
+		if len(v.Errors) != len(vt.failures) {
+			t.Fatalf("expected %d field errors, got %+v", len(vt.failures), v.Errors)
+		}
+
+		for i, fe := range v.Errors {
+			if fe.Field+":"+fe.Constraint != vt.failures[i] {
+				t.Errorf("expected failure %s, got %s:%s", vt.failures[i], fe.Field, fe.Constraint)
+			}
+		}
+	}
+}
+
+type validationTest struct {
+	hostJSON string
+	body     string
+	failures []string
+}
+
+const validationHostJSON = `
+{
+	"host": "www.example.com",
+	"extraction": [{
+		"@type": "NewsArticle",
+		"@pageMatcher": [".article"],
+		"fields": {
+			"title": {
+				"type": "String",
+				"matcher": "h1",
+				"content": "innerHTML"
+			},
+			"tags": {
+				"type": "[]String",
+				"matcher": ".tag",
+				"content": "innerHTML"
+			}
+		},
+		"required": ["title"],
+		"constraints": {
+			"title": { "minLength": 5, "pattern": "^[A-Z]" },
+			"tags": { "minItems": 2 }
+		}
+	}]
+}
+`
+
+var validationTests = []validationTest{
+	validationTest{
+		hostJSON: validationHostJSON,
+		body: `
+			<html><body><div class="article">
+				<h1>Headline of the day</h1>
+				<span class="tag">one</span><span class="tag">two</span>
+			</div></body></html>
+		`,
+		failures: []string{},
+	},
+	validationTest{
+		hostJSON: validationHostJSON,
+		body: `
+			<html><body><div class="article">
+				<h2>Not the title</h2>
+				<span class="tag">one</span><span class="tag">two</span>
+			</div></body></html>
+		`,
+		failures: []string{"title:required"},
+	},
+	validationTest{
+		hostJSON: validationHostJSON,
+		body: `
+			<html><body><div class="article">
+				<h1>Headline of the day</h1>
+				<span class="tag">one</span>
+			</div></body></html>
+		`,
+		failures: []string{"tags:minItems"},
+	},
+}
@@ -1,23 +1,22 @@
 package crawler
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/PuerkitoBio/purell"
-	"github.com/iand/microdata"
 )
 
+// The user agent sent with every request unless a crawl asks for another
+const defaultUserAgent = "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:58.0) Gecko/20100101 Firefox/58.0"
+
 // Worker is the abstract interface for crawling a webpage
 type Worker interface {
 	Start() error
@@ -33,6 +32,12 @@ type defaultWorker struct {
 	logger     *log.Logger
 	extractors Extractors
 	publisher  Publisher
+	events     EventSink
+	archiver   Archiver
+	handlers   *ContentHandlers
+	proxies    *ProxyPool
+	sessions   *Sessions
+	network    *NetworkPolicy
 }
 
 // WorkerFactoryFunc is a function that takes a chan chan crawl and returns a worker
@@ -50,11 +55,37 @@ type WorkerOpts struct {
 	instrument Instrument
 	extractors Extractors
 	publisher  Publisher
+	events     EventSink
+	archiver   Archiver
+	handlers   *ContentHandlers
+	proxies    *ProxyPool
+	sessions   *Sessions
+	network    *NetworkPolicy
 	results    chan *Crawl
 }
 
 // NewDefaultWorker creates a new worker based on the options provided
 func NewDefaultWorker(pool chan chan *Crawl, opts WorkerOpts) Worker {
+	events := opts.events
+	if events == nil {
+		events = nullEventSink{}
+	}
+
+	archiver := opts.archiver
+	if archiver == nil {
+		archiver = nullArchiver{}
+	}
+
+	handlers := opts.handlers
+	if handlers == nil {
+		handlers = NewContentHandlers()
+	}
+
+	publisher := opts.publisher
+	if publisher == nil {
+		publisher = nullPublisher{}
+	}
+
 	return &defaultWorker{
 		pool:       pool,
 		results:    opts.results,
@@ -63,7 +94,13 @@ func NewDefaultWorker(pool chan chan *Crawl, opts WorkerOpts) Worker {
 		instrument: opts.instrument,
 		logger:     opts.logger,
 		extractors: opts.extractors,
-		publisher:  opts.publisher,
+		publisher:  publisher,
+		events:     events,
+		archiver:   archiver,
+		handlers:   handlers,
+		proxies:    opts.proxies,
+		sessions:   opts.sessions,
+		network:    opts.network,
 	}
 }
 
@@ -106,190 +143,269 @@ func (w *defaultWorker) work() {
 func (w *defaultWorker) do(u *Crawl) error {
 	w.instrument.Gauge("workers_active", 1)
 	u.StartTime = time.Now()
+	w.events.Emit(newEvent(CrawlFetchStarted, u))
 
-	parsedURL, err := url.Parse(u.URL)
+	parsed, err := url.Parse(u.URL)
 	if err != nil {
-		w.logger.Println(err)
-		w.instrument.Gauge("workers_active", -1)
-		u.Error = err.Error()
-		return err
+		return w.fail(u, err)
 	}
 
+	// nobody is waiting for a crawl whose caller gave up while it was queued
+	if u.ctx != nil && u.ctx.Err() != nil {
+		e := toError(u.ctx.Err())
+		return w.fail(u, NewError(e.Code, e.Message+" while waiting for a worker"))
+	}
+
+	// the timeout runs from when the crawl was queued, so only what is left of it
+	// once a worker is free is given to the fetch
 	client := &http.Client{}
-	req, err := http.NewRequest("GET", u.URL, nil)
+	if u.opts != nil && u.opts.Timeout > 0 {
+		client.Timeout = u.opts.Timeout
+		if !u.LoadedTime.IsZero() {
+			client.Timeout -= time.Since(u.LoadedTime)
+		}
+		if client.Timeout <= 0 {
+			return w.fail(u, NewError(CodeTimeout, "timed out waiting for a worker"))
+		}
+	}
+
+	proxy, err := w.proxies.pick(parsed.Host)
 	if err != nil {
-		w.logger.Println(err)
-		w.instrument.Gauge("workers_active", -1)
-		u.Error = err.Error()
-		return err
+		return w.fail(u, err)
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:58.0) Gecko/20100101 Firefox/58.0")
+	if proxy != nil {
+		client.Transport = proxy.transport
+		u.Proxy = proxy.name
 
-	resp, err := client.Do(req)
+		// the proxy resolves and connects to the page, see NetworkPolicy
+		err = w.network.checkAddress(parsed.Hostname())
+		if err != nil {
+			return w.fail(u, err)
+		}
+	}
+	w.network.guard(client)
+
+	sess, err := w.sessions.session(parsed.Host)
 	if err != nil {
-		w.logger.Println(err)
-		w.instrument.Gauge("workers_active", -1)
-		u.Error = err.Error()
-		return err
+		return w.fail(u, err)
+	}
+	if sess != nil {
+		client.Jar = sess.jar
 	}
 
-	defer resp.Body.Close()
+	generation, err := sess.ensure(client, parsed)
+	if err != nil {
+		return w.fail(u, err)
+	}
+
+	resp, body, err := w.fetch(client, u, proxy)
+	if err != nil {
+		return w.fail(u, err)
+	}
+
+	// log in again and fetch the page once more if the session ran out
+	if sess.expired(parsed, resp, body) {
+		err = sess.renew(client, generation)
+		if err != nil {
+			return w.fail(u, err)
+		}
+
+		resp, body, err = w.fetch(client, u, proxy)
+		if err != nil {
+			return w.fail(u, err)
+		}
+	}
 
 	if resp.StatusCode >= 400 {
-		w.logger.Println(resp.Status)
-		return errors.New("Error fetching page")
+		err = errors.New(resp.Status)
+		event := failedEvent(u, err)
+		event.StatusCode = resp.StatusCode
+		return w.failEvent(u, err, event)
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	u.FetchTime = time.Now()
+	u.ContentType = mediaType(resp.Header.Get("Content-Type"))
+	fetched := newEvent(CrawlFetched, u)
+	fetched.StatusCode = resp.StatusCode
+	fetched.Bytes = int64(len(body))
+	w.events.Emit(fetched)
+
+	if u.opts != nil && u.opts.IncludeRaw {
+		u.RawData = string(body)
+	}
+
+	err = extractFetched(u, body, w.handlers, w.extractors, w.instrument, w.logger)
 	if err != nil {
-		w.logger.Println(err)
-		w.instrument.Gauge("workers_active", -1)
-		u.Error = err.Error()
-		return err
+		return w.fail(u, err)
 	}
 
-	u.FetchTime = time.Now()
+	w.events.Emit(newEvent(CrawlExtracted, u))
 
-	s := sha256.Sum256(body)
-	sum := hex.EncodeToString(s[:])
+	w.instrument.Gauge("workers_active", -1)
+	w.instrument.Count("crawl_url")
+
+	u.EndTime = time.Now()
 
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	err = w.publisher.Publish(u)
 	if err != nil {
+		w.instrument.Count("publish_error")
 		w.logger.Println(err)
-		w.instrument.Gauge("workers_active", -1)
-		u.Error = err.Error()
-		return err
+		w.events.Emit(failedEvent(u, err))
+		return nil
 	}
 
-	title := doc.Find("title").First().Text()
-	description, _ := doc.Find("meta[name=description]").First().Attr("content")
+	w.events.Emit(newEvent(CrawlPublished, u))
+	return nil
+}
 
-	urls := doc.Find("a[href]").Map(func(i int, sel *goquery.Selection) string {
-		if attr, ok := sel.Attr("href"); ok {
-			return attr
-		}
-		return ""
-	})
+// fetch requests the page and reads its body, archiving the exchange
+func (w *defaultWorker) fetch(client *http.Client, u *Crawl, proxy *proxyState) (*http.Response, []byte, error) {
+	req, err := newPageRequest(u.URL, u.opts)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	urls2 := doc.Find("area[href]").Map(func(i int, sel *goquery.Selection) string {
-		if attr, ok := sel.Attr("href"); ok {
-			return attr
-		}
-		return ""
-	})
+	sent := time.Now()
+	resp, err := client.Do(req)
+	w.proxies.report(proxy, !proxyFailed(resp, err))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
 
-	urls = append(urls, urls2...)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	normalisedUrls := w.normaliseUrls(urls, u.URL)
+	w.archive(u, req, resp, body, sent)
+	return resp, body, nil
+}
 
-	metadata := make(map[string]interface{})
-	doc.Find("meta[name]").Each(func(_ int, sel *goquery.Selection) {
-		var name string
-		var value string
+// fail records the error that stopped a crawl
+func (w *defaultWorker) fail(u *Crawl, err error) error {
+	return w.failEvent(u, err, failedEvent(u, err))
+}
 
-		if attr, ok := sel.Attr("name"); ok {
-			name = attr
-		}
+// failEvent records the error that stopped a crawl, emitting event as its failed event,
+// and publishes the failed crawl so publishers can report on failures
+func (w *defaultWorker) failEvent(u *Crawl, err error, event *CrawlEvent) error {
+	w.logger.Println(err)
+	w.instrument.Gauge("workers_active", -1)
+	u.Error = err.Error()
+	u.EndTime = time.Now()
 
-		if attr, ok := sel.Attr("content"); ok {
-			value = attr
+	var e *Error
+	if errors.As(err, &e) {
+		u.ErrorCode = string(e.Code)
+		if e.Code == CodeBlockedAddress {
+			w.instrument.Count("blocked_address")
 		}
+	}
 
-		if name != "" && value != "" {
-			if name == "article:tag" {
-				tagsIn, ok := metadata[name]
-				if !ok {
-					metadata[name] = []string{value}
-				} else {
-					tags := tagsIn.([]string)
-					metadata[name] = append(tags, value)
-				}
-			} else {
-				metadata[name] = value
-			}
-		}
-	})
-	doc.Find("meta[property]").Each(func(_ int, sel *goquery.Selection) {
-		var name string
-		var value string
+	w.events.Emit(event)
 
-		if attr, ok := sel.Attr("property"); ok {
-			name = attr
-		}
+	perr := w.publisher.Publish(u)
+	if perr != nil {
+		w.instrument.Count("publish_error")
+		w.logger.Println(perr)
+	}
+	return err
+}
 
-		if attr, ok := sel.Attr("content"); ok {
-			value = strings.TrimSpace(attr)
-		}
+// extractFetched runs a fetched page through the handler for its content type and counts
+// the records that did not validate against their host model
+func extractFetched(u *Crawl, body []byte, handlers *ContentHandlers, exes Extractors, instrument Instrument, logger *log.Logger) error {
+	err := handlers.Handle(u, body, exes, logger)
+	if err != nil {
+		return err
+	}
 
-		if name != "" && value != "" {
-			if name == "article:tag" {
-				tagsIn, ok := metadata[name]
-				if !ok {
-					metadata[name] = []string{strings.TrimSpace(value)}
-				} else {
-					tags := tagsIn.([]string)
-					metadata[name] = append(tags, strings.TrimSpace(value))
-				}
-
-			} else {
-				metadata[name] = value
-			}
+	for _, v := range u.Validation {
+		if !v.Valid {
+			instrument.Count("extraction_invalid")
+			instrument.Count("extraction_invalid." + v.Host + "." + v.Rule)
+			logger.Printf("invalid { %s } record extracted from %s: %d field errors", v.Rule, u.URL, len(v.Errors))
 		}
-	})
+	}
+	return nil
+}
 
-	jld := []interface{}{}
-	doc.Find("script[type='application/ld+json']").Each(func(_ int, sel *goquery.Selection) {
-		content := sel.Text()
-		var parsedContent interface{}
-		err := json.Unmarshal([]byte(content), &parsedContent)
-		if err != nil {
-			return
-		}
-		jld = append(jld, parsedContent)
-	})
+// archive keeps a record of a fetch. A crawl does not fail because it could not be
+// archived
+func (w *defaultWorker) archive(u *Crawl, req *http.Request, resp *http.Response, body []byte, sent time.Time) {
+	var reqBody []byte
+	if u.opts != nil && u.opts.Body != "" {
+		reqBody = []byte(u.opts.Body)
+	}
 
-	ps := microdata.NewParser(bytes.NewReader(body), parsedURL)
-	mdata, err := ps.Parse()
+	err := w.archiver.Archive(&Fetch{
+		Request:     req,
+		RequestBody: reqBody,
+		Response:    resp,
+		Body:        body,
+		Time:        sent,
+	})
 	if err != nil {
+		w.instrument.Count("archive_error")
 		w.logger.Println(err)
-		u.Error = err.Error()
 	}
+}
 
-	var harvested []interface{}
-	fncs := w.extractors.Matches(parsedURL.Host)
-	for _, fn := range fncs {
-		h, err := fn.Extract(doc)
-		if err != nil {
-			w.logger.Println(err)
-			continue
-		}
+// newPageRequest builds the request for a page, a plain GET unless the options of the
+// crawl say otherwise
+func newPageRequest(pageURL string, opts *CrawlOptions) (*http.Request, error) {
+	if opts == nil {
+		opts = &CrawlOptions{}
+	}
 
-		if h != nil {
-			harvested = append(harvested, h)
-		}
+	method := http.MethodGet
+	if opts.Method != "" {
+		method = strings.ToUpper(opts.Method)
+	}
+
+	var body io.Reader
+	if opts.Body != "" {
+		body = strings.NewReader(opts.Body)
+	}
+
+	req, err := http.NewRequest(method, pageURL, body)
+	if err != nil {
+		return nil, err
 	}
 
-	u.ExtractTime = time.Now()
-	u.PageHash = sum
+	req.Header.Set("User-Agent", defaultUserAgent)
+	if opts.UserAgent != "" {
+		req.Header.Set("User-Agent", opts.UserAgent)
+	}
 
-	u.Title = title
-	u.Description = description
-	u.MicroData = mdata
-	u.HarvestedData = harvested
-	u.HarvestedURLs = normalisedUrls
-	u.JSONData = jld
-	u.MetaData = metadata
+	// a body without a type is most likely a form being submitted
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
 
-	w.instrument.Gauge("workers_active", -1)
-	w.instrument.Count("crawl_url")
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
 
-	u.EndTime = time.Now()
+	for name, value := range opts.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
 
-	w.publisher.Publish(u)
-	return nil
+	return req, nil
+}
+
+// mediaType strips the parameters from a content type, leaving text/html for
+// "text/html; charset=utf-8"
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mt
 }
 
-func (w *defaultWorker) normaliseUrls(urls []string, ref string) []string {
+func normaliseUrls(urls []string, ref string) []string {
 	out := []string{}
 	for _, u := range urls {
 		retURL, err := url.Parse(u)
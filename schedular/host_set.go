@@ -0,0 +1,177 @@
+package schedular
+
+import (
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/samjohnduke/crawl3/crawler"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// A HostSet looks after the HostSchedulars of every host model. When the models are
+// updated only the hosts whose schedular options changed are restarted, and the new
+// set is swapped in at once so harvested crawls never see a partial update
+type HostSet struct {
+	sched  Service
+	store  Store
+	logger *log.Logger
+
+	// newSchedular builds the schedulars of a host, NewHostSchedular unless testing
+	newSchedular func(shared.HostSchedularOpts) (HostSchedular, error)
+
+	hosts   map[string]*hostEntry
+	aliases map[string]*hostEntry
+	mu      sync.RWMutex
+}
+
+type hostEntry struct {
+	opts       []shared.HostSchedularOpts
+	schedulars []HostSchedular
+}
+
+// NewHostSet creates an empty set of host schedulars that push into the schedular
+func NewHostSet(sched Service, store Store, logger *log.Logger) *HostSet {
+	if logger == nil {
+		logger = log.New(os.Stdout, "", log.LstdFlags)
+	}
+
+	return &HostSet{
+		sched:        sched,
+		store:        store,
+		logger:       logger,
+		newSchedular: NewHostSchedular,
+		hosts:        make(map[string]*hostEntry),
+		aliases:      make(map[string]*hostEntry),
+	}
+}
+
+// stopErrors are the errors of every schedular that failed to stop
+type stopErrors []error
+
+func (errs stopErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// stopAll stops every schedular, carrying on past the ones that fail
+func stopAll(ctx context.Context, schedulars []HostSchedular) error {
+	var errs stopErrors
+	for _, s := range schedulars {
+		err := s.Stop(ctx)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// AllowedDomains lists every host and alias in the host models
+func AllowedDomains(hosts []shared.Host) []string {
+	var allowed = []string{}
+	for _, host := range hosts {
+		allowed = append(allowed, host.Host)
+		allowed = append(allowed, host.Alias...)
+	}
+	return allowed
+}
+
+// Update replaces the running host schedulars with those described by the hosts.
+// Schedulars for removed or changed hosts are stopped once the new set is in place
+func (hs *HostSet) Update(ctx context.Context, hosts []shared.Host) error {
+	hs.mu.RLock()
+	previous := hs.hosts
+	hs.mu.RUnlock()
+
+	next := make(map[string]*hostEntry)
+	aliases := make(map[string]*hostEntry)
+	var started []HostSchedular
+
+	for _, host := range hosts {
+		entry, ok := previous[host.Host]
+		if !ok || !reflect.DeepEqual(entry.opts, host.Schedular) {
+			entry = &hostEntry{opts: host.Schedular}
+			for _, o := range host.Schedular {
+				s, err := hs.newSchedular(o)
+				if err != nil {
+					hs.logger.Printf("unable to create %s schedular for host {%s}: %s", o.Type, host.Host, err)
+					continue
+				}
+
+				err = s.Start(hs.sched, hs.store)
+				if err != nil {
+					stopErr := stopAll(ctx, started)
+					if stopErr != nil {
+						hs.logger.Printf("unable to stop the schedulars started for the update: %s", stopErr)
+					}
+					return err
+				}
+
+				started = append(started, s)
+				entry.schedulars = append(entry.schedulars, s)
+			}
+		}
+
+		next[host.Host] = entry
+		for _, alias := range append([]string{host.Host}, host.Alias...) {
+			aliases[alias] = entry
+		}
+	}
+
+	hs.mu.Lock()
+	hs.hosts = next
+	hs.aliases = aliases
+	hs.mu.Unlock()
+
+	hs.sched.SetAllowedDomains(AllowedDomains(hosts))
+
+	var stopped []HostSchedular
+	for host, entry := range previous {
+		if n, ok := next[host]; ok && n == entry {
+			continue
+		}
+		stopped = append(stopped, entry.schedulars...)
+	}
+
+	return stopAll(ctx, stopped)
+}
+
+// Schedule passes a completed crawl to the schedulars of the host it was crawled from
+func (hs *HostSet) Schedule(c *crawler.Crawl) {
+	hs.mu.RLock()
+	entry, ok := hs.aliases[c.Host()]
+	hs.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	for _, s := range entry.schedulars {
+		s.Schedule(c)
+	}
+}
+
+// Stop all of the running host schedulars
+func (hs *HostSet) Stop(ctx context.Context) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	var running []HostSchedular
+	for _, entry := range hs.hosts {
+		running = append(running, entry.schedulars...)
+	}
+
+	hs.hosts = make(map[string]*hostEntry)
+	hs.aliases = make(map[string]*hostEntry)
+	return stopAll(ctx, running)
+}
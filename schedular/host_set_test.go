@@ -0,0 +1,132 @@
+package schedular
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samjohnduke/crawl3/crawler"
+	"github.com/samjohnduke/crawl3/shared"
+)
+
+// testService is a schedular service that only records the allowed domains
+type testService struct {
+	allowed []string
+}
+
+func (s *testService) Start()                                {}
+func (s *testService) Stop(context.Context) error            { return nil }
+func (s *testService) Schedule(string) error                 { return nil }
+func (s *testService) ScheduleAfter(time.Time, string) error { return nil }
+func (s *testService) OnHarvest(func(*crawler.Crawl) error)  {}
+func (s *testService) SetAllowedDomains(domains []string)    { s.allowed = domains }
+
+// testHostSchedular records how it was used and fails to stop if told to
+type testHostSchedular struct {
+	frequency string
+	started   bool
+	stopped   bool
+	scheduled int
+	stopErr   error
+}
+
+func (s *testHostSchedular) Start(Service, Store) error { s.started = true; return nil }
+func (s *testHostSchedular) Schedule(*crawler.Crawl)    { s.scheduled++ }
+func (s *testHostSchedular) Stop(context.Context) error {
+	s.stopped = true
+	return s.stopErr
+}
+
+func newTestHostSet() (*HostSet, *testService, map[string]*testHostSchedular) {
+	svc := &testService{}
+	built := make(map[string]*testHostSchedular)
+
+	hs := NewHostSet(svc, nil, log.New(ioutil.Discard, "", 0))
+	hs.newSchedular = func(o shared.HostSchedularOpts) (HostSchedular, error) {
+		s := &testHostSchedular{frequency: o.Frequency}
+		if o.Frequency == "failing" {
+			s.stopErr = errors.New("unable to stop " + o.Frequency)
+		}
+		built[o.Frequency] = s
+		return s, nil
+	}
+	return hs, svc, built
+}
+
+func testHost(host, frequency string, alias ...string) shared.Host {
+	return shared.Host{
+		Host:      host,
+		Alias:     alias,
+		Schedular: []shared.HostSchedularOpts{{Type: shared.RSS, Frequency: frequency}},
+	}
+}
+
+func TestHostSetUpdate(t *testing.T) {
+	hs, svc, built := newTestHostSet()
+
+	err := hs.Update(context.Background(), []shared.Host{
+		testHost("a.test", "a1", "www.a.test"),
+		testHost("b.test", "b1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !built["a1"].started || !built["b1"].started {
+		t.Error("expected the schedular of every host to be started")
+	}
+	if strings.Join(svc.allowed, ",") != "a.test,www.a.test,b.test" {
+		t.Errorf("unexpected allowed domains %v", svc.allowed)
+	}
+
+	hs.Schedule(&crawler.Crawl{URL: "http://www.a.test/page"})
+	if built["a1"].scheduled != 1 || built["b1"].scheduled != 0 {
+		t.Error("expected the crawl to be scheduled by the host of its alias")
+	}
+
+	// only the host whose schedular changed is restarted
+	err = hs.Update(context.Background(), []shared.Host{
+		testHost("a.test", "a2", "www.a.test"),
+		testHost("b.test", "b1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !built["a1"].stopped || !built["a2"].started || built["b1"].stopped {
+		t.Error("expected only the changed host to be restarted")
+	}
+}
+
+func TestHostSetStopErrors(t *testing.T) {
+	hs, _, built := newTestHostSet()
+
+	err := hs.Update(context.Background(), []shared.Host{
+		testHost("a.test", "failing"),
+		testHost("b.test", "b1"),
+		testHost("c.test", "c1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a schedular that fails to stop does not keep the others running
+	err = hs.Stop(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unable to stop failing") {
+		t.Errorf("expected the failure to be returned, got %v", err)
+	}
+	for name, s := range built {
+		if !s.stopped {
+			t.Errorf("expected %s to be stopped", name)
+		}
+	}
+
+	hs.Schedule(&crawler.Crawl{URL: "http://b.test/"})
+	if built["b1"].scheduled != 0 {
+		t.Error("expected a stopped set to schedule nothing")
+	}
+}
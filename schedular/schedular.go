@@ -3,7 +3,10 @@ package schedular
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/samjohnduke/crawl3/shared"
@@ -11,6 +14,9 @@ import (
 	"github.com/samjohnduke/crawl3/crawler"
 )
 
+// DefaultBatchTimeout is how long a batch of due urls may take to be handed to the crawler
+const DefaultBatchTimeout = 30 * time.Second
+
 // ErrCancelSchedule - Return this error if you want to manage the scheduling of harvested data
 var ErrCancelSchedule = errors.New("Cancel Schedule for harvest")
 
@@ -22,6 +28,7 @@ type Service interface {
 	Schedule(rootURL string) error
 	ScheduleAfter(t time.Time, rootURL string) error
 	OnHarvest(func(*crawler.Crawl) error)
+	SetAllowedDomains(domains []string)
 }
 
 // The Schedular is responsible for managing the application state of a crawl. It should
@@ -30,13 +37,16 @@ type Service interface {
 type Schedular struct {
 	visited    map[string]*shared.URL
 	pending    map[string]*shared.URLList
+	mu         sync.Mutex
 	cb         func(*crawler.Crawl) error
 	delay      time.Duration
+	timeout    time.Duration
 	die        chan chan bool
 	instrument crawler.Instrument
 	logger     *log.Logger
 	client     crawler.Client
 	allowed    map[string]bool
+	allowedMU  sync.RWMutex
 }
 
 // Opts are used to customise the
@@ -46,6 +56,10 @@ type Opts struct {
 	Client         crawler.Client
 	CrawlDelay     time.Duration
 	AllowedDomains []string
+
+	// BatchTimeout is how long the crawler has to accept each batch, DefaultBatchTimeout
+	// when zero
+	BatchTimeout time.Duration
 }
 
 // A HostSchedular looks after a spefic host and is control of scheduling that hosts
@@ -58,14 +72,23 @@ type HostSchedular interface {
 
 // NewHostSchedular builds the host schedular from the provided options,
 // and using the opts.Type field, create the schedular of the correct type
-func NewHostSchedular(opts shared.HostSchedularOpts) HostSchedular {
+func NewHostSchedular(opts shared.HostSchedularOpts) (HostSchedular, error) {
 	switch opts.Type {
 	case shared.RSS:
-		return NewRSSSchedular(NewRSSSchedularOpts(opts))
+		rssOpts, err := NewRSSSchedularOpts(opts)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSSSchedular(rssOpts), nil
+
 	case shared.Sitemap:
-		return NewSitemapSchedular(NewSitemapSchedularOpts(opts))
+		sitemapOpts, err := NewSitemapSchedularOpts(opts)
+		if err != nil {
+			return nil, err
+		}
+		return NewSitemapSchedular(sitemapOpts), nil
 	}
-	return nil
+	return nil, fmt.Errorf("unknown schedular type {%s}", opts.Type)
 }
 
 // NewSchedular created the new schedular from a set of options
@@ -75,6 +98,11 @@ func NewSchedular(opts Opts) (Service, error) {
 		allowed[a] = true
 	}
 
+	timeout := opts.BatchTimeout
+	if timeout <= 0 {
+		timeout = DefaultBatchTimeout
+	}
+
 	return &Schedular{
 		visited:    make(map[string]*shared.URL),
 		pending:    make(map[string]*shared.URLList),
@@ -82,6 +110,7 @@ func NewSchedular(opts Opts) (Service, error) {
 		instrument: opts.Instrument,
 		client:     opts.Client,
 		delay:      opts.CrawlDelay,
+		timeout:    timeout,
 		die:        make(chan chan bool),
 		allowed:    allowed,
 	}, nil
@@ -122,6 +151,34 @@ func (s *Schedular) Stop(ctx context.Context) error {
 }
 
 func (s *Schedular) run() {
+	batch, items := s.due()
+	if len(items) == 0 {
+		return
+	}
+
+	// the lock is not held while the batch is sent, as a slow crawler would otherwise
+	// hold up Schedule and Stop, and the results of the batch need it too
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	// every due url is sent in a single batch and handled as its crawl finishes
+	s.instrument.Gauge("scheduled_crawl_progress", int64(len(items)))
+	_, err := s.client.CrawlBatch(ctx, items, func(r *crawler.BatchResult) {
+		s.instrument.Gauge("scheduled_crawl_progress", -1)
+		s.crawled(batch[r.ItemID], r)
+	}, nil)
+	if err != nil {
+		s.instrument.Gauge("scheduled_crawl_progress", -int64(len(items)))
+		s.instrument.Count("scheduled_crawl_error")
+		log.Println(err)
+	}
+}
+
+// due takes the next url of every host that has not been visited and is allowed, as the
+// items of a batch keyed by their id
+func (s *Schedular) due() (map[string]*shared.URL, []crawler.BatchItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	toCrawl := []*shared.URL{}
 	for _, list := range s.pending {
@@ -130,36 +187,39 @@ func (s *Schedular) run() {
 		}
 	}
 
+	batch := map[string]*shared.URL{}
+	items := []crawler.BatchItem{}
 	for _, u := range toCrawl {
 		if _, exists := s.visited[u.Normalised()]; exists {
 			continue
 		}
 
-		rHost := u.Hostname()
-		if _, exists := s.allowed[rHost]; exists {
-			go s.crawl(u)
+		if s.isAllowed(u.Hostname()) {
+			id := strconv.Itoa(len(items))
+			batch[id] = u
+			items = append(items, crawler.BatchItem{ID: id, URL: u.Normalised()})
 		}
 	}
+	return batch, items
 }
 
-func (s *Schedular) crawl(u *shared.URL) {
-	s.instrument.Gauge("scheduled_crawl_progress", 1)
-	defer s.instrument.Gauge("scheduled_crawl_progress", -1)
-
-	log.Println("starting crawl of: ", u.Normalised())
-	crawl, err := s.client.Crawl(context.Background(), u.Normalised())
-	if err != nil {
+// crawled records the result of crawling a url and schedules the urls harvested from it
+func (s *Schedular) crawled(u *shared.URL, r *crawler.BatchResult) {
+	if r.Error != nil {
 		s.instrument.Count("scheduled_crawl_error")
-		log.Println(err)
+		log.Println(r.Error)
 		return
 	}
 
+	crawl := r.Crawl
 	if crawl.Error != "" {
 		log.Println(crawl.Error)
 		return
 	}
 
+	s.mu.Lock()
 	s.visited[u.Normalised()] = u
+	s.mu.Unlock()
 
 	if s.cb != nil {
 		err := s.cb(crawl)
@@ -195,6 +255,9 @@ func (s *Schedular) Schedule(root string) error {
 	s.instrument.Count("schedular_one")
 	s.instrument.Histogram("schedular_one_host", rHost)
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	a, exists := s.pending[rHost]
 	if !exists {
 		li := shared.NewURLList()
@@ -207,6 +270,25 @@ func (s *Schedular) Schedule(root string) error {
 	return nil
 }
 
+// SetAllowedDomains replaces the list of domains the schedular is allowed to crawl
+func (s *Schedular) SetAllowedDomains(domains []string) {
+	allowed := make(map[string]bool)
+	for _, a := range domains {
+		allowed[a] = true
+	}
+
+	s.allowedMU.Lock()
+	s.allowed = allowed
+	s.allowedMU.Unlock()
+}
+
+func (s *Schedular) isAllowed(host string) bool {
+	s.allowedMU.RLock()
+	defer s.allowedMU.RUnlock()
+
+	return s.allowed[host]
+}
+
 // OnHarvest is called when data has been harvest.
 func (s *Schedular) OnHarvest(fn func(*crawler.Crawl) error) {
 	s.cb = fn
@@ -3,6 +3,7 @@ package schedular
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -22,27 +23,42 @@ type RSSSchedular struct {
 	allowInsecure bool
 }
 
+// RSSSchedularOpts is used to configure the RSSSchedular
 type RSSSchedularOpts struct {
 	Feeds         []string
 	AllowInsecure bool
 }
 
-func NewRSSSchedularOpts(opts shared.HostSchedularOpts) RSSSchedularOpts {
+// NewRSSSchedularOpts reads the RSS options from the data of a host model, returning an
+// error rather than panicking when the data is not in the expected shape
+func NewRSSSchedularOpts(opts shared.HostSchedularOpts) (RSSSchedularOpts, error) {
+	list, ok := opts.Data["feeds"].([]interface{})
+	if !ok {
+		return RSSSchedularOpts{}, errors.New("RSS schedular requires a list of feeds")
+	}
+
 	var feeds []string
-	for _, f := range opts.Data["feeds"].([]interface{}) {
-		feeds = append(feeds, f.(string))
+	for _, f := range list {
+		feed, ok := f.(string)
+		if !ok {
+			return RSSSchedularOpts{}, errors.New("RSS schedular feeds must be strings")
+		}
+		feeds = append(feeds, feed)
 	}
 
 	var insecure bool
 	ai, ok := opts.Data["allow_insecure"]
 	if ok {
-		insecure = ai.(bool)
+		insecure, ok = ai.(bool)
+		if !ok {
+			return RSSSchedularOpts{}, errors.New("RSS schedular allow_insecure must be a boolean")
+		}
 	}
 
 	return RSSSchedularOpts{
 		Feeds:         feeds,
 		AllowInsecure: insecure,
-	}
+	}, nil
 }
 
 func NewRSSSchedular(opts RSSSchedularOpts) *RSSSchedular {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
@@ -37,10 +38,21 @@ type SitemapSchedularOpts struct {
 	SitemapFilter   SitemapFilter
 }
 
-func NewSitemapSchedularOpts(opts shared.HostSchedularOpts) SitemapSchedularOpts {
+// NewSitemapSchedularOpts reads the sitemap options from the data of a host model,
+// returning an error rather than panicking when the data is not in the expected shape
+func NewSitemapSchedularOpts(opts shared.HostSchedularOpts) (SitemapSchedularOpts, error) {
+	list, ok := opts.Data["sitemaps"].([]interface{})
+	if !ok {
+		return SitemapSchedularOpts{}, errors.New("Sitemap schedular requires a list of sitemaps")
+	}
+
 	var sitemaps []string
-	for _, f := range opts.Data["sitemaps"].([]interface{}) {
-		sitemaps = append(sitemaps, f.(string))
+	for _, f := range list {
+		sitemap, ok := f.(string)
+		if !ok {
+			return SitemapSchedularOpts{}, errors.New("Sitemap schedular sitemaps must be strings")
+		}
+		sitemaps = append(sitemaps, sitemap)
 	}
 
 	var filterFunc SitemapFilter
@@ -52,12 +64,16 @@ func NewSitemapSchedularOpts(opts shared.HostSchedularOpts) SitemapSchedularOpts
 				for k, v := range ff {
 					switch k {
 					case "contains":
+						arr, ok := v.([]interface{})
+						if !ok {
+							return SitemapSchedularOpts{}, errors.New("Sitemap schedular contains filter must be a list")
+						}
+
 						filterFunc = func(u string) bool {
-							arr := v.([]interface{})
 							var r bool
 
 							for _, s := range arr {
-								if strings.Contains(u, s.(string)) {
+								if str, ok := s.(string); ok && strings.Contains(u, str) {
 									r = true
 								}
 							}
@@ -74,7 +90,7 @@ func NewSitemapSchedularOpts(opts shared.HostSchedularOpts) SitemapSchedularOpts
 	return SitemapSchedularOpts{
 		Sitemaps:      sitemaps,
 		SitemapFilter: filterFunc,
-	}
+	}, nil
 }
 
 // NewSitemapSchedular creates a new SitemapSchedular from the provided options
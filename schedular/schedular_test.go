@@ -0,0 +1,85 @@
+package schedular
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/samjohnduke/crawl3/crawler"
+)
+
+// hungClient accepts batches only once their context is done, like a crawler that
+// has stopped responding
+type hungClient struct {
+	crawler.Client
+	batches chan []crawler.BatchItem
+	expired chan error
+}
+
+func (c *hungClient) CrawlBatch(ctx context.Context, items []crawler.BatchItem, cb func(*crawler.BatchResult), done func(*crawler.BatchSummary)) (string, error) {
+	c.batches <- items
+	<-ctx.Done()
+	c.expired <- ctx.Err()
+	return "", ctx.Err()
+}
+
+func TestSchedularHungClient(t *testing.T) {
+	client := &hungClient{batches: make(chan []crawler.BatchItem, 1), expired: make(chan error, 1)}
+	service, err := NewSchedular(Opts{
+		Client:         client,
+		CrawlDelay:     10 * time.Millisecond,
+		Instrument:     crawler.NewInstrumentationMem(),
+		Logger:         log.New(ioutil.Discard, "", 0),
+		AllowedDomains: []string{"a.test"},
+		BatchTimeout:   200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.Schedule("http://a.test/one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Start()
+
+	select {
+	case items := <-client.batches:
+		if len(items) != 1 || items[0].URL != "http://a.test/one" {
+			t.Errorf("unexpected batch %v", items)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the url to be sent to the crawler")
+	}
+
+	// urls can still be scheduled while the crawler is not answering
+	scheduled := make(chan error, 1)
+	go func() { scheduled <- service.Schedule("http://a.test/two") }()
+	select {
+	case err = <-scheduled:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("expected scheduling not to wait for the crawler")
+	}
+
+	select {
+	case err = <-client.expired:
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected the batch to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the batch to be given a deadline")
+	}
+
+	<-client.batches
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = service.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package schedular
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStorage implements the schedular.Store interface in memory. Nothing survives a
+// restart so it is meant for single process runs and tests
+type MemoryStorage struct {
+	visits map[string]Visit
+	queue  map[string]bool
+	queued map[string]time.Time
+	mu     sync.Mutex
+}
+
+// NewMemoryStore creates an empty in memory store
+func NewMemoryStore() Store {
+	return &MemoryStorage{
+		visits: make(map[string]Visit),
+		queue:  make(map[string]bool),
+		queued: make(map[string]time.Time),
+	}
+}
+
+// Queue pushes the provided url into the queue
+func (s *MemoryStorage) Queue(u string) error {
+	s.mu.Lock()
+	s.queue[u] = true
+	s.mu.Unlock()
+	return nil
+}
+
+// QueueAt pushes the provided url into the queue at some future time
+func (s *MemoryStorage) QueueAt(u string, t time.Time) error {
+	s.mu.Lock()
+	s.queued[u] = t
+	s.mu.Unlock()
+	return nil
+}
+
+// IsQueued checks if the url is in the queue
+func (s *MemoryStorage) IsQueued(u string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue[u]
+}
+
+// Visit records a visit to the url with the latest hash and takes it off the queue
+func (s *MemoryStorage) Visit(u string, hash string) (Visit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	visit, ok := s.visits[u]
+	if !ok {
+		visit = Visit{
+			URL:             u,
+			UpdateFrequency: 15 * time.Minute,
+		}
+	}
+
+	visit.LastUpdate = &now
+	visit.LastHash = hash
+	visit.VisitCount++
+
+	s.visits[u] = visit
+	delete(s.queue, u)
+
+	return visit, nil
+}
+
+// ShouldVisit determines if it is appropriate to push the URL into the queue
+func (s *MemoryStorage) ShouldVisit(u string) bool {
+	return !s.HasVisited(u) && !s.IsQueued(u)
+}
+
+// HasVisited checks if the url has been visited before
+func (s *MemoryStorage) HasVisited(u string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.visits[u]
+	return ok
+}
+
+// Reschedule pushes the urls queued for a time that has passed into the schedular
+func (s *MemoryStorage) Reschedule(sched Service) {
+	s.mu.Lock()
+	var due []string
+	now := time.Now()
+	for u, at := range s.queued {
+		if !at.After(now) {
+			due = append(due, u)
+			delete(s.queued, u)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, u := range due {
+		sched.Schedule(u)
+	}
+}
@@ -1,10 +1,12 @@
 package shared
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 
 	"github.com/pkg/errors"
 )
@@ -25,6 +27,10 @@ type Host struct {
 	Alias     []string            `json:"alias"`
 	Schedular []HostSchedularOpts `json:"schedular"`
 	Extractor []ExtractorOpts     `json:"extraction"`
+	Scripts   []ScriptOpts        `json:"scripts"`
+	API       []APIOpts           `json:"api"`
+	Proxy     *HostProxyOpts      `json:"proxy"`
+	Login     *HostLoginOpts      `json:"login"`
 }
 
 // HostSchedularOpts provides the configuration of a schedular
@@ -34,11 +40,25 @@ type HostSchedularOpts struct {
 	Data      map[string]interface{} `json:"data"`
 }
 
-// ExtractorOpts provide the extraction options to pull data from a website
+// ExtractorOpts provide the extraction options to pull data from a website. Required
+// lists the fields that must be found for a record to be valid and Constraints
+// restricts the values those fields may take
 type ExtractorOpts struct {
-	Type      string               `json:"@type"`
-	PageMatch []string             `json:"@pageMatcher"`
-	Fields    map[string]FieldRule `json:"fields"`
+	Type        string                     `json:"@type"`
+	PageMatch   []string                   `json:"@pageMatcher"`
+	Fields      map[string]FieldRule       `json:"fields"`
+	Required    []string                   `json:"required"`
+	Constraints map[string]FieldConstraint `json:"constraints"`
+}
+
+// FieldConstraint defines the limits on the value of a single extracted field. A zero
+// value for any of the limits means that limit is not checked
+type FieldConstraint struct {
+	MinLength int    `json:"minLength"`
+	MaxLength int    `json:"maxLength"`
+	Pattern   string `json:"pattern"`
+	MinItems  int    `json:"minItems"`
+	MaxItems  int    `json:"maxItems"`
 }
 
 // FieldRule defines the data required to pull a single piece of a data from a website
@@ -50,8 +70,101 @@ type FieldRule struct {
 	ExcludeMatch   []string `json:"excludeMatch"`
 }
 
-// LoadHostsFromDir will look in a directory for a list of JSON files and if possible
-// load them into a slice of Host objects
+// ScriptOpts configures an extractor whose logic is written as a script. The script
+// is either given inline as Source or read from File, relative to the model. Timeout is
+// a duration string of wall-clock time and MemoryLimit is measured in megabytes
+type ScriptOpts struct {
+	Type        string `json:"@type"`
+	File        string `json:"file"`
+	Source      string `json:"source"`
+	Timeout     string `json:"timeout"`
+	MemoryLimit int64  `json:"memoryLimit"`
+}
+
+// ProxyMode is how the pages of a host are fetched through the proxy pool
+type ProxyMode string
+
+// Enums of ProxyMode
+const (
+	ProxyRotate ProxyMode = "rotate"
+	ProxyPin    ProxyMode = "pin"
+	ProxyDirect ProxyMode = "direct"
+)
+
+// HostProxyOpts choose the proxies a host is fetched through. Rotate spreads the pages
+// over the proxies, pin keeps the host on one proxy for as long as it stays healthy and
+// direct does not use a proxy. Tags limits the host to the proxies with one of the tags,
+// such as the country they are in
+type HostProxyOpts struct {
+	Mode ProxyMode `json:"mode"`
+	Tags []string  `json:"tags"`
+}
+
+// HostLoginOpts describe how to log in to a host. The form at URL is fetched and posted
+// to its action with its own inputs and Fields, or Fields alone are posted to Action if
+// there is no Form selector. A field value can reference a credential with
+// ${env:NAME} for an environment variable or ${secret:NAME} for a value of the secrets
+// file, so credentials are kept out of the model
+type HostLoginOpts struct {
+	URL     string            `json:"url"`
+	Form    string            `json:"form"`
+	Action  string            `json:"action"`
+	Fields  map[string]string `json:"fields"`
+	Success LoginCheck        `json:"success"`
+	Expired *LoginCheck       `json:"expired"`
+}
+
+// LoginCheck matches a response. A login succeeded when every check that is set
+// matches its response, and a session has expired when any of them match a page. For
+// an expired session Cookie matches when the cookie is missing, and when no checks are
+// given a 401 response means the session expired
+type LoginCheck struct {
+	Status   []int  `json:"status"`
+	Contains string `json:"contains"`
+	Cookie   string `json:"cookie"`
+	URL      string `json:"url"`
+}
+
+// CredentialPattern matches the references to credentials in the fields of a login
+var CredentialPattern = regexp.MustCompile(`\$\{([a-z]+):([^}]*)\}`)
+
+// APIOpts provide the extraction options for the JSON responses of an api. Records is
+// a JSONPath selecting the records in a response, defaulting to the whole response,
+// and the paths of the fields are relative to each record. PathMatch limits the rule
+// to the responses whose url path matches one of its regular expressions
+type APIOpts struct {
+	Type        string                     `json:"@type"`
+	PathMatch   []string                   `json:"@pathMatcher"`
+	Records     string                     `json:"@records"`
+	Fields      map[string]APIFieldRule    `json:"fields"`
+	Required    []string                   `json:"required"`
+	Constraints map[string]FieldConstraint `json:"constraints"`
+	Pagination  *PaginationOpts            `json:"pagination"`
+}
+
+// APIFieldRule defines how a single field is read from an api record
+type APIFieldRule struct {
+	Kind string `json:"type"`
+	Path string `json:"path"`
+}
+
+// PaginationOpts finds the next page of an api response. Next is a JSONPath to the url
+// of the next page. Otherwise Template is the url of the next page with {cursor}
+// replaced by the value at Cursor, or with {page} replaced by the number of the next
+// page. The current page number is read from Page, or from the query parameter of the
+// template that holds {page}, starting at 1. Page numbers stop at Pages, at MaxPages or
+// at the first page without any records
+type PaginationOpts struct {
+	Next     string `json:"next"`
+	Cursor   string `json:"cursor"`
+	Page     string `json:"page"`
+	Pages    string `json:"pages"`
+	Template string `json:"template"`
+	MaxPages int    `json:"maxPages"`
+}
+
+// LoadHostsFromDir will look in a directory for a list of JSON or YAML files and if
+// possible load them into a slice of Host objects
 func LoadHostsFromDir(dirname string) ([]Host, error) {
 	files, err := ioutil.ReadDir(dirname)
 	if err != nil {
@@ -60,6 +173,10 @@ func LoadHostsFromDir(dirname string) ([]Host, error) {
 
 	var hosts = []Host{}
 	for _, file := range files {
+		if !isModelFile(file) {
+			continue
+		}
+
 		filename := path.Join(dirname, file.Name())
 		host, err := parseHost(filename)
 		if err != nil {
@@ -73,21 +190,61 @@ func LoadHostsFromDir(dirname string) ([]Host, error) {
 	return hosts, nil
 }
 
+// LoadHostFile loads and validates a single host model, along with any scripts it
+// references
+func LoadHostFile(path string) (Host, error) {
+	return parseHost(path)
+}
+
 func parseHost(path string) (Host, error) {
-	hostJSON, err := ioutil.ReadFile(path)
+	hostData, err := ioutil.ReadFile(path)
 	if err != nil {
 		return Host{}, errors.Wrap(err, "unable to read data from file")
 	}
 
-	return parseJSONHost(hostJSON)
-}
+	host, err := ParseHost(path, hostData)
+	if err != nil {
+		return Host{}, err
+	}
 
-func parseJSONHost(data []byte) (Host, error) {
-	var host Host
-	err := json.Unmarshal(data, &host)
+	err = loadScripts(&host, path)
 	if err != nil {
-		return Host{}, errors.Wrap(err, "unable to parse json data")
+		return Host{}, err
 	}
 
 	return host, nil
 }
+
+// isModelFile reports whether a file in the model directory holds a host model, rather
+// than a script or fixture that belongs to one
+func isModelFile(file os.FileInfo) bool {
+	if file.IsDir() {
+		return false
+	}
+
+	ext := filepath.Ext(file.Name())
+	return ext == ".json" || ext == ".yaml" || ext == ".yml"
+}
+
+// loadScripts reads the source of any scripts that the host model references by file
+func loadScripts(host *Host, modelPath string) error {
+	for i, script := range host.Scripts {
+		if script.Source != "" || script.File == "" {
+			continue
+		}
+
+		filename := script.File
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(filepath.Dir(modelPath), filename)
+		}
+
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read script {%s}", script.File)
+		}
+
+		host.Scripts[i].Source = string(src)
+	}
+
+	return nil
+}
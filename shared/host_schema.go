@@ -0,0 +1,248 @@
+package shared
+
+// HostSchema is the JSON Schema for a host model. Models are checked against it when
+// they are loaded, and it can be given to editors to validate models as they are written
+const HostSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/samjohnduke/crawl3/host.schema.json",
+  "title": "crawl3 host model",
+  "type": "object",
+  "additionalProperties": false,
+  "required": ["host"],
+  "properties": {
+    "host": {
+      "description": "The host name the model applies to",
+      "type": "string",
+      "minLength": 1
+    },
+    "alias": {
+      "description": "Other host names that serve the same site",
+      "type": "array",
+      "items": { "type": "string", "minLength": 1 }
+    },
+    "schedular": {
+      "type": "array",
+      "items": { "$ref": "#/definitions/schedular" }
+    },
+    "extraction": {
+      "type": "array",
+      "items": { "$ref": "#/definitions/extractor" }
+    },
+    "scripts": {
+      "type": "array",
+      "items": { "$ref": "#/definitions/script" }
+    },
+    "api": {
+      "type": "array",
+      "items": { "$ref": "#/definitions/api" }
+    },
+    "proxy": {
+      "description": "How the pages of the host are fetched through the proxy pool",
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "mode": { "enum": ["rotate", "pin", "direct"] },
+        "tags": { "type": "array", "items": { "type": "string", "minLength": 1 } }
+      }
+    },
+    "login": {
+      "description": "How to log in to the host before fetching its pages",
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["url", "fields", "success"],
+      "properties": {
+        "url": { "type": "string", "pattern": "^https?://" },
+        "form": { "type": "string", "minLength": 1 },
+        "action": { "type": "string", "minLength": 1 },
+        "fields": {
+          "type": "object",
+          "minProperties": 1,
+          "additionalProperties": { "type": "string" }
+        },
+        "success": { "$ref": "#/definitions/loginCheck" },
+        "expired": { "$ref": "#/definitions/loginCheck" }
+      }
+    }
+  },
+  "definitions": {
+    "stringList": {
+      "type": "array",
+      "items": { "type": "string" }
+    },
+    "schedular": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["type"],
+      "properties": {
+        "type": { "enum": ["RSS", "Sitemap"] },
+        "frequency": { "type": "string" },
+        "data": { "type": "object" }
+      },
+      "allOf": [
+        {
+          "if": { "properties": { "type": { "const": "RSS" } } },
+          "then": {
+            "required": ["data"],
+            "properties": {
+              "data": {
+                "type": "object",
+                "additionalProperties": false,
+                "required": ["feeds"],
+                "properties": {
+                  "feeds": { "type": "array", "minItems": 1, "items": { "type": "string", "minLength": 1 } },
+                  "allow_insecure": { "type": "boolean" }
+                }
+              }
+            }
+          }
+        },
+        {
+          "if": { "properties": { "type": { "const": "Sitemap" } } },
+          "then": {
+            "required": ["data"],
+            "properties": {
+              "data": {
+                "type": "object",
+                "additionalProperties": false,
+                "required": ["sitemaps"],
+                "properties": {
+                  "sitemaps": { "type": "array", "minItems": 1, "items": { "type": "string", "minLength": 1 } },
+                  "filter": {
+                    "type": "array",
+                    "items": {
+                      "type": "object",
+                      "additionalProperties": false,
+                      "properties": {
+                        "contains": { "$ref": "#/definitions/stringList" }
+                      }
+                    }
+                  }
+                }
+              }
+            }
+          }
+        }
+      ]
+    },
+    "extractor": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["@type", "@pageMatcher", "fields"],
+      "properties": {
+        "@type": { "type": "string", "minLength": 1 },
+        "@pageMatcher": { "type": "array", "minItems": 1, "items": { "type": "string", "minLength": 1 } },
+        "fields": {
+          "type": "object",
+          "additionalProperties": { "$ref": "#/definitions/field" }
+        },
+        "required": { "$ref": "#/definitions/stringList" },
+        "constraints": {
+          "type": "object",
+          "additionalProperties": { "$ref": "#/definitions/constraint" }
+        }
+      }
+    },
+    "field": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["type", "matcher"],
+      "properties": {
+        "type": { "enum": ["String", "[]String", "Time"] },
+        "matcher": { "type": "string", "minLength": 1 },
+        "content": { "type": "string" },
+        "content_match": { "$ref": "#/definitions/stringList" },
+        "excludeMatch": { "$ref": "#/definitions/stringList" }
+      }
+    },
+    "constraint": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "minLength": { "type": "integer", "minimum": 0 },
+        "maxLength": { "type": "integer", "minimum": 0 },
+        "pattern": { "type": "string", "format": "regex" },
+        "minItems": { "type": "integer", "minimum": 0 },
+        "maxItems": { "type": "integer", "minimum": 0 }
+      }
+    },
+    "api": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["@type", "fields"],
+      "properties": {
+        "@type": { "type": "string", "minLength": 1 },
+        "@pathMatcher": { "type": "array", "items": { "type": "string", "minLength": 1 } },
+        "@records": { "type": "string", "minLength": 1 },
+        "fields": {
+          "type": "object",
+          "additionalProperties": { "$ref": "#/definitions/apiField" }
+        },
+        "required": { "$ref": "#/definitions/stringList" },
+        "constraints": {
+          "type": "object",
+          "additionalProperties": { "$ref": "#/definitions/constraint" }
+        },
+        "pagination": { "$ref": "#/definitions/pagination" }
+      }
+    },
+    "apiField": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["type", "path"],
+      "properties": {
+        "type": { "enum": ["String", "[]String", "Number", "Bool", "Time", "Any"] },
+        "path": { "type": "string", "minLength": 1 }
+      }
+    },
+    "pagination": {
+      "type": "object",
+      "additionalProperties": false,
+      "anyOf": [
+        { "required": ["next"] },
+        { "required": ["template"] }
+      ],
+      "dependencies": {
+        "cursor": ["template"],
+        "page": ["template"],
+        "pages": ["template"],
+        "maxPages": ["template"]
+      },
+      "properties": {
+        "next": { "type": "string", "minLength": 1 },
+        "cursor": { "type": "string", "minLength": 1 },
+        "page": { "type": "string", "minLength": 1 },
+        "pages": { "type": "string", "minLength": 1 },
+        "template": { "type": "string", "minLength": 1 },
+        "maxPages": { "type": "integer", "minimum": 1 }
+      }
+    },
+    "loginCheck": {
+      "type": "object",
+      "additionalProperties": false,
+      "minProperties": 1,
+      "properties": {
+        "status": { "type": "array", "items": { "type": "integer", "minimum": 100, "maximum": 599 } },
+        "contains": { "type": "string", "minLength": 1 },
+        "cookie": { "type": "string", "minLength": 1 },
+        "url": { "type": "string", "format": "regex" }
+      }
+    },
+    "script": {
+      "type": "object",
+      "additionalProperties": false,
+      "required": ["@type"],
+      "anyOf": [
+        { "required": ["file"] },
+        { "required": ["source"] }
+      ],
+      "properties": {
+        "@type": { "type": "string", "minLength": 1 },
+        "file": { "type": "string", "minLength": 1 },
+        "source": { "type": "string", "minLength": 1 },
+        "timeout": { "type": "string" },
+        "memoryLimit": { "type": "integer", "minimum": 1 }
+      }
+    }
+  }
+}
+`
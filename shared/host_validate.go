@@ -0,0 +1,429 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// A ModelError is a single problem found in a host model. Path is the JSON pointer of
+// the value that is wrong and Line is where it can be found in the model file
+type ModelError struct {
+	File    string
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e ModelError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Path, e.Message)
+}
+
+// ModelErrors is every problem found when validating a host model
+type ModelErrors []ModelError
+
+func (e ModelErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, me := range e {
+		lines[i] = me.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	hostSchema     *jsonschema.Schema
+	hostSchemaErr  error
+	hostSchemaOnce sync.Once
+
+	quotedName = regexp.MustCompile(`'([^']+)'`)
+)
+
+func compiledHostSchema() (*jsonschema.Schema, error) {
+	hostSchemaOnce.Do(func() {
+		hostSchema, hostSchemaErr = jsonschema.CompileString("host.schema.json", HostSchema)
+	})
+	return hostSchema, hostSchemaErr
+}
+
+// isYAML reports whether a model file is written in YAML rather than JSON
+func isYAML(filename string) bool {
+	ext := filepath.Ext(filename)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// ParseHost parses and strictly validates a host model. The format is chosen from the
+// file extension, YAML for .yaml and .yml and JSON for everything else. If the model
+// is invalid the error is a ModelErrors listing every problem with its line number
+func ParseHost(filename string, data []byte) (Host, error) {
+	var doc interface{}
+	var lines map[string]int
+	var err error
+
+	if isYAML(filename) {
+		doc, lines, err = decodeYAMLModel(data)
+	} else {
+		doc, lines, err = decodeJSONModel(data)
+	}
+	if err != nil {
+		return Host{}, errors.Wrapf(err, "unable to parse %s", filename)
+	}
+
+	schema, err := compiledHostSchema()
+	if err != nil {
+		return Host{}, errors.Wrap(err, "unable to compile host schema")
+	}
+
+	var problems ModelErrors
+	err = schema.Validate(doc)
+	if verr, ok := err.(*jsonschema.ValidationError); ok {
+		problems = append(problems, schemaErrors(filename, lines, verr)...)
+	} else if err != nil {
+		return Host{}, err
+	}
+
+	if len(problems) > 0 {
+		sortModelErrors(problems)
+		return Host{}, problems
+	}
+
+	// the document is known to be well formed so it can be decoded from its json form
+	normalised, err := json.Marshal(doc)
+	if err != nil {
+		return Host{}, err
+	}
+
+	var host Host
+	err = json.Unmarshal(normalised, &host)
+	if err != nil {
+		return Host{}, errors.Wrapf(err, "unable to parse %s", filename)
+	}
+
+	problems = append(problems, checkHost(filename, lines, host)...)
+	if len(problems) > 0 {
+		sortModelErrors(problems)
+		return Host{}, problems
+	}
+
+	return host, nil
+}
+
+// checkHost looks for the problems in a host model that the schema cannot describe,
+// such as references between fields
+func checkHost(filename string, lines map[string]int, host Host) ModelErrors {
+	var problems ModelErrors
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, ModelError{
+			File:    filename,
+			Line:    lineOf(lines, path),
+			Path:    path,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// checkRecord checks the required fields and constraints of a rule refer to its fields
+	checkRecord := func(base string, defined func(string) bool, required []string, constraints map[string]FieldConstraint) {
+		for j, field := range required {
+			if !defined(field) {
+				add(base+"/required/"+strconv.Itoa(j), "required field {%s} is not defined in fields", field)
+			}
+		}
+
+		for field, c := range constraints {
+			path := base + "/constraints/" + pointerEscape(field)
+			if !defined(field) {
+				add(path, "constraint for {%s} which is not defined in fields", field)
+			}
+
+			if c.Pattern != "" {
+				if _, err := regexp.Compile(c.Pattern); err != nil {
+					add(path+"/pattern", "invalid pattern: %s", err)
+				}
+			}
+		}
+	}
+
+	checkPath := func(path, expr string) {
+		if expr == "" {
+			return
+		}
+		if _, err := CompileJSONPath(expr); err != nil {
+			add(path, "invalid jsonpath: %s", err)
+		}
+	}
+
+	for i, rule := range host.Extractor {
+		checkRecord("/extraction/"+strconv.Itoa(i), func(field string) bool {
+			_, ok := rule.Fields[field]
+			return ok
+		}, rule.Required, rule.Constraints)
+	}
+
+	for i, rule := range host.API {
+		base := "/api/" + strconv.Itoa(i)
+
+		checkRecord(base, func(field string) bool {
+			_, ok := rule.Fields[field]
+			return ok
+		}, rule.Required, rule.Constraints)
+
+		for j, pattern := range rule.PathMatch {
+			if _, err := regexp.Compile(pattern); err != nil {
+				add(base+"/@pathMatcher/"+strconv.Itoa(j), "invalid pattern: %s", err)
+			}
+		}
+
+		checkPath(base+"/@records", rule.Records)
+		for field, f := range rule.Fields {
+			checkPath(base+"/fields/"+pointerEscape(field)+"/path", f.Path)
+		}
+
+		if p := rule.Pagination; p != nil {
+			base := base + "/pagination"
+			checkPath(base+"/next", p.Next)
+			checkPath(base+"/cursor", p.Cursor)
+			checkPath(base+"/page", p.Page)
+			checkPath(base+"/pages", p.Pages)
+
+			if p.Cursor != "" && !strings.Contains(p.Template, "{cursor}") {
+				add(base+"/template", "template must contain {cursor} when a cursor is set")
+			}
+			if p.Cursor == "" && p.Template != "" && !strings.Contains(p.Template, "{page}") {
+				add(base+"/template", "template must contain {page} or set a cursor")
+			}
+		}
+	}
+
+	if login := host.Login; login != nil {
+		for name, value := range login.Fields {
+			for _, m := range CredentialPattern.FindAllStringSubmatch(value, -1) {
+				if (m[1] != "env" && m[1] != "secret") || m[2] == "" {
+					add("/login/fields/"+pointerEscape(name), "invalid credential {%s}, expected ${env:NAME} or ${secret:NAME}", m[0])
+				}
+			}
+		}
+	}
+
+	for i, script := range host.Scripts {
+		if script.Timeout == "" {
+			continue
+		}
+
+		if _, err := time.ParseDuration(script.Timeout); err != nil {
+			add("/scripts/"+strconv.Itoa(i)+"/timeout", "invalid timeout: %s", err)
+		}
+	}
+
+	return problems
+}
+
+// schemaErrors flattens a schema validation error into the problems that caused it
+func schemaErrors(filename string, lines map[string]int, verr *jsonschema.ValidationError) ModelErrors {
+	if len(verr.Causes) == 0 {
+		path := verr.InstanceLocation
+
+		// point unknown keys at the line the key is on rather than its parent
+		if strings.HasPrefix(verr.Message, "additionalProperties") {
+			if m := quotedName.FindStringSubmatch(verr.Message); m != nil {
+				path = path + "/" + pointerEscape(m[1])
+			}
+		}
+
+		return ModelErrors{{
+			File:    filename,
+			Line:    lineOf(lines, path),
+			Path:    displayPath(path),
+			Message: verr.Message,
+		}}
+	}
+
+	var problems ModelErrors
+	for _, cause := range verr.Causes {
+		problems = append(problems, schemaErrors(filename, lines, cause)...)
+	}
+	return problems
+}
+
+func sortModelErrors(problems ModelErrors) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+}
+
+// lineOf finds the line of a value, falling back to the nearest parent that is known
+func lineOf(lines map[string]int, path string) int {
+	for {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			return 1
+		}
+		path = path[:i]
+	}
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func pointerEscape(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+// decodeJSONModel decodes a JSON model and records the line of every key and value,
+// indexed by JSON pointer
+func decodeJSONModel(data []byte) (interface{}, map[string]int, error) {
+	var doc interface{}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		if serr, ok := err.(*json.SyntaxError); ok {
+			return nil, nil, errors.Errorf("line %d: %s", offsetLine(data, serr.Offset), serr)
+		}
+		return nil, nil, err
+	}
+
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	// the line a token starts on is found by skipping the separators that follow the
+	// previous token
+	next := func() int {
+		offset := dec.InputOffset()
+		for offset < int64(len(data)) && strings.IndexByte(" \t\r\n:,", data[offset]) >= 0 {
+			offset++
+		}
+		return offsetLine(data, offset)
+	}
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		if _, ok := lines[path]; !ok {
+			lines[path] = next()
+		}
+
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				line := next()
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+
+				child := path + "/" + pointerEscape(key.(string))
+				lines[child] = line
+				err = walk(child)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				err := walk(path + "/" + strconv.Itoa(i))
+				if err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
+
+		return nil
+	}
+
+	err = walk("")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc, lines, nil
+}
+
+func offsetLine(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// decodeYAMLModel decodes a YAML model into the same form as a JSON model and records
+// the line of every key and value, indexed by JSON pointer
+func decodeYAMLModel(data []byte) (interface{}, map[string]int, error) {
+	var node yaml.Node
+	err := yaml.Unmarshal(data, &node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var raw interface{}
+	err = node.Decode(&raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// round trip through json so numbers and maps have the same types as a json model
+	normalised, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(normalised, &doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := make(map[string]int)
+	var walk func(n *yaml.Node, path string)
+	walk = func(n *yaml.Node, path string) {
+		if _, ok := lines[path]; !ok {
+			lines[path] = n.Line
+		}
+
+		switch n.Kind {
+		case yaml.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				child := path + "/" + pointerEscape(n.Content[i].Value)
+				lines[child] = n.Content[i].Line
+				walk(n.Content[i+1], child)
+			}
+
+		case yaml.SequenceNode:
+			for i, c := range n.Content {
+				walk(c, path+"/"+strconv.Itoa(i))
+			}
+		}
+	}
+	walk(&node, "")
+
+	return doc, lines, nil
+}
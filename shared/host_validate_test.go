@@ -0,0 +1,218 @@
+package shared
+
+import (
+	"testing"
+)
+
+func TestParseHostFormats(t *testing.T) {
+	for _, name := range []string{"model.json", "model.yaml"} {
+		data := validHostJSON
+		if isYAML(name) {
+			data = validHostYAML
+		}
+
+		host, err := ParseHost(name, []byte(data))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if host.Host != "www.example.com" || len(host.Alias) != 1 {
+			t.Errorf("%s: unexpected host %+v", name, host)
+		}
+
+		if len(host.Schedular) != 1 || host.Schedular[0].Type != RSS {
+			t.Errorf("%s: unexpected schedular %+v", name, host.Schedular)
+		}
+
+		rule := host.Extractor[0]
+		if rule.Fields["title"].Kind != "String" || rule.Constraints["title"].MinLength != 5 {
+			t.Errorf("%s: unexpected extraction %+v", name, rule)
+		}
+	}
+}
+
+func TestParseHostErrors(t *testing.T) {
+	for _, vt := range hostValidationTests {
+		_, err := ParseHost(vt.name, []byte(vt.model))
+		problems, ok := err.(ModelErrors)
+		if !ok {
+			t.Fatalf("%s: expected model errors, got %v", vt.name, err)
+		}
+
+		if len(problems) != len(vt.lines) {
+			t.Fatalf("%s: expected %d problems, got %s", vt.name, len(vt.lines), problems)
+		}
+
+		for i, p := range problems {
+			if p.Line != vt.lines[i] {
+				t.Errorf("%s: expected problem on line %d, got %s", vt.name, vt.lines[i], p)
+			}
+		}
+	}
+}
+
+const validHostJSON = `{
+	"host": "www.example.com",
+	"alias": ["example.com"],
+	"schedular": [{
+		"type": "RSS",
+		"data": { "feeds": ["https://www.example.com/rss"] }
+	}],
+	"extraction": [{
+		"@type": "NewsArticle",
+		"@pageMatcher": [".article"],
+		"fields": {
+			"title": { "type": "String", "matcher": "h1", "content": "innerHTML" }
+		},
+		"required": ["title"],
+		"constraints": { "title": { "minLength": 5 } }
+	}]
+}`
+
+const validHostYAML = `
+host: www.example.com
+alias:
+  - example.com
+schedular:
+  - type: RSS
+    data:
+      feeds:
+        - https://www.example.com/rss
+extraction:
+  - "@type": NewsArticle
+    "@pageMatcher": [".article"]
+    fields:
+      title:
+        type: String
+        matcher: h1
+        content: innerHTML
+    required: [title]
+    constraints:
+      title:
+        minLength: 5
+`
+
+type hostValidationTest struct {
+	name  string
+	model string
+	lines []int
+}
+
+var hostValidationTests = []hostValidationTest{
+	hostValidationTest{
+		name: "unknown-key.json",
+		model: `{
+	"host": "www.example.com",
+	"extraction": [{
+		"@type": "NewsArticle",
+		"@pageMatchers": [".article"],
+		"fields": {}
+	}]
+}`,
+		lines: []int{3, 5},
+	},
+	hostValidationTest{
+		name: "field-type.json",
+		model: `{
+	"host": "www.example.com",
+	"extraction": [{
+		"@type": "NewsArticle",
+		"@pageMatcher": [".article"],
+		"fields": {
+			"title": { "type": "string", "matcher": "h1" }
+		}
+	}]
+}`,
+		lines: []int{7},
+	},
+	hostValidationTest{
+		name: "missing-feeds.yaml",
+		model: `
+host: www.example.com
+schedular:
+  - type: RSS
+    data:
+      feed: https://www.example.com/rss
+`,
+		lines: []int{5, 6},
+	},
+	hostValidationTest{
+		name: "required-field.json",
+		model: `{
+	"host": "www.example.com",
+	"extraction": [{
+		"@type": "NewsArticle",
+		"@pageMatcher": [".article"],
+		"fields": {
+			"title": { "type": "String", "matcher": "h1" }
+		},
+		"required": ["title", "body"]
+	}]
+}`,
+		lines: []int{9},
+	},
+	hostValidationTest{
+		name: "api-paths.json",
+		model: `{
+	"host": "api.example.com",
+	"api": [{
+		"@type": "Product",
+		"@records": "data[*]",
+		"fields": {
+			"name": { "type": "String", "path": "$.name[" }
+		},
+		"pagination": { "cursor": "$.next", "template": "/v1/products" }
+	}]
+}`,
+		lines: []int{5, 7, 9},
+	},
+	hostValidationTest{
+		name: "api-pagination.yaml",
+		model: `
+host: api.example.com
+api:
+  - "@type": Product
+    fields:
+      name: { type: String, path: $.name }
+    pagination:
+      cursor: $.next
+`,
+		lines: []int{7, 7, 7},
+	},
+	hostValidationTest{
+		name: "proxy-mode.yaml",
+		model: `
+host: www.example.com
+proxy:
+  mode: sticky
+  tags: [de]
+`,
+		lines: []int{4},
+	},
+	hostValidationTest{
+		name: "login.yaml",
+		model: `
+host: www.example.com
+login:
+  url: https://www.example.com/login
+  fields:
+    user: ${env:EXAMPLE_USER}
+    pass: ${vault:example}
+  success:
+    contains: Sign out
+`,
+		lines: []int{7},
+	},
+	hostValidationTest{
+		name: "login-success.json",
+		model: `{
+	"host": "www.example.com",
+	"login": {
+		"url": "/login",
+		"fields": { "user": "reader" },
+		"success": {}
+	}
+}`,
+		lines: []int{4, 6},
+	},
+}
@@ -0,0 +1,203 @@
+package shared
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A HostWatcher watches a directory of host models and reloads them when a file is
+// added, changed or removed. A model that fails to parse or validate is logged and the
+// last good version of that file is kept, so a typo never takes a host offline.
+type HostWatcher struct {
+	dir      string
+	interval time.Duration
+	logger   *log.Logger
+
+	files map[string]fileStamp
+	hosts map[string]Host
+
+	listeners []func([]Host)
+	quit      chan chan bool
+	mu        sync.Mutex
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewHostWatcher creates a watcher that checks the directory for changes every interval
+func NewHostWatcher(dirname string, interval time.Duration, logger *log.Logger) *HostWatcher {
+	return &HostWatcher{
+		dir:      dirname,
+		interval: interval,
+		logger:   logger,
+		files:    make(map[string]fileStamp),
+		hosts:    make(map[string]Host),
+		quit:     make(chan chan bool),
+	}
+}
+
+// Load reads every model in the directory and returns the hosts that were loaded
+func (hw *HostWatcher) Load() ([]Host, error) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	_, err := hw.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	return hw.list(), nil
+}
+
+// OnChange registers a function that is called with the full set of hosts whenever
+// the models in the directory change
+func (hw *HostWatcher) OnChange(fn func([]Host)) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	hw.listeners = append(hw.listeners, fn)
+}
+
+// Start watching the directory for changes
+func (hw *HostWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(hw.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				hw.reload()
+				break
+
+			case q := <-hw.quit:
+				q <- true
+				return
+			}
+		}
+	}()
+}
+
+// Stop watching the directory
+func (hw *HostWatcher) Stop() {
+	wait := make(chan bool)
+	hw.quit <- wait
+	<-wait
+}
+
+func (hw *HostWatcher) reload() {
+	hw.mu.Lock()
+	changed, err := hw.scan()
+	if err != nil {
+		hw.mu.Unlock()
+		hw.logger.Println(err)
+		return
+	}
+
+	if !changed {
+		hw.mu.Unlock()
+		return
+	}
+
+	hosts := hw.list()
+	listeners := append([]func([]Host){}, hw.listeners...)
+	hw.mu.Unlock()
+
+	hw.logger.Printf("host models changed, reloaded %d hosts", len(hosts))
+	for _, fn := range listeners {
+		fn(hosts)
+	}
+}
+
+// scan compares the directory against what was last loaded, re-parsing the files that
+// have changed. It reports whether the set of hosts is different as a result
+func (hw *HostWatcher) scan() (bool, error) {
+	files, err := ioutil.ReadDir(hw.dir)
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to read hosts from dir {%s}", hw.dir)
+	}
+
+	// a change to a file that is not a model (such as a script) may affect any of the
+	// models, so they are all parsed again
+	var changed, reparseAll bool
+	var models []os.FileInfo
+	seen := make(map[string]bool)
+	dirty := make(map[string]bool)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		name := file.Name()
+		seen[name] = true
+
+		stamp := fileStamp{modTime: file.ModTime(), size: file.Size()}
+		if prev, ok := hw.files[name]; !ok || prev != stamp {
+			hw.files[name] = stamp
+			dirty[name] = true
+			reparseAll = reparseAll || !isModelFile(file)
+		}
+
+		if isModelFile(file) {
+			models = append(models, file)
+		}
+	}
+
+	for _, file := range models {
+		name := file.Name()
+		if !dirty[name] && !reparseAll {
+			continue
+		}
+
+		host, err := parseHost(path.Join(hw.dir, name))
+		if err != nil {
+			if _, ok := hw.hosts[name]; ok {
+				hw.logger.Printf("keeping previous version of %s: %s", name, err)
+			} else {
+				hw.logger.Println(err)
+			}
+			continue
+		}
+
+		hw.hosts[name] = host
+		changed = true
+	}
+
+	for name := range hw.files {
+		if seen[name] {
+			continue
+		}
+
+		delete(hw.files, name)
+		if _, ok := hw.hosts[name]; ok {
+			delete(hw.hosts, name)
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// list returns the loaded hosts ordered by the name of the file they came from
+func (hw *HostWatcher) list() []Host {
+	names := make([]string, 0, len(hw.hosts))
+	for name := range hw.hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hosts := make([]Host, 0, len(names))
+	for _, name := range names {
+		hosts = append(hosts, hw.hosts[name])
+	}
+	return hosts
+}
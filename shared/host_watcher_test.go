@@ -0,0 +1,63 @@
+package shared
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestHostWatcherReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawl3-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) {
+		err := ioutil.WriteFile(path.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("a.json", `{"host": "a.example.com"}`)
+
+	logger := log.New(ioutil.Discard, "", 0)
+	hw := NewHostWatcher(dir, time.Hour, logger)
+	hosts, err := hw.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hosts) != 1 || hosts[0].Host != "a.example.com" {
+		t.Fatalf("unexpected hosts loaded %+v", hosts)
+	}
+
+	var reloaded []Host
+	hw.OnChange(func(h []Host) {
+		reloaded = h
+	})
+
+	// a broken model keeps the previous version and does not notify
+	write("a.json", `{"host": "a.example.com", `)
+	hw.reload()
+	if reloaded != nil {
+		t.Fatal("expected a broken model not to trigger a reload")
+	}
+
+	write("a.json", `{"host": "a.example.com", "alias": ["example.com"]}`)
+	write("b.json", `{"host": "b.example.com"}`)
+	hw.reload()
+	if len(reloaded) != 2 || len(reloaded[0].Alias) != 1 || reloaded[1].Host != "b.example.com" {
+		t.Fatalf("unexpected hosts reloaded %+v", reloaded)
+	}
+
+	os.Remove(path.Join(dir, "b.json"))
+	hw.reload()
+	if len(reloaded) != 1 {
+		t.Fatalf("expected removed model to be dropped, got %+v", reloaded)
+	}
+}
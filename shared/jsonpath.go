@@ -0,0 +1,203 @@
+package shared
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// JSONPath is a compiled JSONPath expression. The supported subset is the root $,
+// children by .name or ['name'], wildcards with .* or [*], array indexes with [n]
+// (negative indexes count from the end) and recursive descent with ..name or ..*
+type JSONPath struct {
+	expr  string
+	steps []jsonPathStep
+}
+
+type jsonPathStep struct {
+	recursive bool
+	wildcard  bool
+	isIndex   bool
+	name      string
+	index     int
+}
+
+// CompileJSONPath parses a JSONPath expression
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, errors.Errorf("jsonpath {%s} must start with $", expr)
+	}
+
+	p := &JSONPath{expr: s}
+	for i := 1; i < len(s); {
+		recursive := false
+
+		switch s[i] {
+		case '.':
+			i++
+			if i < len(s) && s[i] == '.' {
+				recursive = true
+				i++
+			}
+
+			if i < len(s) && s[i] == '[' && recursive {
+				break
+			}
+
+			start := i
+			for i < len(s) && s[i] != '.' && s[i] != '[' {
+				i++
+			}
+			name := s[start:i]
+			if name == "" {
+				return nil, errors.Errorf("jsonpath {%s} has an empty name at %d", expr, start)
+			}
+
+			p.steps = append(p.steps, jsonPathStep{recursive: recursive, wildcard: name == "*", name: name})
+			continue
+
+		case '[':
+
+		default:
+			return nil, errors.Errorf("jsonpath {%s} has an unexpected %q at %d", expr, s[i], i)
+		}
+
+		step, end, err := parseJSONPathBracket(s, i)
+		if err != nil {
+			return nil, errors.Wrapf(err, "jsonpath {%s}", expr)
+		}
+		step.recursive = recursive
+		p.steps = append(p.steps, step)
+		i = end
+	}
+
+	return p, nil
+}
+
+// parseJSONPathBracket parses the bracket starting at i and returns where it ends
+func parseJSONPathBracket(s string, i int) (jsonPathStep, int, error) {
+	i++
+	if i < len(s) && (s[i] == '\'' || s[i] == '"') {
+		quote := s[i]
+		end := strings.IndexByte(s[i+1:], quote)
+		if end < 0 || i+end+2 >= len(s) || s[i+end+2] != ']' {
+			return jsonPathStep{}, 0, errors.Errorf("unterminated name at %d", i)
+		}
+		return jsonPathStep{name: s[i+1 : i+1+end]}, i + end + 3, nil
+	}
+
+	end := strings.IndexByte(s[i:], ']')
+	if end < 0 {
+		return jsonPathStep{}, 0, errors.Errorf("unterminated bracket at %d", i-1)
+	}
+
+	inner := strings.TrimSpace(s[i : i+end])
+	if inner == "*" {
+		return jsonPathStep{wildcard: true}, i + end + 1, nil
+	}
+
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return jsonPathStep{}, 0, errors.Errorf("invalid index {%s} at %d", inner, i)
+	}
+	return jsonPathStep{isIndex: true, index: index}, i + end + 1, nil
+}
+
+// String returns the expression the path was compiled from
+func (p *JSONPath) String() string {
+	return p.expr
+}
+
+// Find returns every value the path selects from a decoded JSON document, in document
+// order. Object members are visited in the order of their keys
+func (p *JSONPath) Find(data interface{}) []interface{} {
+	nodes := []interface{}{data}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, node := range nodes {
+			if step.recursive {
+				eachJSONNode(node, func(n interface{}) {
+					next = append(next, step.children(n)...)
+				})
+			} else {
+				next = append(next, step.children(node)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// First returns the first value the path selects and whether there was one
+func (p *JSONPath) First(data interface{}) (interface{}, bool) {
+	found := p.Find(data)
+	if len(found) == 0 {
+		return nil, false
+	}
+	return found[0], true
+}
+
+// children returns the values the step selects from a single node
+func (step jsonPathStep) children(node interface{}) []interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if step.wildcard {
+			var values []interface{}
+			for _, k := range sortedJSONKeys(n) {
+				values = append(values, n[k])
+			}
+			return values
+		}
+		if step.isIndex {
+			return nil
+		}
+		if v, ok := n[step.name]; ok {
+			return []interface{}{v}
+		}
+
+	case []interface{}:
+		if step.wildcard {
+			return n
+		}
+		if !step.isIndex {
+			return nil
+		}
+
+		i := step.index
+		if i < 0 {
+			i += len(n)
+		}
+		if i >= 0 && i < len(n) {
+			return []interface{}{n[i]}
+		}
+	}
+	return nil
+}
+
+// eachJSONNode calls fn with a node and every node below it
+func eachJSONNode(node interface{}, fn func(interface{})) {
+	fn(node)
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedJSONKeys(n) {
+			eachJSONNode(n[k], fn)
+		}
+	case []interface{}:
+		for _, v := range n {
+			eachJSONNode(v, fn)
+		}
+	}
+}
+
+func sortedJSONKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
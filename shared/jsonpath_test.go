@@ -0,0 +1,59 @@
+package shared
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const jsonPathDocument = `{
+	"store": {
+		"name": "corner",
+		"books": [
+			{ "title": "One", "price": 8, "tags": ["a", "b"] },
+			{ "title": "Two", "price": 12, "author": { "name": "Smith" } }
+		],
+		"odd key": true
+	}
+}`
+
+func TestJSONPath(t *testing.T) {
+	var doc interface{}
+	err := json.Unmarshal([]byte(jsonPathDocument), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr  string
+		found []interface{}
+	}{
+		{"$.store.name", []interface{}{"corner"}},
+		{"$.store.books[*].title", []interface{}{"One", "Two"}},
+		{"$.store.books[-1].price", []interface{}{float64(12)}},
+		{"$['store']['odd key']", []interface{}{true}},
+		{"$..name", []interface{}{"corner", "Smith"}},
+		{"$.store.books[0].tags[*]", []interface{}{"a", "b"}},
+		{"$..books[1].author.*", []interface{}{"Smith"}},
+		{"$.store.missing", nil},
+		{"$.store.books[5]", nil},
+	}
+
+	for _, tt := range tests {
+		p, err := CompileJSONPath(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.expr, err)
+		}
+
+		found := p.Find(doc)
+		if !reflect.DeepEqual(found, tt.found) {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.found, found)
+		}
+	}
+
+	for _, expr := range []string{"store.name", "$.", "$.books[", "$[one]", "$['name"} {
+		if _, err := CompileJSONPath(expr); err == nil {
+			t.Errorf("expected {%s} to be invalid", expr)
+		}
+	}
+}